@@ -5,6 +5,9 @@ import (
 )
 
 var port int
+var grpcPort int
+var mcPort int
+var respPort int
 var isInternal bool
 var isManage bool
 
@@ -20,6 +23,9 @@ var Cmd = &cobra.Command{
 
 func init() {
 	Cmd.Flags().IntVar(&port, "port", 8080, "listen port")
+	Cmd.Flags().IntVar(&grpcPort, "grpc-port", 0, "grpc listen port, 0 to disable")
+	Cmd.Flags().IntVar(&mcPort, "mc-port", 0, "memcached text protocol listen port, 0 to disable")
+	Cmd.Flags().IntVar(&respPort, "resp-port", 0, "redis RESP protocol listen port, 0 to disable")
 	Cmd.Flags().BoolVar(&isInternal, "internal", false, "internal service")
 	Cmd.Flags().BoolVar(&isManage, "manage", false, "manage service")
 }
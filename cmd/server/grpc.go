@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+
+	"github.com/busyfree/leaf-go/cmd/server/hook"
+	"github.com/busyfree/leaf-go/rpc/v1/public"
+	"github.com/busyfree/leaf-go/server/serverv1"
+)
+
+var (
+	grpcServer   *grpc.Server
+	healthServer *health.Server
+)
+
+// startGRPCServer 在 grpcPort 上提供与 twirp 相同的 Server 服务,以及健康检查和反射,grpcPort 为 0 时不启动
+func startGRPCServer(host string) {
+	if grpcPort <= 0 {
+		return
+	}
+	// 拦截器按顺序执行,recovery 放在最内层,panic 转换的错误也会被记录
+	opts := []grpc.ServerOption{grpc.ChainUnaryInterceptor(
+		hook.NewGRPCRequestID(),
+		hook.NewGRPCLog(),
+		hook.NewGRPCAuth(),
+		hook.NewGRPCRecovery(),
+	)}
+	if serverTLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(serverTLS.TLSConfig("h2"))))
+	}
+	grpcServer = grpc.NewServer(opts...)
+	public.RegisterServerServer(grpcServer, &serverv1.Public{})
+
+	healthServer = health.NewServer()
+	healthServer.SetServingStatus(public.Server_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
+	reflection.Register(grpcServer)
+
+	addr := fmt.Sprintf("%s:%d", host, grpcPort)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		panic(err)
+	}
+	logger.Infof("start grpc server on %s", addr)
+	go func(s *grpc.Server) {
+		if err := s.Serve(ln); err != nil && err != grpc.ErrServerStopped {
+			panic(err)
+		}
+	}(grpcServer)
+}
+
+// stopGRPCServer 先把健康检查置为 NOT_SERVING,再等待处理中的请求结束,超时后强制关闭
+func stopGRPCServer(ctx context.Context) {
+	if grpcServer == nil {
+		return
+	}
+	logger.Info("stop grpc server")
+	healthServer.Shutdown()
+	done := make(chan struct{})
+	go func(s *grpc.Server) {
+		s.GracefulStop()
+		close(done)
+	}(grpcServer)
+	select {
+	case <-done:
+	case <-ctx.Done():
+		grpcServer.Stop()
+	}
+	grpcServer = nil
+	healthServer = nil
+}
@@ -16,6 +16,7 @@ import (
 var hooks = twirp.ChainHooks(
 	hook.NewRequestID(),
 	hook.NewLog(),
+	hook.NewAuth(),
 )
 
 var privateHooks = twirp.ChainHooks(
@@ -29,6 +30,14 @@ var allowGetHooks = twirp.ChainHooks(
 	hook.NewLog(),
 )
 
+var (
+	snowflakeService *service.SnowFlakeIdGenImpl
+	segmentService   *service.SegmentIDGenImpl
+	ulidService      *service.UlidIdGenImpl
+	uuidV7Service    *service.UuidV7IdGenImpl
+	formattedService *service.FormattedIdGenImpl
+)
+
 func initMux(mux *http.ServeMux, isInternal bool) {
 	snowflakePort := conf.GetInt("LEAF_SNOWFLAKE_PORT")
 	leafSnowflakeTime := conf.GetTime("LEAF_SNOWFLAKE_START_TIME")
@@ -36,19 +45,38 @@ func initMux(mux *http.ServeMux, isInternal bool) {
 	if leafSnowflakeTime.IsZero() {
 		leafSnowflakeTwepoch = 1288834974657
 	}
-	snowflakeService := service.NewSnowFlakeIdGenImpl(snowflakePort, leafSnowflakeTwepoch)
-	segmentService := service.NewSegmentIDGenImpl()
+	snowflakeService = service.NewSnowFlakeIdGenImpl(snowflakePort, leafSnowflakeTwepoch)
+	segmentService = service.NewSegmentIDGenImpl()
+	ulidService = service.NewUlidIdGenImpl()
+	uuidV7Service = service.NewUuidV7IdGenImpl(snowflakeService.WorkerId())
+	formattedService = service.NewFormattedIdGenImpl(segmentService)
 	{
-		serverv1.Init(segmentService, snowflakeService)
+		serverv1.Init(segmentService, snowflakeService, ulidService, uuidV7Service)
 		serverPublic := &serverv1.Public{}
 		handler := public.NewServerServer(serverPublic, hooks)
 		mux.Handle(public.ServerPathPrefix, handler)
 	}
 	{
-		webgin.InitWebGin(segmentService, snowflakeService)
+		webgin.InitWebGin(segmentService, snowflakeService, ulidService, uuidV7Service, formattedService)
 		mux.Handle(webgin.BASEURL, webgin.GinRoute)
 	}
 }
 
 func initInternalMux(mux *http.ServeMux) {
 }
+
+// closeServices 释放号段刷新协程和 snowflake workerId 心跳,重启前必须调用
+func closeServices() {
+	if snowflakeService != nil {
+		if err := snowflakeService.Close(); err != nil {
+			logger.Errorf("close snowflake service error:%+v", err)
+		}
+		snowflakeService = nil
+	}
+	if segmentService != nil {
+		if err := segmentService.Close(); err != nil {
+			logger.Errorf("close segment service error:%+v", err)
+		}
+		segmentService = nil
+	}
+}
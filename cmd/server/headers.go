@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/busyfree/leaf-go/util/auth"
 	"github.com/busyfree/leaf-go/util/conf"
 	"github.com/busyfree/leaf-go/util/ctxkit"
 )
@@ -14,7 +15,7 @@ func initCROSHeaders(w http.ResponseWriter, r *http.Request) bool {
 	corsHeaders := conf.GetString("CORS_ORIGIN_HEADERS")
 	suffixs := conf.GetStringSlice("CORS_ORIGIN_SUFFIX")
 	if len(corsHeaders) == 0 {
-		corsHeaders = "DNT,User-Agent,X-Requested-With,If-Modified-Since,Cache-Control,Content-Type,Range"
+		corsHeaders = "DNT,User-Agent,X-Requested-With,If-Modified-Since,Cache-Control,Content-Type,Range,X-Leaf-AppKey,X-Leaf-Ts,X-Leaf-Sign"
 	}
 
 	if r.Method == http.MethodOptions {
@@ -58,6 +59,11 @@ func initRequestHeaders(w http.ResponseWriter, req *http.Request) *http.Request
 	}
 	ctx := req.Context()
 	ctx = ctxkit.WithUserIP(ctx, ip)
+	// 签名在这里统一校验,twirp hook 和 gin 中间件只读取校验结果
+	if appkey, ts, sign := auth.FromRequest(req); len(appkey) > 0 {
+		ctx = ctxkit.WithSign(ctx, appkey, ts, sign)
+		ctx = ctxkit.WithValidSign(ctx, auth.Verify(appkey, ts, sign, req.Method, req.URL.Path, auth.CanonicalQuery(req.URL.Query())))
+	}
 	req = req.WithContext(ctx)
 	return req
 }
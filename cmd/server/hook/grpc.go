@@ -0,0 +1,100 @@
+package hook
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/busyfree/leaf-go/util/ctxkit"
+	"github.com/busyfree/leaf-go/util/log"
+	"github.com/busyfree/leaf-go/util/metrics"
+	"github.com/busyfree/leaf-go/util/trace"
+)
+
+// NewGRPCRequestID 与 NewRequestID 一致,生成唯一请求标识记录到 ctx 并通过 x-trace-id 响应头返回
+func NewGRPCRequestID() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		span, ctx := opentracing.StartSpanFromContext(ctx, "ServerGRPC")
+		defer span.Finish()
+		ext.SpanKindRPCServer.Set(span)
+		span.SetTag("grpc.method", info.FullMethod)
+
+		ctx = context.WithValue(ctx, ctxkit.StartTimeKey, time.Now())
+
+		traceID := trace.GetTraceID(ctx)
+		_ = grpc.SetHeader(ctx, metadata.Pairs("x-trace-id", traceID))
+
+		ctx = ctxkit.WithTraceID(ctx, traceID)
+
+		return handler(ctx, req)
+	}
+}
+
+// NewGRPCLog 与 NewLog 一致,统一记录请求日志和耗时指标
+func NewGRPCLog() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+
+		code := status.Code(err)
+		if ctx.Err() != nil && code == codes.OK {
+			code = codes.Unavailable
+		}
+
+		var bizCode int32
+		var bizMsg string
+		if br, ok := resp.(bizResponse); ok {
+			bizCode = br.GetCode()
+			bizMsg = br.GetMsg()
+		}
+
+		duration := time.Since(ctx.Value(ctxkit.StartTimeKey).(time.Time))
+
+		// 与 twirp 的 404 一样,未实现的方法不计入指标
+		if code != codes.Unimplemented {
+			metrics.RPCDurationsSeconds.WithLabelValues(
+				info.FullMethod,
+				code.String(),
+			).Observe(duration.Seconds())
+		}
+
+		switch code {
+		case codes.OK:
+		case codes.Unknown, codes.Internal, codes.DataLoss, codes.Unavailable:
+			log.Get(ctx).Errorf("%+v", err)
+		default:
+			log.Get(ctx).Warn(err)
+		}
+
+		log.Get(ctx).WithFields(log.Fields{
+			"path":     info.FullMethod,
+			"status":   code.String(),
+			"params":   fmt.Sprintf("%v", req),
+			"cost":     duration.Seconds(),
+			"biz_code": bizCode,
+			"biz_msg":  bizMsg,
+		}).Info("new grpc")
+
+		return resp, err
+	}
+}
+
+// NewGRPCRecovery 捕获 handler 中的 panic,返回 codes.Internal
+func NewGRPCRecovery() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				log.Get(ctx).Error(rec, string(debug.Stack()))
+				err = status.Errorf(codes.Internal, "panic: %v", rec)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
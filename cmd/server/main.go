@@ -5,8 +5,10 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/busyfree/leaf-go/service"
 	"github.com/busyfree/leaf-go/util"
 	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/limiter"
 	_ "github.com/busyfree/leaf-go/util/redis"
 )
 
@@ -24,6 +26,12 @@ func main() {
 		select {
 		case <-reload:
 			util.Reset()
+			reloadServerTLS()
+			service.ReloadIdEncoding()
+			// 规则不合法时保留原规则
+			if err := limiter.Load(); err != nil {
+				logger.Errorf("reload sentinel rules error:%+v", err)
+			}
 		case sg := <-stop:
 			stopServer()
 			// 仿 nginx 使用 HUP 信号重载配置
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/busyfree/leaf-go/server/mcserver"
+	"github.com/busyfree/leaf-go/util/auth"
+	"github.com/busyfree/leaf-go/util/conf"
+)
+
+var mcServer *mcserver.Server
+
+// startMCServer 在 mcPort 上以 memcached 文本协议提供发号,mcPort 为 0 时不启动
+func startMCServer(host string) {
+	if mcPort <= 0 {
+		return
+	}
+	// memcached 协议无法携带签名,开启鉴权时拒绝启动,避免绕过鉴权发号
+	if auth.Enabled() {
+		panic("memcached server does not support auth, unset --mc-port when LEAF_AUTH_ENABLE is true")
+	}
+	idleTimeout := conf.GetDuration("LEAF_MC_IDLE_TIMEOUT") * time.Second
+	mcServer = mcserver.NewServer(segmentService, snowflakeService, idleTimeout)
+	addr := fmt.Sprintf("%s:%d", host, mcPort)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		panic(err)
+	}
+	ln = tlsListener(ln)
+	logger.Infof("start memcached server on %s", addr)
+	go func(s *mcserver.Server) {
+		if err := s.Serve(ln); err != nil {
+			panic(err)
+		}
+	}(mcServer)
+}
+
+func stopMCServer() {
+	if mcServer == nil {
+		return
+	}
+	logger.Info("stop memcached server")
+	if err := mcServer.Close(); err != nil {
+		logger.Errorf("close memcached server error:%+v", err)
+	}
+	mcServer = nil
+}
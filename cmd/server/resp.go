@@ -0,0 +1,49 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/busyfree/leaf-go/server/respserver"
+	"github.com/busyfree/leaf-go/util/auth"
+	"github.com/busyfree/leaf-go/util/conf"
+)
+
+var respServer *respserver.Server
+
+// startRESPServer 在 respPort 上以 Redis RESP 协议提供发号,respPort 为 0 时不启动
+func startRESPServer(host string) {
+	if respPort <= 0 {
+		return
+	}
+	// RESP 协议无法携带签名,开启鉴权时拒绝启动,避免绕过鉴权发号
+	if auth.Enabled() {
+		panic("resp server does not support auth, unset --resp-port when LEAF_AUTH_ENABLE is true")
+	}
+	idleTimeout := conf.GetDuration("LEAF_RESP_IDLE_TIMEOUT") * time.Second
+	respServer = respserver.NewServer(segmentService, snowflakeService, idleTimeout, conf.GetInt("LEAF_RESP_MAX_BATCH"))
+	addr := fmt.Sprintf("%s:%d", host, respPort)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		panic(err)
+	}
+	ln = tlsListener(ln)
+	logger.Infof("start resp server on %s", addr)
+	go func(s *respserver.Server) {
+		if err := s.Serve(ln); err != nil {
+			panic(err)
+		}
+	}(respServer)
+}
+
+func stopRESPServer() {
+	if respServer == nil {
+		return
+	}
+	logger.Info("stop resp server")
+	if err := respServer.Close(); err != nil {
+		logger.Errorf("close resp server error:%+v", err)
+	}
+	respServer = nil
+}
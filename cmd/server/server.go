@@ -12,16 +12,16 @@ import (
 	"time"
 
 	sentinel "github.com/alibaba/sentinel-golang/api"
-	"github.com/alibaba/sentinel-golang/core/flow"
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/spf13/cast"
 
+	"github.com/busyfree/leaf-go/server/webgin"
 	"github.com/busyfree/leaf-go/service"
 	"github.com/busyfree/leaf-go/util"
 	"github.com/busyfree/leaf-go/util/conf"
 	"github.com/busyfree/leaf-go/util/ctxkit"
+	"github.com/busyfree/leaf-go/util/limiter"
 	"github.com/busyfree/leaf-go/util/log"
 	_ "github.com/busyfree/leaf-go/util/redis"
 	"github.com/busyfree/leaf-go/util/trace"
@@ -107,27 +107,14 @@ func initSentinel() {
 	if err != nil {
 		panic(fmt.Sprintf("missing sentinel config file:%s", sentinelConfigFilePath))
 	}
-	qpsMaps := conf.GetStrMapStr("SENTINEL_RES_QPS")
-	if len(qpsMaps) > 0 {
-		rules := make([]*flow.Rule, 0, 0)
-		for resName, resQPSStr := range qpsMaps {
-			rule := &flow.Rule{
-				Resource:               resName,
-				Threshold:              cast.ToFloat64(resQPSStr),
-				TokenCalculateStrategy: flow.Direct,
-				ControlBehavior:        flow.Reject,
-			}
-			rules = append(rules, rule)
-		}
-		_, err = flow.LoadRules(rules)
-		if err != nil {
-			panic(err)
-		}
+	if err = limiter.Load(); err != nil {
+		panic(err)
 	}
 }
 
 func startServer() {
 	logger.Info("start server")
+	initServerTLS()
 
 	rand.Seed(int64(time.Now().Nanosecond()))
 
@@ -149,16 +136,20 @@ func startServer() {
 
 	handler := http.TimeoutHandler(panicHandler{handler: mux}, timeout, "timeout")
 
-	http.Handle("/", handler)
+	// 每次启动使用新的 ServeMux,配置下发重启时重复注册 DefaultServeMux 会 panic
+	rootMux := http.NewServeMux()
+	rootMux.Handle("/", handler)
+	// 流式接口持续时间由调用方决定,不设置超时
+	rootMux.Handle(webgin.STREAMURL, panicHandler{handler: mux})
 
 	metricsHandler := promhttp.Handler()
 
-	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+	rootMux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
 		util.GatherMetrics()
 		metricsHandler.ServeHTTP(w, r)
 	})
 
-	http.HandleFunc("/monitor/ping", func(w http.ResponseWriter, r *http.Request) {
+	rootMux.HandleFunc("/monitor/ping", func(w http.ResponseWriter, r *http.Request) {
 		_, _ = w.Write([]byte("pong"))
 	})
 
@@ -170,6 +161,7 @@ func startServer() {
 
 	addr := fmt.Sprintf("%s:%d", serverHttp, port)
 	server = &http.Server{
+		Handler:     rootMux,
 		IdleTimeout: 120 * time.Second,
 	}
 
@@ -185,13 +177,22 @@ func startServer() {
 		}
 		wg.Done()
 
-		err = server.Serve(tcpKeepAliveListener{ln.(*net.TCPListener)})
+		if serverTLS != nil {
+			server.TLSConfig = serverTLS.TLSConfig("h2", "http/1.1")
+			err = server.ServeTLS(tcpKeepAliveListener{ln.(*net.TCPListener)}, "", "")
+		} else {
+			err = server.Serve(tcpKeepAliveListener{ln.(*net.TCPListener)})
+		}
 		if err != http.ErrServerClosed {
 			panic(err)
 		}
 	}()
 
 	wg.Wait()
+
+	startGRPCServer(serverHttp)
+	startMCServer(serverHttp)
+	startRESPServer(serverHttp)
 }
 
 func stopServer() {
@@ -200,8 +201,12 @@ func stopServer() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	stopGRPCServer(ctx)
+	stopMCServer()
+	stopRESPServer()
 	if err := server.Shutdown(ctx); err != nil {
 		logger.Fatal(err)
 	}
+	closeServices()
 	util.Reset()
 }
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+
+	"github.com/busyfree/leaf-go/util/tlsutil"
+)
+
+var serverTLS *tlsutil.ServerConfig
+
+// initServerTLS 配置了 SERVER_TLS_CERT_FILE 时 http、grpc、memcached、RESP 监听都使用 TLS
+func initServerTLS() {
+	var err error
+	serverTLS, err = tlsutil.NewServerConfig("SERVER_TLS")
+	if err != nil {
+		panic(err)
+	}
+	if serverTLS != nil {
+		logger.Info("server tls enabled")
+	}
+}
+
+// reloadServerTLS 配置变更时重新加载证书,只影响新建立的连接,加载失败时继续使用原证书
+func reloadServerTLS() {
+	if serverTLS == nil {
+		return
+	}
+	if err := serverTLS.Reload(); err != nil {
+		logger.Errorf("reload server tls error:%+v", err)
+		return
+	}
+	logger.Info("server tls reloaded")
+}
+
+func tlsListener(ln net.Listener) net.Listener {
+	if serverTLS == nil {
+		return ln
+	}
+	return tls.NewListener(ln, serverTLS.TLSConfig())
+}
@@ -8,11 +8,12 @@ import (
 )
 
 var (
-	tableLeafAlloc = new(schema.LeafAlloc)
+	tableLeafAlloc      = new(schema.LeafAlloc)
+	tableLeafWorkerNode = new(schema.LeafWorkerNode)
 )
 
 func SyncXORMTables() {
 	ctx := context.Background()
 	c := db.GetXORM(ctx, "default")
-	_ = c.Sync2(tableLeafAlloc)
+	_ = c.Sync2(tableLeafAlloc, tableLeafWorkerNode)
 }
@@ -71,9 +71,45 @@ func (dao *LeafAllocDao) UpdateMaxIdByCustomStep(ctx context.Context, step int,
 	return
 }
 
+// Insert 写入新的 biz_tag,已存在时返回唯一键错误,可用 db.IsDuplicateEntryErr 判断
+func (dao *LeafAllocDao) Insert(ctx context.Context) (err error) {
+	dao.BeforeInsert()
+	c := db.Get(ctx, ctxkit.GetProjectDBName(ctx))
+	sqlInsert := fmt.Sprintf("INSERT INTO %s (biz_tag, max_id, step, description, created_at, deleted_at, update_time) VALUES (?, ?, ?, ?, ?, ?, ?)", dao.TableName())
+	q := db.SQLInsert(dao.TableName(), sqlInsert)
+	_, err = c.ExecContext(
+		ctx,
+		q,
+		dao.BizTag,
+		dao.MaxId,
+		dao.Step,
+		dao.Description,
+		dao.CreatedAt,
+		dao.DeletedAt,
+		dao.UpdatedAt)
+	return
+}
+
+// SoftDelete 标记 biz_tag 已删除,不再加载到号段缓存
+func (dao *LeafAllocDao) SoftDelete(ctx context.Context, tag string) (err error) {
+	dao.BeforeUpdate()
+	c := db.Get(ctx, ctxkit.GetProjectDBName(ctx))
+	sqlUpdate := fmt.Sprintf("UPDATE %s SET deleted_at=?, update_time=? WHERE biz_tag =? AND deleted_at=0", dao.TableName())
+	q := db.SQLUpdate(dao.TableName(), sqlUpdate)
+	_, err = c.ExecContext(
+		ctx,
+		q,
+		dao.UpdatedAt,
+		dao.UpdatedAt,
+		tag)
+	return
+}
+
+// GetAllTags 返回未删除的 biz_tag,与 GetLeafAlloc 一样要求表中有 deleted_at 列,
+// 建表和迁移语句见 models/schema/leaf_alloc.sql
 func (dao *LeafAllocDao) GetAllTags(ctx context.Context) (array []string, err error) {
 	c := db.Get(ctx, ctxkit.GetProjectDBName(ctx))
-	sqlStr := "SELECT biz_tag FROM %s"
+	sqlStr := "SELECT biz_tag FROM %s WHERE deleted_at=0"
 	sqlSelect := fmt.Sprintf(sqlStr, dao.TableName())
 	q := db.SQLSelect(dao.TableName(), sqlSelect)
 	var rows *sql.Rows
@@ -0,0 +1,177 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/busyfree/leaf-go/models/schema"
+	"github.com/busyfree/leaf-go/util/ctxkit"
+	"github.com/busyfree/leaf-go/util/db"
+)
+
+type LeafWorkerNodeDao struct {
+	schema.LeafWorkerNode
+}
+
+func NewLeafWorkerNodeDao() *LeafWorkerNodeDao {
+	return new(LeafWorkerNodeDao)
+}
+
+// DbNow 返回数据库当前时间(毫秒),心跳统一使用数据库时间,不受各节点本机时钟偏差影响
+func (dao *LeafWorkerNodeDao) DbNow(ctx context.Context) (now int64, err error) {
+	c := db.Get(ctx, ctxkit.GetProjectDBName(ctx))
+	q := db.SQLSelect(dao.TableName(), "SELECT ROUND(UNIX_TIMESTAMP(NOW(3))*1000)")
+	result := c.QueryRowContext(ctx, q)
+	if result == nil {
+		err = sql.ErrNoRows
+		return
+	}
+	err = result.Scan(&now)
+	return
+}
+
+// GetByEndpoint 查询 ip:port 持有的 workerId,不存在时返回 sql.ErrNoRows
+func (dao *LeafWorkerNodeDao) GetByEndpoint(ctx context.Context, ip, port string) (err error) {
+	c := db.Get(ctx, ctxkit.GetProjectDBName(ctx))
+	sqlSelect := fmt.Sprintf("SELECT id, ip, port, worker_id, last_timestamp, heartbeat FROM %s WHERE ip = ? AND port = ?", dao.TableName())
+	q := db.SQLSelect(dao.TableName(), sqlSelect)
+	result := c.QueryRowContext(ctx, q, ip, port)
+	if result == nil {
+		err = sql.ErrNoRows
+		return
+	}
+	err = result.Scan(&dao.Id, &dao.Ip, &dao.Port, &dao.WorkerId, &dao.LastTimestamp, &dao.Heartbeat)
+	return
+}
+
+func (dao *LeafWorkerNodeDao) GetAllWorkerIds(ctx context.Context) (array []int, err error) {
+	c := db.Get(ctx, ctxkit.GetProjectDBName(ctx))
+	sqlSelect := fmt.Sprintf("SELECT worker_id FROM %s", dao.TableName())
+	q := db.SQLSelect(dao.TableName(), sqlSelect)
+	var rows *sql.Rows
+	rows, err = c.QueryContext(ctx, q)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var workerId int
+		if err := rows.Scan(
+			&workerId,
+		); err != nil {
+			continue
+		}
+		array = append(array, workerId)
+	}
+	err = rows.Close()
+	if err != nil {
+		return
+	}
+	err = rows.Err()
+	return
+}
+
+// Insert 写入新节点,ip:port 或 worker_id 冲突时返回唯一键错误,可用 db.IsDuplicateEntryErr 判断
+func (dao *LeafWorkerNodeDao) Insert(ctx context.Context) (err error) {
+	dao.BeforeInsert()
+	c := db.Get(ctx, ctxkit.GetProjectDBName(ctx))
+	sqlInsert := fmt.Sprintf("INSERT INTO %s (ip, port, worker_id, last_timestamp, heartbeat, created_at, update_time) VALUES (?, ?, ?, ?, ?, ?, ?)", dao.TableName())
+	q := db.SQLInsert(dao.TableName(), sqlInsert)
+	_, err = c.ExecContext(
+		ctx,
+		q,
+		dao.Ip,
+		dao.Port,
+		dao.WorkerId,
+		dao.LastTimestamp,
+		dao.Heartbeat,
+		dao.CreatedAt,
+		dao.UpdatedAt)
+	return
+}
+
+// GetStaleWorkerIds 查询心跳早于 heartbeat(数据库时间)的 workerId,这些节点已经停止服务,workerId 可以回收
+func (dao *LeafWorkerNodeDao) GetStaleWorkerIds(ctx context.Context, heartbeat int64) (array []int, err error) {
+	c := db.Get(ctx, ctxkit.GetProjectDBName(ctx))
+	sqlSelect := fmt.Sprintf("SELECT worker_id FROM %s WHERE heartbeat < ? ORDER BY worker_id", dao.TableName())
+	q := db.SQLSelect(dao.TableName(), sqlSelect)
+	var rows *sql.Rows
+	rows, err = c.QueryContext(ctx, q, heartbeat)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var workerId int
+		if err := rows.Scan(
+			&workerId,
+		); err != nil {
+			continue
+		}
+		array = append(array, workerId)
+	}
+	err = rows.Close()
+	if err != nil {
+		return
+	}
+	err = rows.Err()
+	return
+}
+
+// TakeOver 心跳早于 heartbeat(数据库时间)且时间戳不晚于 dao.LastTimestamp 时把 worker_id 对应的行改为当前 ip:port,
+// last_timestamp 是原节点用该 workerId 发号的最大时间,不晚于本机时间才能保证不会生成重复 ID。
+// 条件更新保证并发回收时只有一个节点成功,返回是否回收成功
+func (dao *LeafWorkerNodeDao) TakeOver(ctx context.Context, heartbeat int64) (ok bool, err error) {
+	dao.BeforeUpdate()
+	c := db.Get(ctx, ctxkit.GetProjectDBName(ctx))
+	sqlUpdate := fmt.Sprintf("UPDATE %s SET ip = ?, port = ?, last_timestamp = ?, heartbeat = ?, update_time = ? WHERE worker_id = ? AND heartbeat < ? AND last_timestamp <= ?", dao.TableName())
+	q := db.SQLUpdate(dao.TableName(), sqlUpdate)
+	result, err := c.ExecContext(
+		ctx,
+		q,
+		dao.Ip,
+		dao.Port,
+		dao.LastTimestamp,
+		dao.Heartbeat,
+		dao.UpdatedAt,
+		dao.WorkerId,
+		heartbeat,
+		dao.LastTimestamp)
+	if err != nil {
+		return
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// UpdateHeartbeat 只更新仍由 ip:port 持有的行,返回 false 说明 workerId 已被其他节点回收
+func (dao *LeafWorkerNodeDao) UpdateHeartbeat(ctx context.Context) (ok bool, err error) {
+	dao.BeforeUpdate()
+	c := db.Get(ctx, ctxkit.GetProjectDBName(ctx))
+	sqlUpdate := fmt.Sprintf("UPDATE %s SET last_timestamp = ?, heartbeat = ?, update_time = ? WHERE ip = ? AND port = ? AND worker_id = ?", dao.TableName())
+	q := db.SQLUpdate(dao.TableName(), sqlUpdate)
+	result, err := c.ExecContext(
+		ctx,
+		q,
+		dao.LastTimestamp,
+		dao.Heartbeat,
+		dao.UpdatedAt,
+		dao.Ip,
+		dao.Port,
+		dao.WorkerId)
+	if err != nil {
+		return
+	}
+	// 同一毫秒内重复更新时 mysql 返回的影响行数为 0,需要再确认是否仍持有
+	n, err := result.RowsAffected()
+	if err != nil || n > 0 {
+		return n > 0, err
+	}
+	exist := NewLeafWorkerNodeDao()
+	err = exist.GetByEndpoint(ctx, dao.Ip, dao.Port)
+	if db.IsNoRowsErr(err) {
+		return false, nil
+	}
+	return err == nil && exist.WorkerId == dao.WorkerId, err
+}
@@ -14,4 +14,7 @@ const (
 	EXCEPTION_ID_IDCACHE_INIT_FALSE    ExceptionCode = -1
 	EXCEPTION_ID_KEY_NOT_EXISTS                      = -2
 	EXCEPTION_ID_TWO_SEGMENTS_ARE_NULL               = -3
+	EXCEPTION_ID_CLOCK_SKEW                          = -4
+	EXCEPTION_ID_SEQUENCE_OVERFLOW                   = -5
+	EXCEPTION_ID_WORKER_ID_LOST                      = -6
 )
@@ -3,10 +3,12 @@ package models
 type Result struct {
 	Id     int64  `json:"id"`
 	Status Status `json:"status"`
+	// Code biz tag 配置了编码方式时编码后的 ID
+	Code string `json:"code,omitempty"`
 }
 
 func NewResult(id int64, status Status) Result {
-	return Result{id, status}
+	return Result{Id: id, Status: status}
 }
 
 func (p *Result) GetId() int64 {
@@ -24,3 +26,21 @@ func (p *Result) SetId(id int64) {
 func (p *Result) SetStatus(status Status) {
 	p.Status = status
 }
+
+// StringResult 字符串 ID 结果,用于 ULID、UUIDv7
+type StringResult struct {
+	Id     string `json:"id"`
+	Status Status `json:"status"`
+}
+
+func NewStringResult(id string, status Status) StringResult {
+	return StringResult{id, status}
+}
+
+func (p *StringResult) GetId() string {
+	return p.Id
+}
+
+func (p *StringResult) GetStatus() Status {
+	return p.Status
+}
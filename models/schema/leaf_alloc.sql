@@ -0,0 +1,18 @@
+-- 号段模式 biz_tag 表,表名前缀见 DB_DEFAULT_TABLE_PREFIX
+CREATE TABLE IF NOT EXISTS `leaf_alloc` (
+  `biz_tag` VARCHAR(128) NOT NULL DEFAULT '',
+  `max_id` BIGINT(20) NOT NULL DEFAULT 0,
+  `step` INT(11) NOT NULL DEFAULT 0,
+  `description` VARCHAR(256) NOT NULL DEFAULT '',
+  `created_at` BIGINT(20) NOT NULL DEFAULT 0,
+  `deleted_at` BIGINT(20) NOT NULL DEFAULT 0,
+  `update_time` BIGINT(20) NOT NULL DEFAULT 0,
+  PRIMARY KEY (`biz_tag`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 从原版 Leaf 的表结构升级:号段缓存只加载 deleted_at=0 的 biz_tag,
+-- 原表没有 created_at/deleted_at 列,update_time 为 TIMESTAMP 类型,需要先迁移
+-- ALTER TABLE `leaf_alloc`
+--   ADD COLUMN `created_at` BIGINT(20) NOT NULL DEFAULT 0,
+--   ADD COLUMN `deleted_at` BIGINT(20) NOT NULL DEFAULT 0,
+--   MODIFY COLUMN `update_time` BIGINT(20) NOT NULL DEFAULT 0;
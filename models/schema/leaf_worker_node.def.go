@@ -0,0 +1,34 @@
+package schema
+
+import (
+	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/timeutil"
+)
+
+type LeafWorkerNode struct {
+	Id            int64  `xorm:"id BIGINT(20) notnull pk autoincr" db:"id" json:"id"`
+	Ip            string `xorm:"ip VARCHAR(64) notnull unique(uk_endpoint)" db:"ip" json:"ip"`
+	Port          string `xorm:"port VARCHAR(16) notnull unique(uk_endpoint)" db:"port" json:"port"`
+	WorkerId      int    `xorm:"worker_id INT(11) notnull unique(uk_worker_id)" db:"worker_id" json:"worker_id"`
+	LastTimestamp int64  `xorm:"last_timestamp BIGINT(20) notnull default 0" db:"last_timestamp" json:"last_timestamp"`
+	Heartbeat     int64  `xorm:"heartbeat BIGINT(20) notnull default 0" db:"heartbeat" json:"heartbeat"`
+	CreatedAt     int64  `xorm:"created_at BIGINT(20) notnull default 0" db:"created_at" json:"created,omitempty"`
+	UpdatedAt     int64  `xorm:"update_time BIGINT(20) notnull default 0" db:"updated_at" json:"updated_at"`
+}
+
+func (p *LeafWorkerNode) TableName() string {
+	prefix := conf.GetString("DB_DEFAULT_TABLE_PREFIX")
+	if len(prefix) > 0 {
+		return prefix + "_leaf_worker_node"
+	}
+	return "leaf_worker_node"
+}
+
+func (p *LeafWorkerNode) BeforeInsert() {
+	p.CreatedAt = timeutil.MsTimestampNow()
+	p.UpdatedAt = p.CreatedAt
+}
+
+func (p *LeafWorkerNode) BeforeUpdate() {
+	p.UpdatedAt = timeutil.MsTimestampNow()
+}
@@ -0,0 +1,15 @@
+-- snowflake mysql 模式(LEAF_SNOWFLAKE_HOLDER_FLAG=4)的 workerId 表,表名前缀见 DB_DEFAULT_TABLE_PREFIX
+-- last_timestamp 为节点本机时间(毫秒),heartbeat 为数据库时间(毫秒)
+CREATE TABLE IF NOT EXISTS `leaf_worker_node` (
+  `id` BIGINT(20) NOT NULL AUTO_INCREMENT,
+  `ip` VARCHAR(64) NOT NULL DEFAULT '',
+  `port` VARCHAR(16) NOT NULL DEFAULT '',
+  `worker_id` INT(11) NOT NULL DEFAULT 0,
+  `last_timestamp` BIGINT(20) NOT NULL DEFAULT 0,
+  `heartbeat` BIGINT(20) NOT NULL DEFAULT 0,
+  `created_at` BIGINT(20) NOT NULL DEFAULT 0,
+  `update_time` BIGINT(20) NOT NULL DEFAULT 0,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_endpoint` (`ip`, `port`),
+  UNIQUE KEY `uk_worker_id` (`worker_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
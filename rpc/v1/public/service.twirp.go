@@ -44,6 +44,12 @@ type Server interface {
 	Segment(context.Context, *common.SegmentKeyReq) (*common.Result, error)
 
 	Snowflake(context.Context, *common.SegmentKeyReq) (*common.Result, error)
+
+	// ULID,26 位 Crockford Base32 字符串,同一毫秒内单调递增
+	Ulid(context.Context, *common.SegmentKeyReq) (*common.StringResult, error)
+
+	// UUIDv7,同一毫秒内单调递增
+	UuidV7(context.Context, *common.SegmentKeyReq) (*common.StringResult, error)
 }
 
 // ======================
@@ -52,16 +58,18 @@ type Server interface {
 
 type serverProtobufClient struct {
 	client HTTPClient
-	urls   [2]string
+	urls   [4]string
 }
 
 // NewServerProtobufClient creates a Protobuf client that implements the Server interface.
 // It communicates using Protobuf and can be configured with a custom HTTPClient.
 func NewServerProtobufClient(addr string, client HTTPClient) Server {
 	prefix := urlBase(addr) + ServerPathPrefix
-	urls := [2]string{
+	urls := [4]string{
 		prefix + "Segment",
 		prefix + "Snowflake",
+		prefix + "Ulid",
+		prefix + "UuidV7",
 	}
 	if httpClient, ok := client.(*http.Client); ok {
 		return &serverProtobufClient{
@@ -99,22 +107,48 @@ func (c *serverProtobufClient) Snowflake(ctx context.Context, in *common.Segment
 	return out, nil
 }
 
+func (c *serverProtobufClient) Ulid(ctx context.Context, in *common.SegmentKeyReq) (*common.StringResult, error) {
+	ctx = ctxsetters.WithPackageName(ctx, "v1.public")
+	ctx = ctxsetters.WithServiceName(ctx, "Server")
+	ctx = ctxsetters.WithMethodName(ctx, "Ulid")
+	out := new(common.StringResult)
+	err := doProtobufRequest(ctx, c.client, c.urls[2], in, out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *serverProtobufClient) UuidV7(ctx context.Context, in *common.SegmentKeyReq) (*common.StringResult, error) {
+	ctx = ctxsetters.WithPackageName(ctx, "v1.public")
+	ctx = ctxsetters.WithServiceName(ctx, "Server")
+	ctx = ctxsetters.WithMethodName(ctx, "UuidV7")
+	out := new(common.StringResult)
+	err := doProtobufRequest(ctx, c.client, c.urls[3], in, out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ==================
 // Server JSON Client
 // ==================
 
 type serverJSONClient struct {
 	client HTTPClient
-	urls   [2]string
+	urls   [4]string
 }
 
 // NewServerJSONClient creates a JSON client that implements the Server interface.
 // It communicates using JSON and can be configured with a custom HTTPClient.
 func NewServerJSONClient(addr string, client HTTPClient) Server {
 	prefix := urlBase(addr) + ServerPathPrefix
-	urls := [2]string{
+	urls := [4]string{
 		prefix + "Segment",
 		prefix + "Snowflake",
+		prefix + "Ulid",
+		prefix + "UuidV7",
 	}
 	if httpClient, ok := client.(*http.Client); ok {
 		return &serverJSONClient{
@@ -152,6 +186,30 @@ func (c *serverJSONClient) Snowflake(ctx context.Context, in *common.SegmentKeyR
 	return out, nil
 }
 
+func (c *serverJSONClient) Ulid(ctx context.Context, in *common.SegmentKeyReq) (*common.StringResult, error) {
+	ctx = ctxsetters.WithPackageName(ctx, "v1.public")
+	ctx = ctxsetters.WithServiceName(ctx, "Server")
+	ctx = ctxsetters.WithMethodName(ctx, "Ulid")
+	out := new(common.StringResult)
+	err := doJSONRequest(ctx, c.client, c.urls[2], in, out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *serverJSONClient) UuidV7(ctx context.Context, in *common.SegmentKeyReq) (*common.StringResult, error) {
+	ctx = ctxsetters.WithPackageName(ctx, "v1.public")
+	ctx = ctxsetters.WithServiceName(ctx, "Server")
+	ctx = ctxsetters.WithMethodName(ctx, "UuidV7")
+	out := new(common.StringResult)
+	err := doJSONRequest(ctx, c.client, c.urls[3], in, out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // =====================
 // Server Server Handler
 // =====================
@@ -207,6 +265,12 @@ func (s *serverServer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	case "/leaf/v1.public.Server/Snowflake":
 		s.serveSnowflake(ctx, resp, req)
 		return
+	case "/leaf/v1.public.Server/Ulid":
+		s.serveUlid(ctx, resp, req)
+		return
+	case "/leaf/v1.public.Server/UuidV7":
+		s.serveUuidV7(ctx, resp, req)
+		return
 	default:
 		msg := fmt.Sprintf("no handler for path %q", req.URL.Path)
 		err = badRouteError(msg, req.Method, req.URL.Path)
@@ -787,6 +851,578 @@ func (s *serverServer) serveSnowflakeForm(ctx context.Context, resp http.Respons
 	callResponseSent(ctx, s.hooks)
 }
 
+func (s *serverServer) serveUlid(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+	header := req.Header.Get("Content-Type")
+	i := strings.Index(header, ";")
+	if i == -1 {
+		i = len(header)
+	}
+	switch strings.TrimSpace(strings.ToLower(header[:i])) {
+	case "application/json":
+		s.serveUlidJSON(ctx, resp, req)
+	case "application/protobuf":
+		s.serveUlidProtobuf(ctx, resp, req)
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		s.serveUlidForm(ctx, resp, req)
+	default:
+		if req.Method == "GET" {
+			s.serveUlidForm(ctx, resp, req)
+			return
+		}
+		msg := fmt.Sprintf("unexpected Content-Type: %q", req.Header.Get("Content-Type"))
+		twerr := badRouteError(msg, req.Method, req.URL.Path)
+		s.writeError(ctx, resp, twerr)
+	}
+}
+
+func (s *serverServer) serveUlidJSON(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+	var err error
+	ctx = ctxsetters.WithMethodName(ctx, "Ulid")
+	ctx, err = callRequestRouted(ctx, s.hooks)
+	if err != nil {
+		s.writeError(ctx, resp, err)
+		return
+	}
+
+	reqContent := new(common.SegmentKeyReq)
+	unmarshaler := jsonpb.Unmarshaler{AllowUnknownFields: true}
+	if err = unmarshaler.Unmarshal(req.Body, reqContent); err != nil {
+		err = wrapErr(err, "failed to parse request json")
+		twerr := twirp.NewError(twirp.InvalidArgument, err.Error())
+		twerr = twerr.WithMeta("cause", fmt.Sprintf("%T", err))
+		s.writeError(ctx, resp, twerr)
+		return
+	}
+
+	// Call service method
+	var respContent *common.StringResult
+	func() {
+		defer func() {
+			// In case of a panic, serve a 500 error and then panic.
+			if r := recover(); r != nil {
+				s.writeError(ctx, resp, twirp.InternalError("Internal service panic"))
+				panic(r)
+			}
+		}()
+		respContent, err = s.Server.Ulid(ctx, reqContent)
+	}()
+
+	if err != nil {
+		s.writeError(ctx, resp, err)
+		return
+	}
+	if respContent == nil {
+		s.writeError(ctx, resp, twirp.InternalError("received a nil *common.StringResult and nil error while calling Ulid. nil responses are not supported"))
+		return
+	}
+
+	ctx = ctxsetters.WithResponse(ctx, respContent)
+
+	ctx = callResponsePrepared(ctx, s.hooks)
+
+	type httpBody interface {
+		GetContentType() string
+		GetData() []byte
+	}
+
+	var respBytes []byte
+	var respStatus = http.StatusOK
+	if body, ok := interface{}(respContent).(httpBody); ok {
+		type httpStatus interface{ GetStatus() int32 }
+		if statusBody, ok := interface{}(respContent).(httpStatus); ok {
+			if status := statusBody.GetStatus(); status > 0 {
+				respStatus = int(status)
+			}
+		}
+		if contentType := body.GetContentType(); contentType != "" {
+			resp.Header().Set("Content-Type", contentType)
+		}
+		respBytes = body.GetData()
+	} else {
+		var buf bytes.Buffer
+		marshaler := &jsonpb.Marshaler{OrigName: true, EmitDefaults: true}
+		if err = marshaler.Marshal(&buf, respContent); err != nil {
+			err = wrapErr(err, "failed to marshal json response")
+			s.writeError(ctx, resp, twirp.InternalErrorWith(err))
+			return
+		}
+		respBytes = buf.Bytes()
+		resp.Header().Set("Content-Type", "application/json")
+	}
+
+	ctx = ctxsetters.WithStatusCode(ctx, respStatus)
+	resp.WriteHeader(respStatus)
+
+	if n, err := resp.Write(respBytes); err != nil {
+		msg := fmt.Sprintf("failed to write response, %d of %d bytes written: %s", n, len(respBytes), err.Error())
+		twerr := twirp.NewError(twirp.Unknown, msg)
+		callError(ctx, s.hooks, twerr)
+	}
+	callResponseSent(ctx, s.hooks)
+}
+
+func (s *serverServer) serveUlidProtobuf(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+	var err error
+	ctx = ctxsetters.WithMethodName(ctx, "Ulid")
+	ctx, err = callRequestRouted(ctx, s.hooks)
+	if err != nil {
+		s.writeError(ctx, resp, err)
+		return
+	}
+
+	buf, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		err = wrapErr(err, "failed to read request body")
+		s.writeError(ctx, resp, twirp.InternalErrorWith(err))
+		return
+	}
+	reqContent := new(common.SegmentKeyReq)
+	if err = proto.Unmarshal(buf, reqContent); err != nil {
+		err = wrapErr(err, "failed to parse request proto")
+		twerr := twirp.NewError(twirp.InvalidArgument, err.Error())
+		twerr = twerr.WithMeta("cause", fmt.Sprintf("%T", err))
+		s.writeError(ctx, resp, twerr)
+		return
+	}
+
+	// Call service method
+	var respContent *common.StringResult
+	func() {
+		defer func() {
+			// In case of a panic, serve a 500 error and then panic.
+			if r := recover(); r != nil {
+				s.writeError(ctx, resp, twirp.InternalError("Internal service panic"))
+				panic(r)
+			}
+		}()
+		respContent, err = s.Server.Ulid(ctx, reqContent)
+	}()
+
+	if err != nil {
+		s.writeError(ctx, resp, err)
+		return
+	}
+	if respContent == nil {
+		s.writeError(ctx, resp, twirp.InternalError("received a nil *common.StringResult and nil error while calling Ulid. nil responses are not supported"))
+		return
+	}
+
+	ctx = ctxsetters.WithResponse(ctx, respContent)
+
+	ctx = callResponsePrepared(ctx, s.hooks)
+
+	type httpBody interface {
+		GetContentType() string
+		GetData() []byte
+	}
+
+	var respBytes []byte
+	var respStatus = http.StatusOK
+	if body, ok := interface{}(respContent).(httpBody); ok {
+		type httpStatus interface{ GetStatus() int32 }
+		if statusBody, ok := interface{}(respContent).(httpStatus); ok {
+			if status := statusBody.GetStatus(); status > 0 {
+				respStatus = int(status)
+			}
+		}
+		if contentType := body.GetContentType(); contentType != "" {
+			resp.Header().Set("Content-Type", contentType)
+		}
+		respBytes = body.GetData()
+	} else {
+		respBytes, err = proto.Marshal(respContent)
+		if err != nil {
+			err = wrapErr(err, "failed to marshal proto response")
+			s.writeError(ctx, resp, twirp.InternalErrorWith(err))
+			return
+		}
+		resp.Header().Set("Content-Type", "application/protobuf")
+	}
+
+	ctx = ctxsetters.WithStatusCode(ctx, respStatus)
+	resp.WriteHeader(respStatus)
+	if n, err := resp.Write(respBytes); err != nil {
+		msg := fmt.Sprintf("failed to write response, %d of %d bytes written: %s", n, len(respBytes), err.Error())
+		twerr := twirp.NewError(twirp.Unknown, msg)
+		callError(ctx, s.hooks, twerr)
+	}
+	callResponseSent(ctx, s.hooks)
+}
+
+func (s *serverServer) serveUlidForm(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+	var err error
+	ctx = ctxsetters.WithMethodName(ctx, "Ulid")
+	ctx, err = callRequestRouted(ctx, s.hooks)
+	if err != nil {
+		s.writeError(ctx, resp, err)
+		return
+	}
+
+	err = req.ParseForm()
+	if err != nil {
+		s.writeError(ctx, resp, err)
+		return
+	}
+
+	reqContent := new(common.SegmentKeyReq)
+
+	if v, ok := req.Form["key"]; ok {
+		reqContent.Key = v[0]
+	}
+
+	// Call service method
+	var respContent *common.StringResult
+	func() {
+		defer func() {
+			// In case of a panic, serve a 500 error and then panic.
+			if r := recover(); r != nil {
+				s.writeError(ctx, resp, twirp.InternalError("Internal service panic"))
+				panic(r)
+			}
+		}()
+		respContent, err = s.Ulid(ctx, reqContent)
+	}()
+
+	if err != nil {
+		s.writeError(ctx, resp, err)
+		return
+	}
+	if respContent == nil {
+		s.writeError(ctx, resp, twirp.InternalError("received a nil *common.StringResult and nil error while calling Ulid. nil responses are not supported"))
+		return
+	}
+
+	ctx = ctxsetters.WithResponse(ctx, respContent)
+
+	ctx = callResponsePrepared(ctx, s.hooks)
+
+	type httpBody interface {
+		GetContentType() string
+		GetData() []byte
+	}
+
+	var respBytes []byte
+	var respStatus = http.StatusOK
+	if body, ok := interface{}(respContent).(httpBody); ok {
+		type httpStatus interface{ GetStatus() int32 }
+		if statusBody, ok := interface{}(respContent).(httpStatus); ok {
+			if status := statusBody.GetStatus(); status > 0 {
+				respStatus = int(status)
+			}
+		}
+		if contentType := body.GetContentType(); contentType != "" {
+			resp.Header().Set("Content-Type", contentType)
+		}
+		respBytes = body.GetData()
+	} else {
+		var buf bytes.Buffer
+		marshaler := &jsonpb.Marshaler{OrigName: true, EmitDefaults: true}
+		if err = marshaler.Marshal(&buf, respContent); err != nil {
+			err = wrapErr(err, "failed to marshal json response")
+			s.writeError(ctx, resp, twirp.InternalErrorWith(err))
+			return
+		}
+		respBytes = buf.Bytes()
+		resp.Header().Set("Content-Type", "application/json")
+	}
+
+	ctx = ctxsetters.WithStatusCode(ctx, respStatus)
+	resp.WriteHeader(respStatus)
+
+	if n, err := resp.Write(respBytes); err != nil {
+		msg := fmt.Sprintf("failed to write response, %d of %d bytes written: %s", n, len(respBytes), err.Error())
+		twerr := twirp.NewError(twirp.Unknown, msg)
+		callError(ctx, s.hooks, twerr)
+	}
+	callResponseSent(ctx, s.hooks)
+}
+
+func (s *serverServer) serveUuidV7(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+	header := req.Header.Get("Content-Type")
+	i := strings.Index(header, ";")
+	if i == -1 {
+		i = len(header)
+	}
+	switch strings.TrimSpace(strings.ToLower(header[:i])) {
+	case "application/json":
+		s.serveUuidV7JSON(ctx, resp, req)
+	case "application/protobuf":
+		s.serveUuidV7Protobuf(ctx, resp, req)
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		s.serveUuidV7Form(ctx, resp, req)
+	default:
+		if req.Method == "GET" {
+			s.serveUuidV7Form(ctx, resp, req)
+			return
+		}
+		msg := fmt.Sprintf("unexpected Content-Type: %q", req.Header.Get("Content-Type"))
+		twerr := badRouteError(msg, req.Method, req.URL.Path)
+		s.writeError(ctx, resp, twerr)
+	}
+}
+
+func (s *serverServer) serveUuidV7JSON(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+	var err error
+	ctx = ctxsetters.WithMethodName(ctx, "UuidV7")
+	ctx, err = callRequestRouted(ctx, s.hooks)
+	if err != nil {
+		s.writeError(ctx, resp, err)
+		return
+	}
+
+	reqContent := new(common.SegmentKeyReq)
+	unmarshaler := jsonpb.Unmarshaler{AllowUnknownFields: true}
+	if err = unmarshaler.Unmarshal(req.Body, reqContent); err != nil {
+		err = wrapErr(err, "failed to parse request json")
+		twerr := twirp.NewError(twirp.InvalidArgument, err.Error())
+		twerr = twerr.WithMeta("cause", fmt.Sprintf("%T", err))
+		s.writeError(ctx, resp, twerr)
+		return
+	}
+
+	// Call service method
+	var respContent *common.StringResult
+	func() {
+		defer func() {
+			// In case of a panic, serve a 500 error and then panic.
+			if r := recover(); r != nil {
+				s.writeError(ctx, resp, twirp.InternalError("Internal service panic"))
+				panic(r)
+			}
+		}()
+		respContent, err = s.Server.UuidV7(ctx, reqContent)
+	}()
+
+	if err != nil {
+		s.writeError(ctx, resp, err)
+		return
+	}
+	if respContent == nil {
+		s.writeError(ctx, resp, twirp.InternalError("received a nil *common.StringResult and nil error while calling UuidV7. nil responses are not supported"))
+		return
+	}
+
+	ctx = ctxsetters.WithResponse(ctx, respContent)
+
+	ctx = callResponsePrepared(ctx, s.hooks)
+
+	type httpBody interface {
+		GetContentType() string
+		GetData() []byte
+	}
+
+	var respBytes []byte
+	var respStatus = http.StatusOK
+	if body, ok := interface{}(respContent).(httpBody); ok {
+		type httpStatus interface{ GetStatus() int32 }
+		if statusBody, ok := interface{}(respContent).(httpStatus); ok {
+			if status := statusBody.GetStatus(); status > 0 {
+				respStatus = int(status)
+			}
+		}
+		if contentType := body.GetContentType(); contentType != "" {
+			resp.Header().Set("Content-Type", contentType)
+		}
+		respBytes = body.GetData()
+	} else {
+		var buf bytes.Buffer
+		marshaler := &jsonpb.Marshaler{OrigName: true, EmitDefaults: true}
+		if err = marshaler.Marshal(&buf, respContent); err != nil {
+			err = wrapErr(err, "failed to marshal json response")
+			s.writeError(ctx, resp, twirp.InternalErrorWith(err))
+			return
+		}
+		respBytes = buf.Bytes()
+		resp.Header().Set("Content-Type", "application/json")
+	}
+
+	ctx = ctxsetters.WithStatusCode(ctx, respStatus)
+	resp.WriteHeader(respStatus)
+
+	if n, err := resp.Write(respBytes); err != nil {
+		msg := fmt.Sprintf("failed to write response, %d of %d bytes written: %s", n, len(respBytes), err.Error())
+		twerr := twirp.NewError(twirp.Unknown, msg)
+		callError(ctx, s.hooks, twerr)
+	}
+	callResponseSent(ctx, s.hooks)
+}
+
+func (s *serverServer) serveUuidV7Protobuf(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+	var err error
+	ctx = ctxsetters.WithMethodName(ctx, "UuidV7")
+	ctx, err = callRequestRouted(ctx, s.hooks)
+	if err != nil {
+		s.writeError(ctx, resp, err)
+		return
+	}
+
+	buf, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		err = wrapErr(err, "failed to read request body")
+		s.writeError(ctx, resp, twirp.InternalErrorWith(err))
+		return
+	}
+	reqContent := new(common.SegmentKeyReq)
+	if err = proto.Unmarshal(buf, reqContent); err != nil {
+		err = wrapErr(err, "failed to parse request proto")
+		twerr := twirp.NewError(twirp.InvalidArgument, err.Error())
+		twerr = twerr.WithMeta("cause", fmt.Sprintf("%T", err))
+		s.writeError(ctx, resp, twerr)
+		return
+	}
+
+	// Call service method
+	var respContent *common.StringResult
+	func() {
+		defer func() {
+			// In case of a panic, serve a 500 error and then panic.
+			if r := recover(); r != nil {
+				s.writeError(ctx, resp, twirp.InternalError("Internal service panic"))
+				panic(r)
+			}
+		}()
+		respContent, err = s.Server.UuidV7(ctx, reqContent)
+	}()
+
+	if err != nil {
+		s.writeError(ctx, resp, err)
+		return
+	}
+	if respContent == nil {
+		s.writeError(ctx, resp, twirp.InternalError("received a nil *common.StringResult and nil error while calling UuidV7. nil responses are not supported"))
+		return
+	}
+
+	ctx = ctxsetters.WithResponse(ctx, respContent)
+
+	ctx = callResponsePrepared(ctx, s.hooks)
+
+	type httpBody interface {
+		GetContentType() string
+		GetData() []byte
+	}
+
+	var respBytes []byte
+	var respStatus = http.StatusOK
+	if body, ok := interface{}(respContent).(httpBody); ok {
+		type httpStatus interface{ GetStatus() int32 }
+		if statusBody, ok := interface{}(respContent).(httpStatus); ok {
+			if status := statusBody.GetStatus(); status > 0 {
+				respStatus = int(status)
+			}
+		}
+		if contentType := body.GetContentType(); contentType != "" {
+			resp.Header().Set("Content-Type", contentType)
+		}
+		respBytes = body.GetData()
+	} else {
+		respBytes, err = proto.Marshal(respContent)
+		if err != nil {
+			err = wrapErr(err, "failed to marshal proto response")
+			s.writeError(ctx, resp, twirp.InternalErrorWith(err))
+			return
+		}
+		resp.Header().Set("Content-Type", "application/protobuf")
+	}
+
+	ctx = ctxsetters.WithStatusCode(ctx, respStatus)
+	resp.WriteHeader(respStatus)
+	if n, err := resp.Write(respBytes); err != nil {
+		msg := fmt.Sprintf("failed to write response, %d of %d bytes written: %s", n, len(respBytes), err.Error())
+		twerr := twirp.NewError(twirp.Unknown, msg)
+		callError(ctx, s.hooks, twerr)
+	}
+	callResponseSent(ctx, s.hooks)
+}
+
+func (s *serverServer) serveUuidV7Form(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+	var err error
+	ctx = ctxsetters.WithMethodName(ctx, "UuidV7")
+	ctx, err = callRequestRouted(ctx, s.hooks)
+	if err != nil {
+		s.writeError(ctx, resp, err)
+		return
+	}
+
+	err = req.ParseForm()
+	if err != nil {
+		s.writeError(ctx, resp, err)
+		return
+	}
+
+	reqContent := new(common.SegmentKeyReq)
+
+	if v, ok := req.Form["key"]; ok {
+		reqContent.Key = v[0]
+	}
+
+	// Call service method
+	var respContent *common.StringResult
+	func() {
+		defer func() {
+			// In case of a panic, serve a 500 error and then panic.
+			if r := recover(); r != nil {
+				s.writeError(ctx, resp, twirp.InternalError("Internal service panic"))
+				panic(r)
+			}
+		}()
+		respContent, err = s.UuidV7(ctx, reqContent)
+	}()
+
+	if err != nil {
+		s.writeError(ctx, resp, err)
+		return
+	}
+	if respContent == nil {
+		s.writeError(ctx, resp, twirp.InternalError("received a nil *common.StringResult and nil error while calling UuidV7. nil responses are not supported"))
+		return
+	}
+
+	ctx = ctxsetters.WithResponse(ctx, respContent)
+
+	ctx = callResponsePrepared(ctx, s.hooks)
+
+	type httpBody interface {
+		GetContentType() string
+		GetData() []byte
+	}
+
+	var respBytes []byte
+	var respStatus = http.StatusOK
+	if body, ok := interface{}(respContent).(httpBody); ok {
+		type httpStatus interface{ GetStatus() int32 }
+		if statusBody, ok := interface{}(respContent).(httpStatus); ok {
+			if status := statusBody.GetStatus(); status > 0 {
+				respStatus = int(status)
+			}
+		}
+		if contentType := body.GetContentType(); contentType != "" {
+			resp.Header().Set("Content-Type", contentType)
+		}
+		respBytes = body.GetData()
+	} else {
+		var buf bytes.Buffer
+		marshaler := &jsonpb.Marshaler{OrigName: true, EmitDefaults: true}
+		if err = marshaler.Marshal(&buf, respContent); err != nil {
+			err = wrapErr(err, "failed to marshal json response")
+			s.writeError(ctx, resp, twirp.InternalErrorWith(err))
+			return
+		}
+		respBytes = buf.Bytes()
+		resp.Header().Set("Content-Type", "application/json")
+	}
+
+	ctx = ctxsetters.WithStatusCode(ctx, respStatus)
+	resp.WriteHeader(respStatus)
+
+	if n, err := resp.Write(respBytes); err != nil {
+		msg := fmt.Sprintf("failed to write response, %d of %d bytes written: %s", n, len(respBytes), err.Error())
+		twerr := twirp.NewError(twirp.Unknown, msg)
+		callError(ctx, s.hooks, twerr)
+	}
+	callResponseSent(ctx, s.hooks)
+}
+
 func (s *serverServer) ServiceDescriptor() ([]byte, int) {
 	return twirpFileDescriptor0, 0
 }
@@ -1216,14 +1852,16 @@ func callError(ctx context.Context, h *twirp.ServerHooks, err twirp.Error) conte
 }
 
 var twirpFileDescriptor0 = []byte{
-	// 141 bytes of a gzipped FileDescriptorProto
+	// 170 bytes of a gzipped FileDescriptorProto
 	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0x2f, 0x33, 0xd4, 0x2f,
 	0x28, 0x4d, 0xca, 0xc9, 0x4c, 0xd6, 0x2f, 0x4e, 0x2d, 0x2a, 0xcb, 0x4c, 0x4e, 0xd5, 0x2b, 0x28,
 	0xca, 0x2f, 0xc9, 0x17, 0xe2, 0x2c, 0x33, 0xd4, 0x83, 0x48, 0x48, 0x09, 0x27, 0xe7, 0xe7, 0xe6,
-	0xe6, 0xe7, 0xe9, 0x43, 0x28, 0x88, 0xbc, 0x51, 0x1e, 0x17, 0x5b, 0x70, 0x6a, 0x51, 0x59, 0x6a,
-	0x91, 0x90, 0x01, 0x17, 0x7b, 0x70, 0x6a, 0x7a, 0x6e, 0x6a, 0x5e, 0x89, 0x90, 0xa8, 0x1e, 0x54,
-	0x0d, 0x54, 0xc0, 0x3b, 0xb5, 0x32, 0x28, 0xb5, 0x50, 0x8a, 0x0f, 0x26, 0x1c, 0x94, 0x5a, 0x5c,
-	0x9a, 0x53, 0x22, 0x64, 0xc4, 0xc5, 0x19, 0x9c, 0x97, 0x5f, 0x9e, 0x96, 0x93, 0x98, 0x9d, 0x4a,
-	0xa4, 0x1e, 0x27, 0xde, 0x28, 0x6e, 0x3d, 0x7d, 0xb8, 0x63, 0x93, 0xd8, 0xc0, 0xae, 0x30, 0x06,
-	0x04, 0x00, 0x00, 0xff, 0xff, 0xf8, 0xd7, 0xc4, 0xc3, 0xc0, 0x00, 0x00, 0x00,
+	0xe6, 0xe7, 0xe9, 0x43, 0x28, 0x88, 0xbc, 0xd1, 0x2d, 0x46, 0x2e, 0xb6, 0xe0, 0xd4, 0xa2, 0xb2,
+	0xd4, 0x22, 0x21, 0x03, 0x2e, 0xf6, 0xe0, 0xd4, 0xf4, 0xdc, 0xd4, 0xbc, 0x12, 0x21, 0x51, 0x3d,
+	0xa8, 0x22, 0xa8, 0x80, 0x77, 0x6a, 0x65, 0x50, 0x6a, 0xa1, 0x14, 0x1f, 0x4c, 0x38, 0x28, 0xb5,
+	0xb8, 0x34, 0xa7, 0x44, 0xc8, 0x88, 0x8b, 0x33, 0x38, 0x2f, 0xbf, 0x3c, 0x2d, 0x27, 0x31, 0x3b,
+	0x95, 0x58, 0x3d, 0xc6, 0x5c, 0x2c, 0xa1, 0x39, 0x99, 0x29, 0xb8, 0x94, 0x8b, 0xc0, 0x85, 0x4b,
+	0x8a, 0x32, 0xf3, 0xd2, 0xa1, 0x9a, 0x4c, 0xb9, 0xd8, 0x42, 0x4b, 0x33, 0x53, 0xc2, 0xcc, 0x49,
+	0xd2, 0xe6, 0xc4, 0x1b, 0xc5, 0xad, 0xa7, 0x0f, 0x0f, 0x99, 0x24, 0x36, 0xb0, 0x97, 0x8d, 0x01,
+	0x03, 0x00, 0xf1, 0x34, 0x59, 0x4b, 0x2d, 0x01, 0x00, 0x00,
 }
@@ -0,0 +1,200 @@
+// Package mcserver 以 memcached 文本协议提供发号服务,任意语言的 memcached 客户端都可以直接取号
+package mcserver
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/busyfree/leaf-go/server/tcpserver"
+	"github.com/busyfree/leaf-go/service"
+	"github.com/busyfree/leaf-go/util/metrics"
+)
+
+const (
+	// SnowflakeKey get snowflake 使用 snowflake 发号,snowflake:<key> 与 snowflake 接口传入 key 的效果一致
+	SnowflakeKey = tcpserver.SnowflakeKey
+	// memcached 协议规定 key 最长 250 字节
+	maxKeyLength  = 250
+	maxLineLength = 4096
+)
+
+// Server 支持 get/gets <tag>*(每个 tag 返回一个 ID,发号失败或被限流的 tag 视为未命中)、
+// incr <tag> <delta>(返回一个 ID,delta 只做格式校验)、version 和 quit,
+// 存储类命令读取数据块后返回 NOT_STORED,ID 不可写入
+type Server struct {
+	*tcpserver.Server
+	idleTimeout time.Duration
+}
+
+func NewServer(segment *service.SegmentIDGenImpl, snowflake *service.SnowFlakeIdGenImpl, idleTimeout time.Duration) *Server {
+	s := new(Server)
+	s.Server = tcpserver.NewServer("memcached", segment, snowflake, s.serveConn)
+	s.idleTimeout = idleTimeout
+	return s
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	r := bufio.NewReaderSize(conn, maxLineLength)
+	w := bufio.NewWriter(conn)
+	ctx := context.Background()
+	for {
+		if s.idleTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+		}
+		line, err := r.ReadSlice('\n')
+		if err != nil {
+			if err == bufio.ErrBufferFull {
+				_, _ = w.WriteString("CLIENT_ERROR line too long\r\n")
+				_ = w.Flush()
+			}
+			return
+		}
+		fields := strings.Fields(string(line))
+		if len(fields) == 0 {
+			_, _ = w.WriteString("ERROR\r\n")
+		} else if quit := s.handle(ctx, r, w, fields); quit {
+			_ = w.Flush()
+			return
+		}
+		// 客户端流水线发送的命令处理完再一起写回
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) handle(ctx context.Context, r *bufio.Reader, w *bufio.Writer, fields []string) (quit bool) {
+	cmd := strings.ToLower(fields[0])
+	start := time.Now()
+	status := "ok"
+	defer func() {
+		metrics.MemcachedDurationsSeconds.WithLabelValues(
+			cmd,
+			status,
+		).Observe(time.Since(start).Seconds())
+	}()
+	switch cmd {
+	case "get", "gets":
+		if len(fields) < 2 {
+			status = "error"
+			_, _ = w.WriteString("ERROR\r\n")
+			return
+		}
+		// 同一个 tag 出现多次时合并发号,按 ID 个数占用限流配额
+		keys := fields[1:]
+		counts := make(map[string]int, len(keys))
+		for _, key := range keys {
+			if len(key) > maxKeyLength {
+				status = "error"
+				_, _ = w.WriteString("CLIENT_ERROR bad command line format\r\n")
+				return
+			}
+			counts[key]++
+		}
+		ids := make(map[string][]int64, len(counts))
+		for _, key := range keys {
+			if _, ok := ids[key]; ok {
+				continue
+			}
+			got, limited := s.NextIds(ctx, key, counts[key])
+			if limited {
+				status = "limited"
+			}
+			ids[key] = got
+		}
+		for _, key := range keys {
+			if len(ids[key]) == 0 {
+				// 被限流或发号失败的 tag 视为未命中
+				if status == "ok" {
+					status = "fail"
+				}
+				continue
+			}
+			value := strconv.FormatInt(ids[key][0], 10)
+			ids[key] = ids[key][1:]
+			_, _ = w.WriteString("VALUE " + key + " 0 " + strconv.Itoa(len(value)))
+			if cmd == "gets" {
+				// cas 值对 ID 没有意义,固定为 0
+				_, _ = w.WriteString(" 0")
+			}
+			_, _ = w.WriteString("\r\n" + value + "\r\n")
+		}
+		_, _ = w.WriteString("END\r\n")
+	case "incr":
+		if len(fields) < 3 || len(fields[1]) > maxKeyLength {
+			status = "error"
+			_, _ = w.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return
+		}
+		if _, err := strconv.ParseUint(fields[2], 10, 64); err != nil {
+			status = "error"
+			_, _ = w.WriteString("CLIENT_ERROR invalid numeric delta argument\r\n")
+			return
+		}
+		ids, limited := s.NextIds(ctx, fields[1], 1)
+		switch {
+		case limited:
+			status = "limited"
+		case len(ids) == 0:
+			status = "fail"
+		}
+		if isNoReply(fields, 3) {
+			return
+		}
+		if limited {
+			_, _ = w.WriteString("SERVER_ERROR too many requests\r\n")
+			return
+		}
+		if len(ids) == 0 {
+			_, _ = w.WriteString("NOT_FOUND\r\n")
+			return
+		}
+		_, _ = w.WriteString(strconv.FormatInt(ids[0], 10) + "\r\n")
+	case "set", "add", "replace", "append", "prepend", "cas":
+		// <cmd> <key> <flags> <exptime> <bytes> [cas] [noreply]
+		status = "error"
+		if len(fields) < 5 {
+			_, _ = w.WriteString("ERROR\r\n")
+			return
+		}
+		n, err := strconv.Atoi(fields[4])
+		if err != nil || n < 0 {
+			_, _ = w.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return
+		}
+		if _, err := io.CopyN(io.Discard, r, int64(n)+2); err != nil {
+			return true
+		}
+		noReplyPos := 5
+		if cmd == "cas" {
+			noReplyPos = 6
+		}
+		if !isNoReply(fields, noReplyPos) {
+			_, _ = w.WriteString("NOT_STORED\r\n")
+		}
+	case "delete", "decr", "touch":
+		status = "error"
+		_, _ = w.WriteString("CLIENT_ERROR ids are read only\r\n")
+	case "version":
+		_, _ = w.WriteString("VERSION leaf-go\r\n")
+	case "quit":
+		return true
+	default:
+		// 未知命令统一计入一个标签,避免任意命令名撑爆指标
+		cmd = "unknown"
+		status = "error"
+		_, _ = w.WriteString("ERROR\r\n")
+	}
+	return
+}
+
+func isNoReply(fields []string, pos int) bool {
+	return len(fields) > pos && fields[pos] == "noreply"
+}
@@ -0,0 +1,96 @@
+package mcserver
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/busyfree/leaf-go/service"
+	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/mc"
+)
+
+// startServer 使用本地 workerId 的 snowflake 启动服务,测试只使用 snowflake key,不依赖号段数据库
+func startServer(t *testing.T) string {
+	conf.Set("LEAF_SNOWFLAKE_HOLDER_FLAG", "0")
+	conf.Set("LEAF_SNOWFLAKE_WORKER_ID", "1")
+	snowflake := service.NewSnowFlakeIdGenImpl(8080, 1288834974657)
+	s := NewServer(nil, snowflake, 0)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	t.Cleanup(func() {
+		_ = s.Close()
+		_ = snowflake.Close()
+	})
+	return ln.Addr().String()
+}
+
+func TestServerCommands(t *testing.T) {
+	addr := startServer(t)
+	conf.Set("MC_mc_test_HOSTS", addr)
+	conf.Set("MC_mc_test_INIT_CONNS", "1")
+	conf.Set("MC_mc_test_MAX_IDLE_CONNS", "2")
+	ctx := context.Background()
+	c := mc.Get(ctx, "mc_test")
+
+	item, err := c.Get(ctx, "snowflake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := item.ParseInt(10, 64)
+	if err != nil || first <= 0 {
+		t.Fatalf("get snowflake = %s, %v", item.Value, err)
+	}
+	items, err := c.GetMulti(ctx, []string{"snowflake:order", "snowflake:pay"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("get multi returned %d items, want 2", len(items))
+	}
+	id, err := c.Increment(ctx, "snowflake", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(id) <= first {
+		t.Fatalf("incr returned %d, want greater than %d", id, first)
+	}
+	if err = c.Set(ctx, &mc.Item{Key: "snowflake", Value: []byte("1")}); err == nil {
+		t.Fatal("set should be rejected")
+	}
+}
+
+func TestServerRejectsWrites(t *testing.T) {
+	addr := startServer(t)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	_, _ = conn.Write([]byte("set snowflake 0 0 1\r\n1\r\ndelete snowflake\r\nincr snowflake x\r\n"))
+	for _, want := range []string{
+		"NOT_STORED\r\n",
+		"CLIENT_ERROR ids are read only\r\n",
+		"CLIENT_ERROR invalid numeric delta argument\r\n",
+	} {
+		if line, _ := r.ReadString('\n'); line != want {
+			t.Fatalf("reply = %q, want %q", line, want)
+		}
+	}
+	_, _ = conn.Write([]byte("gets snowflake\r\n"))
+	line, _ := r.ReadString('\n')
+	if len(line) < len("VALUE snowflake 0 ") || line[:len("VALUE snowflake 0 ")] != "VALUE snowflake 0 " {
+		t.Fatalf("gets reply = %q", line)
+	}
+	value, _ := r.ReadString('\n')
+	if _, err := strconv.ParseInt(value[:len(value)-2], 10, 64); err != nil {
+		t.Fatalf("gets value = %q", value)
+	}
+}
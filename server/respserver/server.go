@@ -0,0 +1,251 @@
+// Package respserver 以 Redis RESP 协议提供发号服务,任意 Redis 客户端都可以直接取号
+package respserver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/busyfree/leaf-go/server/tcpserver"
+	"github.com/busyfree/leaf-go/service"
+	"github.com/busyfree/leaf-go/util/metrics"
+)
+
+const (
+	// SnowflakeKey key 为 snowflake 时使用 snowflake 发号,snowflake:<key> 与 snowflake 接口传入 key 的效果一致
+	SnowflakeKey = tcpserver.SnowflakeKey
+	// 单个命令最多的参数个数和单个参数的最大长度,防止恶意请求占用内存
+	maxArgs      = 16
+	maxArgLength = 512
+)
+
+var errProtocol = errors.New("ERR Protocol error")
+
+// errLimited 被限流时返回的错误,与 key 不存在的 nil 区分开
+const errLimited = "ERR too many requests"
+
+// Server 支持 GET <tag>、INCR <tag>、INCRBY <tag> <n> 返回下一个 ID,IDS <tag> <n> 返回 n 个 ID 的数组,
+// 另外支持 PING、ECHO、SELECT、QUIT 以兼容常见客户端的建连和探活
+type Server struct {
+	*tcpserver.Server
+	idleTimeout time.Duration
+	maxBatch    int
+}
+
+func NewServer(segment *service.SegmentIDGenImpl, snowflake *service.SnowFlakeIdGenImpl, idleTimeout time.Duration, maxBatch int) *Server {
+	s := new(Server)
+	s.Server = tcpserver.NewServer("resp", segment, snowflake, s.serveConn)
+	s.idleTimeout = idleTimeout
+	s.maxBatch = maxBatch
+	if s.maxBatch <= 0 {
+		s.maxBatch = 1000
+	}
+	return s
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	ctx := context.Background()
+	for {
+		if s.idleTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+		}
+		args, err := readCommand(r)
+		if err != nil {
+			if err == errProtocol {
+				writeError(w, err.Error())
+				_ = w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if quit := s.handle(ctx, w, args); quit {
+			_ = w.Flush()
+			return
+		}
+		// 客户端流水线发送的命令处理完再一起写回
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) handle(ctx context.Context, w *bufio.Writer, args []string) (quit bool) {
+	cmd := strings.ToUpper(args[0])
+	start := time.Now()
+	status := "ok"
+	defer func() {
+		metrics.RESPDurationsSeconds.WithLabelValues(
+			cmd,
+			status,
+		).Observe(time.Since(start).Seconds())
+	}()
+	switch cmd {
+	case "GET", "INCR", "INCRBY":
+		argc := 2
+		if cmd == "INCRBY" {
+			argc = 3
+		}
+		if len(args) != argc {
+			status = "error"
+			writeError(w, "ERR wrong number of arguments for '"+strings.ToLower(cmd)+"' command")
+			return
+		}
+		// INCRBY 的增量只做格式校验,每次都只返回下一个 ID
+		if cmd == "INCRBY" {
+			if _, err := strconv.ParseInt(args[2], 10, 64); err != nil {
+				status = "error"
+				writeError(w, "ERR value is not an integer or out of range")
+				return
+			}
+		}
+		ids, limited := s.NextIds(ctx, args[1], 1)
+		if limited {
+			status = "limited"
+			writeError(w, errLimited)
+			return
+		}
+		if len(ids) == 0 {
+			status = "fail"
+			if cmd == "GET" {
+				// 与 key 不存在一致,返回 nil
+				_, _ = w.WriteString("$-1\r\n")
+			} else {
+				writeError(w, "ERR id generate failed")
+			}
+			return
+		}
+		if cmd == "GET" {
+			writeBulk(w, strconv.FormatInt(ids[0], 10))
+		} else {
+			writeInteger(w, ids[0])
+		}
+	case "IDS":
+		if len(args) != 3 {
+			status = "error"
+			writeError(w, "ERR wrong number of arguments for 'ids' command")
+			return
+		}
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n <= 0 || n > s.maxBatch {
+			status = "error"
+			writeError(w, "ERR count must be in [1,"+strconv.Itoa(s.maxBatch)+"]")
+			return
+		}
+		ids, limited := s.NextIds(ctx, args[1], n)
+		if limited {
+			status = "limited"
+			writeError(w, errLimited)
+			return
+		}
+		if len(ids) == 0 {
+			status = "fail"
+			writeError(w, "ERR id generate failed")
+			return
+		}
+		// 中途发号失败时返回已取到的 ID,数组长度可能小于 n
+		_, _ = w.WriteString("*" + strconv.Itoa(len(ids)) + "\r\n")
+		for _, id := range ids {
+			writeInteger(w, id)
+		}
+	case "PING":
+		if len(args) > 1 {
+			writeBulk(w, args[1])
+		} else {
+			_, _ = w.WriteString("+PONG\r\n")
+		}
+	case "ECHO":
+		if len(args) != 2 {
+			status = "error"
+			writeError(w, "ERR wrong number of arguments for 'echo' command")
+			return
+		}
+		writeBulk(w, args[1])
+	case "SELECT":
+		// 只有一个 db,客户端按配置切库时直接返回成功
+		_, _ = w.WriteString("+OK\r\n")
+	case "QUIT":
+		_, _ = w.WriteString("+OK\r\n")
+		return true
+	default:
+		// 未知命令统一计入一个标签,避免任意命令名撑爆指标
+		cmd = "UNKNOWN"
+		status = "error"
+		writeError(w, "ERR unknown command")
+	}
+	return
+}
+
+// readCommand 读取一条命令,支持 RESP 数组和 redis-cli 使用的 inline 格式
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > maxArgs {
+		return nil, errProtocol
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err = readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errProtocol
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxArgLength {
+			return nil, errProtocol
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, errProtocol
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		if err == bufio.ErrBufferFull {
+			return "", errProtocol
+		}
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+func writeError(w *bufio.Writer, msg string) {
+	_, _ = w.WriteString("-" + msg + "\r\n")
+}
+
+func writeBulk(w *bufio.Writer, v string) {
+	_, _ = w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")
+}
+
+func writeInteger(w *bufio.Writer, v int64) {
+	_, _ = w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+}
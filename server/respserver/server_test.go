@@ -0,0 +1,92 @@
+package respserver
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/busyfree/leaf-go/service"
+	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/redis"
+)
+
+// startServer 使用本地 workerId 的 snowflake 启动服务,测试只使用 snowflake key,不依赖号段数据库
+func startServer(t *testing.T) string {
+	conf.Set("LEAF_SNOWFLAKE_HOLDER_FLAG", "0")
+	conf.Set("LEAF_SNOWFLAKE_WORKER_ID", "1")
+	snowflake := service.NewSnowFlakeIdGenImpl(8080, 1288834974657)
+	s := NewServer(nil, snowflake, 0, 10)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	t.Cleanup(func() {
+		_ = s.Close()
+		_ = snowflake.Close()
+	})
+	return ln.Addr().String()
+}
+
+func TestServerCommands(t *testing.T) {
+	addr := startServer(t)
+	conf.Set("REDIS_resp_test_HOST", addr)
+	conf.Set("REDIS_resp_test_MAX_CONNS", "2")
+	ctx := context.Background()
+	r := redis.Get(ctx, "resp_test")
+
+	item, err := r.Get(ctx, "snowflake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := strconv.ParseInt(string(item.Value), 10, 64)
+	if err != nil || first <= 0 {
+		t.Fatalf("get snowflake = %s, %v", item.Value, err)
+	}
+	second, err := r.IncrBy(ctx, "snowflake:order", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second <= first {
+		t.Fatalf("incrby returned %d, want greater than %d", second, first)
+	}
+}
+
+func TestServerIdsAndProtocolError(t *testing.T) {
+	addr := startServer(t)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	_, _ = conn.Write([]byte("*3\r\n$3\r\nIDS\r\n$9\r\nsnowflake\r\n$1\r\n3\r\n"))
+	if line, _ := r.ReadString('\n'); line != "*3\r\n" {
+		t.Fatalf("ids reply = %q", line)
+	}
+	var last int64
+	for i := 0; i < 3; i++ {
+		line, _ := r.ReadString('\n')
+		id, err := strconv.ParseInt(line[1:len(line)-2], 10, 64)
+		if err != nil || id <= last {
+			t.Fatalf("ids element %q is not increasing", line)
+		}
+		last = id
+	}
+	_, _ = conn.Write([]byte("IDS snowflake 11\r\n"))
+	if line, _ := r.ReadString('\n'); line != "-ERR count must be in [1,10]\r\n" {
+		t.Fatalf("ids over max batch reply = %q", line)
+	}
+
+	// 负数长度的数组返回协议错误并断开连接,不能 panic
+	_, _ = conn.Write([]byte("*-1\r\n"))
+	if line, _ := r.ReadString('\n'); line != "-ERR Protocol error\r\n" {
+		t.Fatalf("negative array reply = %q", line)
+	}
+	if _, err := r.ReadString('\n'); err == nil {
+		t.Fatal("connection should be closed after protocol error")
+	}
+}
@@ -1,13 +1,27 @@
 package serverv1
 
-import "github.com/busyfree/leaf-go/service"
+import (
+	"context"
+
+	"github.com/busyfree/leaf-go/models"
+	"github.com/busyfree/leaf-go/service"
+)
+
+// idGen 数字 ID 发号接口,由 SegmentIDGenImpl 和 SnowFlakeIdGenImpl 实现
+type idGen interface {
+	Get(ctx context.Context, key string) models.Result
+}
 
 var (
-	segmentService   *service.SegmentIDGenImpl
-	snowflakeService *service.SnowFlakeIdGenImpl
+	segmentService   idGen
+	snowflakeService idGen
+	ulidService      *service.UlidIdGenImpl
+	uuidV7Service    *service.UuidV7IdGenImpl
 )
 
-func Init(segment *service.SegmentIDGenImpl, snowflake *service.SnowFlakeIdGenImpl) {
+func Init(segment *service.SegmentIDGenImpl, snowflake *service.SnowFlakeIdGenImpl, ulid *service.UlidIdGenImpl, uuidV7 *service.UuidV7IdGenImpl) {
 	segmentService = segment
 	snowflakeService = snowflake
+	ulidService = ulid
+	uuidV7Service = uuidV7
 }
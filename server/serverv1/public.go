@@ -3,40 +3,80 @@ package serverv1
 import (
 	"context"
 
-	sentinel "github.com/alibaba/sentinel-golang/api"
-	"github.com/alibaba/sentinel-golang/core/base"
-
+	"github.com/busyfree/leaf-go/models"
 	"github.com/busyfree/leaf-go/rpc/common"
-	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/service"
+	"github.com/busyfree/leaf-go/util/auth"
+	"github.com/busyfree/leaf-go/util/errors"
+	"github.com/busyfree/leaf-go/util/limiter"
 )
 
 type Public struct{}
 
+// guard 检查调用方的 tag 权限以及调用方、biz tag 和接口 res 的限流规则后执行 gen,
+// gen 返回的 error 计入熔断统计,被拒绝时返回拒绝原因和 false
+func guard(ctx context.Context, res, key string, gen func() error) (string, bool) {
+	if !auth.AllowTag(ctx, key) {
+		return errors.PermissionDeniedError.Msg(), false
+	}
+	exit, ok := limiter.Entry(ctx, res, key, 1)
+	if !ok {
+		return "服务超载", false
+	}
+	var genErr error
+	defer func() { exit(genErr) }()
+	genErr = gen()
+	return "", true
+}
+
+// fillResult 发号成功时才返回 Status_Success,失败时 Id 为异常码,Msg 为异常原因
+func fillResult(resp *common.Result, key string, r models.Result) error {
+	resp.Id = r.Id
+	if r.Status != models.SUCCESS {
+		resp.Status = common.Status_Status_Exception
+		resp.Msg = exceptionMsg(r.Id)
+		return errors.Errorf("generate id error code %d", r.Id)
+	}
+	service.EncodeResult(key, &r)
+	resp.Code = r.Code
+	resp.Status = common.Status_Status_Success
+	resp.Msg = "ok"
+	return nil
+}
+
+// exceptionMsg 发号异常码对应的原因
+func exceptionMsg(code int64) string {
+	switch code {
+	case int64(models.EXCEPTION_ID_KEY_NOT_EXISTS):
+		return "tag not found"
+	case int64(models.EXCEPTION_ID_IDCACHE_INIT_FALSE):
+		return "id cache not ready"
+	case int64(models.EXCEPTION_ID_CLOCK_SKEW):
+		return "clock skew detected"
+	case int64(models.EXCEPTION_ID_SEQUENCE_OVERFLOW):
+		return "sequence overflow, retry later"
+	case int64(models.EXCEPTION_ID_WORKER_ID_LOST):
+		return "workerId is no longer held by this node"
+	default:
+		return "id generate failed"
+	}
+}
+
 func (s *Public) Segment(ctx context.Context, req *common.SegmentKeyReq) (*common.Result, error) {
 	var (
 		resp = &common.Result{Id: 0, Status: common.Status_Status_Exception, Msg: "error"}
+		key  = req.GetKey()
 	)
-	qpsMaps := conf.GetStrMapStr("SENTINEL_RES_QPS")
-	if _, ok := qpsMaps["api_segment"]; ok {
-		// Entry 方法用于埋点
-		option := sentinel.WithTrafficType(base.Inbound)
-		e, b := sentinel.Entry("api_segment", option)
-		if b != nil {
-			resp.Msg = "服务超载"
-			return resp, nil
+	msg, ok := guard(ctx, "api_segment", key, func() error {
+		if len(key) == 0 {
+			resp.Msg = "missing key"
+			return nil
 		}
-		defer e.Exit()
+		return fillResult(resp, key, segmentService.Get(ctx, key))
+	})
+	if !ok {
+		resp.Msg = msg
 	}
-
-	key := req.GetKey()
-	if len(key) == 0 {
-		resp.Msg = "missing key"
-		return resp, nil
-	}
-	r := segmentService.Get(ctx, key)
-	resp.Id = r.Id
-	resp.Status = common.Status_Status_Success
-	resp.Msg = "ok"
 	return resp, nil
 }
 
@@ -44,20 +84,53 @@ func (s *Public) Snowflake(ctx context.Context, req *common.SegmentKeyReq) (*com
 	var (
 		resp = &common.Result{Id: 0, Status: common.Status_Status_Exception}
 	)
-	qpsMaps := conf.GetStrMapStr("SENTINEL_RES_QPS")
-	if _, ok := qpsMaps["api_snowflake"]; ok {
-		// Entry 方法用于埋点
-		option := sentinel.WithTrafficType(base.Inbound)
-		e, b := sentinel.Entry("honda_accord_api_wxlogin", option)
-		if b != nil {
-			resp.Msg = "服务超载"
-			return resp, nil
+	msg, ok := guard(ctx, "api_snowflake", req.GetKey(), func() error {
+		return fillResult(resp, req.GetKey(), snowflakeService.Get(ctx, req.GetKey()))
+	})
+	if !ok {
+		resp.Msg = msg
+	}
+	return resp, nil
+}
+
+func (s *Public) Ulid(ctx context.Context, req *common.SegmentKeyReq) (*common.StringResult, error) {
+	var (
+		resp = &common.StringResult{Status: common.Status_Status_Exception}
+	)
+	msg, ok := guard(ctx, "api_ulid", req.GetKey(), func() error {
+		r := ulidService.GetString(ctx, req.GetKey())
+		if r.Status != models.SUCCESS {
+			resp.Msg = "error"
+			return errors.Errorf("generate id error")
 		}
-		defer e.Exit()
+		resp.Id = r.Id
+		resp.Status = common.Status_Status_Success
+		resp.Msg = "ok"
+		return nil
+	})
+	if !ok {
+		resp.Msg = msg
+	}
+	return resp, nil
+}
+
+func (s *Public) UuidV7(ctx context.Context, req *common.SegmentKeyReq) (*common.StringResult, error) {
+	var (
+		resp = &common.StringResult{Status: common.Status_Status_Exception}
+	)
+	msg, ok := guard(ctx, "api_uuidv7", req.GetKey(), func() error {
+		r := uuidV7Service.GetString(ctx, req.GetKey())
+		if r.Status != models.SUCCESS {
+			resp.Msg = "error"
+			return errors.Errorf("generate id error")
+		}
+		resp.Id = r.Id
+		resp.Status = common.Status_Status_Success
+		resp.Msg = "ok"
+		return nil
+	})
+	if !ok {
+		resp.Msg = msg
 	}
-	r := snowflakeService.Get(ctx, req.GetKey())
-	resp.Id = r.Id
-	resp.Status = common.Status_Status_Success
-	resp.Msg = "ok"
 	return resp, nil
 }
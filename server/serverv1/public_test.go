@@ -0,0 +1,95 @@
+package serverv1
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/busyfree/leaf-go/models"
+	"github.com/busyfree/leaf-go/rpc/common"
+	"github.com/busyfree/leaf-go/rpc/v1/public"
+)
+
+// stubGen 固定返回 r 的发号器
+type stubGen struct {
+	r models.Result
+}
+
+func (s stubGen) Get(ctx context.Context, key string) models.Result {
+	return s.r
+}
+
+func newTestClient(t *testing.T) public.ServerClient {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	public.RegisterServerServer(server, &Public{})
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return public.NewServerClient(conn)
+}
+
+func TestSnowflakeFailureOverGrpc(t *testing.T) {
+	old := snowflakeService
+	t.Cleanup(func() { snowflakeService = old })
+	client := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cases := []struct {
+		code int64
+		msg  string
+	}{
+		{models.EXCEPTION_ID_CLOCK_SKEW, "clock skew detected"},
+		{models.EXCEPTION_ID_SEQUENCE_OVERFLOW, "sequence overflow, retry later"},
+		{models.EXCEPTION_ID_WORKER_ID_LOST, "workerId is no longer held by this node"},
+	}
+	for _, c := range cases {
+		snowflakeService = stubGen{r: models.NewResult(c.code, models.EXCEPTION)}
+		resp, err := client.Snowflake(ctx, &common.SegmentKeyReq{Key: "k"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.GetStatus() != common.Status_Status_Exception || resp.GetId() != c.code || resp.GetMsg() != c.msg {
+			t.Fatalf("code %d: got status %v id %d msg %q", c.code, resp.GetStatus(), resp.GetId(), resp.GetMsg())
+		}
+	}
+
+	snowflakeService = stubGen{r: models.NewResult(42, models.SUCCESS)}
+	resp, err := client.Snowflake(ctx, &common.SegmentKeyReq{Key: "k"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetStatus() != common.Status_Status_Success || resp.GetId() != 42 || resp.GetMsg() != "ok" {
+		t.Fatalf("got status %v id %d msg %q", resp.GetStatus(), resp.GetId(), resp.GetMsg())
+	}
+}
+
+func TestSegmentFailureOverGrpc(t *testing.T) {
+	old := segmentService
+	t.Cleanup(func() { segmentService = old })
+	client := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	segmentService = stubGen{r: models.NewResult(models.EXCEPTION_ID_TWO_SEGMENTS_ARE_NULL, models.EXCEPTION)}
+	resp, err := client.Segment(ctx, &common.SegmentKeyReq{Key: "k"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetStatus() != common.Status_Status_Exception || resp.GetId() != models.EXCEPTION_ID_TWO_SEGMENTS_ARE_NULL {
+		t.Fatalf("got status %v id %d msg %q", resp.GetStatus(), resp.GetId(), resp.GetMsg())
+	}
+}
@@ -0,0 +1,143 @@
+// Package tcpserver 文本协议发号服务共用的监听、连接管理和取号逻辑,respserver 和 mcserver 只需实现协议解析
+package tcpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/busyfree/leaf-go/models"
+	"github.com/busyfree/leaf-go/service"
+	"github.com/busyfree/leaf-go/util/limiter"
+	"github.com/busyfree/leaf-go/util/log"
+)
+
+// SnowflakeKey key 为 snowflake 时使用 snowflake 发号,snowflake:<key> 与 snowflake 接口传入 key 的效果一致
+const SnowflakeKey = "snowflake"
+
+var logger = log.Get(context.Background())
+
+// Server 接受连接并交给 handler 处理,handler 返回或 panic 后关闭连接
+type Server struct {
+	name      string
+	segment   *service.SegmentIDGenImpl
+	snowflake *service.SnowFlakeIdGenImpl
+	handler   func(conn net.Conn)
+	ln        net.Listener
+	conns     map[net.Conn]struct{}
+	closed    bool
+	mu        sync.Mutex
+	wg        sync.WaitGroup
+}
+
+// NewServer name 用于日志区分协议
+func NewServer(name string, segment *service.SegmentIDGenImpl, snowflake *service.SnowFlakeIdGenImpl, handler func(conn net.Conn)) *Server {
+	s := new(Server)
+	s.name = name
+	s.segment = segment
+	s.snowflake = snowflake
+	s.handler = handler
+	s.conns = make(map[net.Conn]struct{})
+	return s
+}
+
+// Serve 阻塞直到 Close 被调用
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	s.ln = ln
+	s.mu.Unlock()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Close 关闭监听和所有连接,等待处理中的命令结束
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.ln != nil {
+		err = s.ln.Close()
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			logger.Errorf("%s conn-{%s} panic:%v", s.name, conn.RemoteAddr(), rec)
+		}
+		_ = conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+	s.handler(conn)
+}
+
+// NextIds 为 key 发 n 个 ID,key 为 snowflake 或 snowflake:<key> 时使用 snowflake 发号,其余按 biz tag 使用号段发号。
+// 与 http 接口共用 api_snowflake、api_segment 和 biz tag 的限流规则,按 ID 个数占用配额,被限流时 limited 为 true;
+// 中途发号失败时返回已取到的 ID
+func (s *Server) NextIds(ctx context.Context, key string, n int) (ids []int64, limited bool) {
+	res, tag := "api_segment", key
+	isSnowflake := key == SnowflakeKey || strings.HasPrefix(key, SnowflakeKey+":")
+	if isSnowflake {
+		res, tag = "api_snowflake", strings.TrimPrefix(strings.TrimPrefix(key, SnowflakeKey), ":")
+	}
+	exit, ok := limiter.Entry(ctx, res, tag, n)
+	if !ok {
+		return nil, true
+	}
+	var genErr error
+	defer func() { exit(genErr) }()
+	ids = make([]int64, 0, n)
+	for i := 0; i < n; i++ {
+		var r models.Result
+		if isSnowflake {
+			r = s.snowflake.Get(ctx, tag)
+		} else {
+			r = s.segment.Get(ctx, key)
+		}
+		if r.Status != models.SUCCESS {
+			logger.Infof("%s get key-{%s} error code-{%d}", s.name, key, r.Id)
+			genErr = fmt.Errorf("generate id error code %d", r.Id)
+			break
+		}
+		ids = append(ids, r.Id)
+	}
+	return ids, false
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/busyfree/leaf-go/dao"
 	"github.com/busyfree/leaf-go/models"
+	"github.com/busyfree/leaf-go/service"
 )
 
 type MonitorController struct{}
@@ -50,8 +51,21 @@ func (c *MonitorController) DB(ctx *gin.Context) {
 	return
 }
 
+// DecodeCode 解码 segment/snowflake 接口返回的 code,encoding 为空时使用 tag 配置的编码方式
+func (c *MonitorController) DecodeCode(ctx *gin.Context) {
+	tag := ctx.Query("tag")
+	id, encoding, err := service.DecodeCode(tag, ctx.Query("encoding"), ctx.Param("code"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(200, gin.H{"id": id, "tag": tag, "encoding": encoding})
+	return
+}
+
 func (c *MonitorController) Decode(ctx *gin.Context) {
-	out := snowflakeService.DecodeSnowflakeId(ctx.Param("key"))
+	// format=jssafe|cached|sonyflake 按对应格式解析,namespace 指定按哪个 namespace 的布局解析
+	out := snowflakeService.DecodeSnowflakeId(ctx.Param("key"), ctx.Query("namespace"), ctx.Query("format"))
 	ctx.JSON(200, out)
 	return
 }
@@ -0,0 +1,103 @@
+package acp
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/alibaba/sentinel-golang/core/circuitbreaker"
+	"github.com/alibaba/sentinel-golang/core/flow"
+	"github.com/gin-gonic/gin"
+
+	"github.com/busyfree/leaf-go/util/limiter"
+)
+
+// SentinelController 运行时维护 sentinel flow 和熔断规则,请求体为 sentinel 规则的 JSON 格式,
+// 修改后立即生效并保存到 SENTINEL_RULES_FILE,配置文件变更时重新加载
+type SentinelController struct{}
+
+// Rules 配置中的规则只读,flow 和 circuitBreaker 为可修改的规则
+func (c *SentinelController) Rules(ctx *gin.Context) {
+	configRules, err := limiter.ConfigRules()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	managed := limiter.ManagedRules()
+	ctx.JSON(200, gin.H{
+		"config":         configRules,
+		"flow":           managed.Flow,
+		"circuitBreaker": managed.CircuitBreaker,
+	})
+	return
+}
+
+func (c *SentinelController) AddFlow(ctx *gin.Context) {
+	rule := new(flow.Rule)
+	if err := ctx.ShouldBindJSON(rule); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule.ID = ""
+	rule, err := limiter.SaveFlowRule(rule)
+	writeRuleResult(ctx, rule, err)
+	return
+}
+
+func (c *SentinelController) UpdateFlow(ctx *gin.Context) {
+	rule := new(flow.Rule)
+	if err := ctx.ShouldBindJSON(rule); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule.ID = ctx.Param("id")
+	rule, err := limiter.SaveFlowRule(rule)
+	writeRuleResult(ctx, rule, err)
+	return
+}
+
+func (c *SentinelController) DeleteFlow(ctx *gin.Context) {
+	writeRuleResult(ctx, gin.H{"id": ctx.Param("id")}, limiter.DeleteFlowRule(ctx.Param("id")))
+	return
+}
+
+func (c *SentinelController) AddCircuitBreaker(ctx *gin.Context) {
+	rule := new(circuitbreaker.Rule)
+	if err := ctx.ShouldBindJSON(rule); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule.Id = ""
+	rule, err := limiter.SaveCircuitBreakerRule(rule)
+	writeRuleResult(ctx, rule, err)
+	return
+}
+
+func (c *SentinelController) UpdateCircuitBreaker(ctx *gin.Context) {
+	rule := new(circuitbreaker.Rule)
+	if err := ctx.ShouldBindJSON(rule); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule.Id = ctx.Param("id")
+	rule, err := limiter.SaveCircuitBreakerRule(rule)
+	writeRuleResult(ctx, rule, err)
+	return
+}
+
+func (c *SentinelController) DeleteCircuitBreaker(ctx *gin.Context) {
+	writeRuleResult(ctx, gin.H{"id": ctx.Param("id")}, limiter.DeleteCircuitBreakerRule(ctx.Param("id")))
+	return
+}
+
+func writeRuleResult(ctx *gin.Context, data interface{}, err error) {
+	switch {
+	case err == nil:
+		ctx.JSON(200, data)
+	case errors.Is(err, limiter.ErrInvalidRule):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, limiter.ErrRuleNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,14 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+type FormattedController struct{}
+
+func (c *FormattedController) Get(ctx *gin.Context) {
+	key := ctx.Param("key")
+	r := formattedService.GetString(ctx, key)
+	ctx.JSON(200, r)
+	return
+}
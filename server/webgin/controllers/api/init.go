@@ -7,9 +7,15 @@ import (
 var (
 	segmentService   *service.SegmentIDGenImpl
 	snowflakeService *service.SnowFlakeIdGenImpl
+	ulidService      *service.UlidIdGenImpl
+	uuidV7Service    *service.UuidV7IdGenImpl
+	formattedService *service.FormattedIdGenImpl
 )
 
-func Init(s *service.SegmentIDGenImpl, snowflake *service.SnowFlakeIdGenImpl) {
+func Init(s *service.SegmentIDGenImpl, snowflake *service.SnowFlakeIdGenImpl, ulid *service.UlidIdGenImpl, uuidV7 *service.UuidV7IdGenImpl, formatted *service.FormattedIdGenImpl) {
 	segmentService = s
 	snowflakeService = snowflake
+	ulidService = ulid
+	uuidV7Service = uuidV7
+	formattedService = formatted
 }
@@ -2,6 +2,8 @@ package api
 
 import (
 	"github.com/gin-gonic/gin"
+
+	"github.com/busyfree/leaf-go/service"
 )
 
 type SegmentController struct{}
@@ -9,6 +11,7 @@ type SegmentController struct{}
 func (c *SegmentController) Get(ctx *gin.Context) {
 	key := ctx.Param("key")
 	r := segmentService.Get(ctx, key)
+	service.EncodeResult(key, &r)
 	ctx.JSON(200, r)
 	return
 }
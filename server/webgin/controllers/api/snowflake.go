@@ -2,6 +2,8 @@ package api
 
 import (
 	"github.com/gin-gonic/gin"
+
+	"github.com/busyfree/leaf-go/service"
 )
 
 type SnowFlakeController struct{}
@@ -9,6 +11,16 @@ type SnowFlakeController struct{}
 func (c *SnowFlakeController) Get(ctx *gin.Context) {
 	key := ctx.Param("key")
 	r := snowflakeService.Get(ctx, key)
+	service.EncodeResult(key, &r)
+	ctx.JSON(200, r)
+	return
+}
+
+// GetJsSafe 不论 key 是否配置,都返回小于 2^53 的 ID
+func (c *SnowFlakeController) GetJsSafe(ctx *gin.Context) {
+	key := ctx.Param("key")
+	r := snowflakeService.GetJsSafe(ctx, key)
+	service.EncodeResult(key, &r)
 	ctx.JSON(200, r)
 	return
 }
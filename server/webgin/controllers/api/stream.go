@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+
+	"github.com/busyfree/leaf-go/models"
+	"github.com/busyfree/leaf-go/service"
+	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/errors"
+	"github.com/busyfree/leaf-go/util/limiter"
+	"github.com/busyfree/leaf-go/util/log"
+)
+
+// streamRetryInterval 流式发号中途被限流时重新申请配额的间隔
+const streamRetryInterval = 50 * time.Millisecond
+
+type StreamController struct{}
+
+// Segment 以 NDJSON 流式返回 n 个号段 ID
+func (c *StreamController) Segment(ctx *gin.Context) {
+	c.stream(ctx, segmentService.Get)
+}
+
+// Snowflake 以 NDJSON 流式返回 n 个 snowflake ID
+func (c *StreamController) Snowflake(ctx *gin.Context) {
+	c.stream(ctx, snowflakeService.Get)
+}
+
+// stream 每行一个 models.Result,每批 LEAF_STREAM_BATCH_SIZE 个 ID 刷新一次,
+// 客户端读取慢时写入阻塞,不会继续发号;发满 n 个、发号失败或客户端断开时结束。
+// 每批发号前按本批 ID 个数占用 api_stream 的限流配额,第一批被限流时返回 429,
+// 之后被限流时等待配额,不会提前结束
+func (c *StreamController) stream(ctx *gin.Context, get func(ctx context.Context, key string) models.Result) {
+	key := ctx.Param("key")
+	n := cast.ToInt64(ctx.Query("n"))
+	maxIds := conf.GetInt64("LEAF_STREAM_MAX_IDS")
+	if maxIds <= 0 {
+		maxIds = 10000000
+	}
+	if n <= 0 || n > maxIds {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "n must be in [1," + cast.ToString(maxIds) + "]"})
+		return
+	}
+	batchSize := conf.GetInt64("LEAF_STREAM_BATCH_SIZE")
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	reqCtx := ctx.Request.Context()
+	var sent int64
+	nextBatch := func() int64 {
+		if n-sent < batchSize {
+			return n - sent
+		}
+		return batchSize
+	}
+	exit, ok := acquire(reqCtx, key, nextBatch(), false)
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"code": string(errors.TooManyRequestError.Code()), "msg": errors.TooManyRequestError.Msg()})
+		return
+	}
+	ctx.Header("Content-Type", "application/x-ndjson")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Stream(func(w io.Writer) bool {
+		if exit == nil {
+			if exit, ok = acquire(reqCtx, key, nextBatch(), true); !ok {
+				return false
+			}
+		}
+		var genErr error
+		defer func() {
+			exit(genErr)
+			exit = nil
+		}()
+		bw := bufio.NewWriter(w)
+		enc := json.NewEncoder(bw)
+		for i, size := int64(0), nextBatch(); i < size; i++ {
+			if reqCtx.Err() != nil {
+				return false
+			}
+			r := get(reqCtx, key)
+			service.EncodeResult(key, &r)
+			if err := enc.Encode(r); err != nil {
+				return false
+			}
+			if r.Status != models.SUCCESS {
+				genErr = errors.Errorf("generate id error code %d", r.Id)
+				_ = bw.Flush()
+				return false
+			}
+			sent++
+		}
+		if err := bw.Flush(); err != nil {
+			return false
+		}
+		return sent < n
+	})
+	if exit != nil {
+		exit()
+	}
+	log.Get(reqCtx).Infof("stream key-{%s} sent-{%d} of n-{%d}", key, sent, n)
+	return
+}
+
+// acquire 为 count 个 ID 占用 api_stream、biz tag 和调用方的限流配额,
+// wait 为 true 时被限流后等待重试,直到拿到配额或请求结束
+func acquire(ctx context.Context, key string, count int64, wait bool) (func(errs ...error), bool) {
+	for {
+		exit, ok := limiter.Entry(ctx, "api_stream", key, int(count))
+		if ok || !wait {
+			return exit, ok
+		}
+		select {
+		case <-ctx.Done():
+			return exit, false
+		case <-time.After(streamRetryInterval):
+		}
+	}
+}
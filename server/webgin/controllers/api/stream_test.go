@@ -0,0 +1,82 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sentinel "github.com/alibaba/sentinel-golang/api"
+	"github.com/gin-gonic/gin"
+
+	"github.com/busyfree/leaf-go/models"
+	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/limiter"
+)
+
+func TestStreamLimitPerBatch(t *testing.T) {
+	if err := sentinel.InitDefault(); err != nil {
+		t.Fatal(err)
+	}
+	conf.Set("SENTINEL_RULES_FILE", filepath.Join(t.TempDir(), "sentinel_rules.json"))
+	// 每次运行使用不同的 tag,避免 -count 多次运行时共用上一次的统计窗口
+	key := fmt.Sprintf("stream%d", time.Now().UnixNano())
+	conf.Set("SENTINEL_TAG_QPS", fmt.Sprintf(`{"%s": "10"}`, key))
+	conf.Set("LEAF_STREAM_BATCH_SIZE", "4")
+	defer func() {
+		conf.Set("SENTINEL_TAG_QPS", "{}")
+		conf.Set("LEAF_STREAM_BATCH_SIZE", "1000")
+		limiter.Load()
+	}()
+	if err := limiter.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	var id int64
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/stream/:key", func(ctx *gin.Context) {
+		new(StreamController).stream(ctx, func(ctx context.Context, key string) models.Result {
+			id++
+			return models.NewResult(id, models.SUCCESS)
+		})
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	// n 超过每秒配额时按批等待配额,不会一次占用 n 个配额被拒绝,也不会提前结束
+	start := time.Now()
+	resp, err := http.Get(srv.URL + "/stream/" + key + "?n=20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := 0
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		lines++
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || lines != 20 {
+		t.Fatalf("got status %d with %d lines", resp.StatusCode, lines)
+	}
+	if time.Since(start) < 500*time.Millisecond {
+		t.Fatal("stream should wait for quota between batches")
+	}
+
+	// 配额用完后新的流在第一批就被拒绝
+	for i := 0; i < 3; i++ {
+		resp, err = http.Get(srv.URL + "/stream/" + key + "?n=4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return
+		}
+	}
+	t.Fatal("new stream should be rejected when quota is used up")
+}
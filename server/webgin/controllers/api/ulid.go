@@ -0,0 +1,14 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+type UlidController struct{}
+
+func (c *UlidController) Get(ctx *gin.Context) {
+	key := ctx.Param("key")
+	r := ulidService.GetString(ctx, key)
+	ctx.JSON(200, r)
+	return
+}
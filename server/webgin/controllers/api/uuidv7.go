@@ -0,0 +1,14 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+type UuidV7Controller struct{}
+
+func (c *UuidV7Controller) Get(ctx *gin.Context) {
+	key := ctx.Param("key")
+	r := uuidV7Service.GetString(ctx, key)
+	ctx.JSON(200, r)
+	return
+}
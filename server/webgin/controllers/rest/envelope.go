@@ -0,0 +1,87 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/busyfree/leaf-go/models"
+)
+
+// 错误信封中的错误码
+const (
+	ErrInvalidTag       = "INVALID_TAG"
+	ErrInvalidCount     = "INVALID_COUNT"
+	ErrInvalidEncoding  = "INVALID_ENCODING"
+	ErrTagNotFound      = "TAG_NOT_FOUND"
+	ErrNotReady         = "NOT_READY"
+	ErrClockSkew        = "CLOCK_SKEW"
+	ErrSequenceOverflow = "SEQUENCE_OVERFLOW"
+	ErrWorkerIdLost     = "WORKER_ID_LOST"
+	ErrUnavailable      = "UNAVAILABLE"
+	ErrUnauthenticated  = "UNAUTHENTICATED"
+	ErrPermissionDenied = "PERMISSION_DENIED"
+	ErrRateLimited      = "RESOURCE_EXHAUSTED"
+)
+
+// Error 错误详情
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ErrorEnvelope 所有失败响应的格式
+type ErrorEnvelope struct {
+	Error Error `json:"error"`
+}
+
+// DataEnvelope 所有成功响应的格式
+type DataEnvelope struct {
+	Data interface{} `json:"data"`
+}
+
+// IdBatch 数字 ID,指定了编码方式或 tag 配置了编码方式时 codes 与 ids 一一对应
+type IdBatch struct {
+	Tag      string   `json:"tag"`
+	Ids      []int64  `json:"ids"`
+	Encoding string   `json:"encoding,omitempty"`
+	Codes    []string `json:"codes,omitempty"`
+}
+
+// StringIdBatch 字符串 ID
+type StringIdBatch struct {
+	Tag string   `json:"tag"`
+	Ids []string `json:"ids"`
+}
+
+func abort(ctx *gin.Context, status int, code, message string) {
+	ctx.AbortWithStatusJSON(status, ErrorEnvelope{Error: Error{Code: code, Message: message}})
+}
+
+// Deny 鉴权或限流失败时按错误信封返回,code 为 twirp 错误码,用作 middlewares 的 deny
+func Deny(ctx *gin.Context, status int, code, msg string) {
+	abort(ctx, status, strings.ToUpper(code), msg)
+}
+
+func writeData(ctx *gin.Context, data interface{}) {
+	ctx.JSON(http.StatusOK, DataEnvelope{Data: data})
+}
+
+// abortResult 把发号失败的异常码转换为 HTTP 状态码和错误码
+func abortResult(ctx *gin.Context, r models.Result) {
+	switch r.Id {
+	case int64(models.EXCEPTION_ID_KEY_NOT_EXISTS):
+		abort(ctx, http.StatusNotFound, ErrTagNotFound, "tag not found")
+	case int64(models.EXCEPTION_ID_IDCACHE_INIT_FALSE):
+		abort(ctx, http.StatusServiceUnavailable, ErrNotReady, "id cache not ready")
+	case int64(models.EXCEPTION_ID_CLOCK_SKEW):
+		abort(ctx, http.StatusServiceUnavailable, ErrClockSkew, "clock skew detected")
+	case int64(models.EXCEPTION_ID_SEQUENCE_OVERFLOW):
+		abort(ctx, http.StatusServiceUnavailable, ErrSequenceOverflow, "sequence overflow, retry later")
+	case int64(models.EXCEPTION_ID_WORKER_ID_LOST):
+		abort(ctx, http.StatusServiceUnavailable, ErrWorkerIdLost, "workerId is no longer held by this node")
+	default:
+		abort(ctx, http.StatusServiceUnavailable, ErrUnavailable, "id generate failed")
+	}
+}
@@ -0,0 +1,190 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/busyfree/leaf-go/models"
+	"github.com/busyfree/leaf-go/server/webgin/middlewares"
+	"github.com/busyfree/leaf-go/service"
+	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/idcodec"
+)
+
+// tagPattern 与 leaf_alloc.biz_tag VARCHAR(128) 一致,只允许字母数字开头,后续可包含 _ . : -
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:-]{0,127}$`)
+
+// Route 一个发号接口,同时用于注册路由和生成 OpenAPI 文档,保证两者一致
+type Route struct {
+	Path        string
+	OperationId string
+	Summary     string
+	// Numeric 返回 IdBatch 并支持 encoding 参数,否则返回 StringIdBatch
+	Numeric bool
+	// Resource sentinel 接口资源名,与 v1 和 twirp 接口共用限流规则
+	Resource string
+	handler  gin.HandlerFunc
+}
+
+func routes() []Route {
+	return []Route{
+		{
+			Path:        "/segment/:tag",
+			Resource:    "api_segment",
+			OperationId: "getSegmentIds",
+			Summary:     "号段模式 ID,tag 需在 leaf_alloc 中存在",
+			Numeric:     true,
+			handler: numericHandler(func(ctx context.Context, tag string) models.Result {
+				return segmentService.Get(ctx, tag)
+			}),
+		},
+		{
+			Path:        "/snowflake/:tag",
+			Resource:    "api_snowflake",
+			OperationId: "getSnowflakeIds",
+			Summary:     "snowflake ID,tag 对应 namespace、jssafe、cached 或 sonyflake 配置",
+			Numeric:     true,
+			handler: numericHandler(func(ctx context.Context, tag string) models.Result {
+				return snowflakeService.Get(ctx, tag)
+			}),
+		},
+		{
+			Path:        "/ulid/:tag",
+			Resource:    "api_ulid",
+			OperationId: "getUlids",
+			Summary:     "ULID,26 位 Crockford Base32 字符串",
+			handler: stringHandler(func(ctx context.Context, tag string) models.StringResult {
+				return ulidService.GetString(ctx, tag)
+			}, nil),
+		},
+		{
+			Path:        "/uuidv7/:tag",
+			Resource:    "api_uuidv7",
+			OperationId: "getUuidV7s",
+			Summary:     "UUIDv7",
+			handler: stringHandler(func(ctx context.Context, tag string) models.StringResult {
+				return uuidV7Service.GetString(ctx, tag)
+			}, nil),
+		},
+		{
+			Path:        "/formatted/:tag",
+			Resource:    "api_formatted",
+			OperationId: "getFormattedIds",
+			Summary:     "格式化业务 ID,tag 需在 [LEAF_ID_FORMAT] 中配置",
+			handler: stringHandler(func(ctx context.Context, tag string) models.StringResult {
+				return formattedService.GetString(ctx, tag)
+			}, func(tag string) bool {
+				return formattedService.HasTag(tag)
+			}),
+		},
+	}
+}
+
+// Register 在 group 下注册发号接口和 /openapi.json,发号接口经过 auth,文档不需要鉴权
+func Register(group *gin.RouterGroup, auth gin.HandlerFunc) {
+	rs := routes()
+	authed := group.Group("", auth)
+	for _, r := range rs {
+		authed.GET(r.Path, middlewares.Sentinel(r.Resource, "count", Deny), r.handler)
+	}
+	spec := buildOpenAPI(group.BasePath(), rs)
+	group.GET("/openapi.json", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, spec)
+	})
+}
+
+func maxCount() int {
+	n := conf.GetInt("LEAF_REST_MAX_COUNT")
+	if n <= 0 {
+		n = 1000
+	}
+	return n
+}
+
+// parseRequest 校验 tag 和 count,失败时已写入错误响应
+func parseRequest(ctx *gin.Context) (tag string, count int, ok bool) {
+	tag = ctx.Param("tag")
+	if !tagPattern.MatchString(tag) {
+		abort(ctx, http.StatusBadRequest, ErrInvalidTag, "tag must match "+tagPattern.String())
+		return
+	}
+	count = 1
+	if v := ctx.Query("count"); len(v) > 0 {
+		var err error
+		count, err = strconv.Atoi(v)
+		if err != nil || count <= 0 || count > maxCount() {
+			abort(ctx, http.StatusBadRequest, ErrInvalidCount, "count must be in [1,"+strconv.Itoa(maxCount())+"]")
+			return
+		}
+	}
+	return tag, count, true
+}
+
+func numericHandler(get func(ctx context.Context, tag string) models.Result) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		tag, count, ok := parseRequest(ctx)
+		if !ok {
+			return
+		}
+		encoding := ctx.Query("encoding")
+		if len(encoding) > 0 && !idcodec.IsValidEncoding(encoding) {
+			abort(ctx, http.StatusBadRequest, ErrInvalidEncoding, "encoding must be one of base62, base32, obfuscate")
+			return
+		}
+		if len(encoding) == 0 {
+			encoding = service.TagEncoding(tag)
+		} else if err := service.CheckEncoding(tag, encoding); err != nil {
+			abort(ctx, http.StatusBadRequest, ErrInvalidEncoding, err.Error())
+			return
+		}
+		batch := IdBatch{Tag: tag, Ids: make([]int64, 0, count), Encoding: encoding}
+		for i := 0; i < count; i++ {
+			r := get(ctx, tag)
+			if r.Status != models.SUCCESS {
+				abortResult(ctx, r)
+				return
+			}
+			batch.Ids = append(batch.Ids, r.Id)
+		}
+		if len(encoding) > 0 {
+			batch.Codes = make([]string, 0, count)
+			for _, id := range batch.Ids {
+				code, err := service.EncodeId(tag, encoding, id)
+				if err != nil {
+					abort(ctx, http.StatusInternalServerError, ErrUnavailable, err.Error())
+					return
+				}
+				batch.Codes = append(batch.Codes, code)
+			}
+		}
+		writeData(ctx, batch)
+	}
+}
+
+// stringHandler exists 不为空时先检查 tag 是否已配置
+func stringHandler(get func(ctx context.Context, tag string) models.StringResult, exists func(tag string) bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		tag, count, ok := parseRequest(ctx)
+		if !ok {
+			return
+		}
+		if exists != nil && !exists(tag) {
+			abort(ctx, http.StatusNotFound, ErrTagNotFound, "tag not found")
+			return
+		}
+		batch := StringIdBatch{Tag: tag, Ids: make([]string, 0, count)}
+		for i := 0; i < count; i++ {
+			r := get(ctx, tag)
+			if r.Status != models.SUCCESS {
+				abort(ctx, http.StatusServiceUnavailable, ErrUnavailable, "id generate failed")
+				return
+			}
+			batch.Ids = append(batch.Ids, r.Id)
+		}
+		writeData(ctx, batch)
+	}
+}
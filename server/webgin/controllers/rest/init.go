@@ -0,0 +1,22 @@
+// Package rest 版本化的 REST 接口,失败时返回对应的 HTTP 状态码和统一的错误信封
+package rest
+
+import (
+	"github.com/busyfree/leaf-go/service"
+)
+
+var (
+	segmentService   *service.SegmentIDGenImpl
+	snowflakeService *service.SnowFlakeIdGenImpl
+	ulidService      *service.UlidIdGenImpl
+	uuidV7Service    *service.UuidV7IdGenImpl
+	formattedService *service.FormattedIdGenImpl
+)
+
+func Init(s *service.SegmentIDGenImpl, snowflake *service.SnowFlakeIdGenImpl, ulid *service.UlidIdGenImpl, uuidV7 *service.UuidV7IdGenImpl, formatted *service.FormattedIdGenImpl) {
+	segmentService = s
+	snowflakeService = snowflake
+	ulidService = ulid
+	uuidV7Service = uuidV7
+	formattedService = formatted
+}
@@ -0,0 +1,138 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// buildOpenAPI 根据 routes 生成 OpenAPI 3.0 文档,basePath 为路由组的前缀
+func buildOpenAPI(basePath string, rs []Route) map[string]interface{} {
+	paths := make(map[string]interface{}, len(rs))
+	for _, r := range rs {
+		params := []interface{}{
+			map[string]interface{}{
+				"name":     "tag",
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string", "pattern": tagPattern.String()},
+			},
+			map[string]interface{}{
+				"name":        "count",
+				"in":          "query",
+				"description": "返回的 ID 个数",
+				"schema":      map[string]interface{}{"type": "integer", "minimum": 1, "maximum": maxCount(), "default": 1},
+			},
+		}
+		schema := "StringIdBatch"
+		if r.Numeric {
+			schema = "IdBatch"
+			params = append(params, map[string]interface{}{
+				"name":        "encoding",
+				"in":          "query",
+				"description": "ID 编码方式,为空时使用 tag 配置的编码方式",
+				"schema":      map[string]interface{}{"type": "string", "enum": []string{"base62", "base32", "obfuscate"}},
+			})
+		}
+		paths[openAPIPath(basePath, r.Path)] = map[string]interface{}{
+			"get": map[string]interface{}{
+				"operationId": r.OperationId,
+				"summary":     r.Summary,
+				"parameters":  params,
+				"responses": map[string]interface{}{
+					strconv.Itoa(http.StatusOK): map[string]interface{}{
+						"description": "OK",
+						"content": jsonContent(map[string]interface{}{
+							"type":     "object",
+							"required": []string{"data"},
+							"properties": map[string]interface{}{
+								"data": schemaRef(schema),
+							},
+						}),
+					},
+					strconv.Itoa(http.StatusBadRequest):         errorResponse("tag、count 或 encoding 不合法"),
+					strconv.Itoa(http.StatusUnauthorized):       errorResponse("开启鉴权时签名缺失或不正确"),
+					strconv.Itoa(http.StatusForbidden):          errorResponse("开启鉴权时 appkey 无权使用该 tag"),
+					strconv.Itoa(http.StatusNotFound):           errorResponse("tag 不存在"),
+					strconv.Itoa(http.StatusTooManyRequests):    errorResponse("接口、tag 或调用方被限流"),
+					strconv.Itoa(http.StatusServiceUnavailable): errorResponse("发号失败,可重试"),
+				},
+			},
+		}
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "leaf-go ID API",
+			"version": "2",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": map[string]interface{}{
+				"IdBatch": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"tag", "ids"},
+					"properties": map[string]interface{}{
+						"tag":      map[string]interface{}{"type": "string"},
+						"ids":      map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "integer", "format": "int64"}},
+						"encoding": map[string]interface{}{"type": "string"},
+						"codes":    map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+					},
+				},
+				"StringIdBatch": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"tag", "ids"},
+					"properties": map[string]interface{}{
+						"tag": map[string]interface{}{"type": "string"},
+						"ids": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+					},
+				},
+				"Error": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"error"},
+					"properties": map[string]interface{}{
+						"error": map[string]interface{}{
+							"type":     "object",
+							"required": []string{"code", "message"},
+							"properties": map[string]interface{}{
+								"code": map[string]interface{}{
+									"type": "string",
+									"enum": []string{ErrInvalidTag, ErrInvalidCount, ErrInvalidEncoding, ErrTagNotFound, ErrNotReady, ErrClockSkew, ErrSequenceOverflow, ErrUnavailable},
+								},
+								"message": map[string]interface{}{"type": "string"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// openAPIPath 把 gin 的 :param 转为 OpenAPI 的 {param}
+func openAPIPath(basePath, path string) string {
+	segments := strings.Split(strings.TrimRight(basePath, "/")+path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
+}
+
+func errorResponse(description string) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"content":     jsonContent(schemaRef("Error")),
+	}
+}
@@ -0,0 +1,56 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/busyfree/leaf-go/util/auth"
+	"github.com/busyfree/leaf-go/util/ctxkit"
+	"github.com/busyfree/leaf-go/util/errors"
+)
+
+// DenyFunc 写入鉴权或限流失败的响应,code 为 twirp 错误码
+type DenyFunc func(ctx *gin.Context, status int, code, msg string)
+
+// Auth 开启 LEAF_AUTH_ENABLE 时要求调用方签名正确且拥有 scope 权限,
+// scope 为 api 时路由参数 key 或 tag 需在调用方的 tag 白名单中。
+// deny 为空时按 twirp 错误格式返回 {"code":"","msg":""}
+func Auth(scope string, deny DenyFunc) gin.HandlerFunc {
+	if deny == nil {
+		deny = defaultDeny
+	}
+	return func(ctx *gin.Context) {
+		if !auth.Enabled() {
+			ctx.Next()
+			return
+		}
+		rawCtx := ctx.Request.Context()
+		if !ctxkit.IsValidSignKey(rawCtx) {
+			deny(ctx, http.StatusUnauthorized, "unauthenticated", "invalid signature")
+			return
+		}
+		allowed := auth.HasScope(rawCtx, scope)
+		if allowed && scope == auth.ScopeAPI {
+			tag := tagParam(ctx)
+			allowed = len(tag) == 0 || auth.AllowTag(rawCtx, tag)
+		}
+		if !allowed {
+			deny(ctx, http.StatusForbidden, string(errors.PermissionDeniedError.Code()), errors.PermissionDeniedError.Msg())
+			return
+		}
+		ctx.Next()
+	}
+}
+
+func defaultDeny(ctx *gin.Context, status int, code, msg string) {
+	ctx.AbortWithStatusJSON(status, gin.H{"code": code, "msg": msg})
+}
+
+// tagParam v1 接口的路由参数为 key,v2 为 tag
+func tagParam(ctx *gin.Context) string {
+	if tag := ctx.Param("key"); len(tag) > 0 {
+		return tag
+	}
+	return ctx.Param("tag")
+}
@@ -0,0 +1,39 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+
+	"github.com/busyfree/leaf-go/util/errors"
+	"github.com/busyfree/leaf-go/util/limiter"
+)
+
+// Sentinel 与 twirp 接口共用接口资源 res、biz tag 和调用方的限流规则,需放在 Auth 之后才能识别调用方。
+// countParam 为批量发号接口的 ID 个数参数,按 ID 个数占用配额,为空或参数不合法时按 1 计算,
+// 不合法的参数由接口自己校验。deny 为空时按 twirp 错误格式返回
+func Sentinel(res, countParam string, deny DenyFunc) gin.HandlerFunc {
+	if deny == nil {
+		deny = defaultDeny
+	}
+	return func(ctx *gin.Context) {
+		count := 1
+		if len(countParam) > 0 {
+			count = cast.ToInt(ctx.Query(countParam))
+		}
+		exit, ok := limiter.Entry(ctx.Request.Context(), res, tagParam(ctx), count)
+		if !ok {
+			deny(ctx, http.StatusTooManyRequests, string(errors.TooManyRequestError.Code()), errors.TooManyRequestError.Msg())
+			return
+		}
+		ctx.Next()
+		// v2 接口发号失败返回 5xx,计入熔断统计
+		if status := ctx.Writer.Status(); status >= http.StatusInternalServerError {
+			exit(fmt.Errorf("http status %d", status))
+			return
+		}
+		exit()
+	}
+}
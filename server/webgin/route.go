@@ -9,8 +9,10 @@ import (
 
 	"github.com/busyfree/leaf-go/server/webgin/controllers/acp"
 	"github.com/busyfree/leaf-go/server/webgin/controllers/api"
+	"github.com/busyfree/leaf-go/server/webgin/controllers/rest"
 	"github.com/busyfree/leaf-go/server/webgin/middlewares"
 	"github.com/busyfree/leaf-go/service"
+	"github.com/busyfree/leaf-go/util/auth"
 	"github.com/busyfree/leaf-go/util/conf"
 )
 
@@ -21,7 +23,7 @@ func formatBool(t bool) string {
 	return "false"
 }
 
-func initRoute(segmentService *service.SegmentIDGenImpl, snowflakeService *service.SnowFlakeIdGenImpl) {
+func initRoute(segmentService *service.SegmentIDGenImpl, snowflakeService *service.SnowFlakeIdGenImpl, ulidService *service.UlidIdGenImpl, uuidV7Service *service.UuidV7IdGenImpl, formattedService *service.FormattedIdGenImpl) {
 	GinRoute.SetFuncMap(template.FuncMap{
 		"formatBool": formatBool,
 	})
@@ -52,7 +54,9 @@ func initRoute(segmentService *service.SegmentIDGenImpl, snowflakeService *servi
 	GinRoute.GET(BASEURL+"ping", base.Ping)
 
 	v1 := GinRoute.Group(BASEURL + "v1")
-	v1Dashboard := v1.Group("/acp")
+	// 开启 LEAF_AUTH_ENABLE 后管理接口需要 admin 权限,发号接口需要 api 权限和 tag 白名单,
+	// 发号接口按 [SENTINEL_RES_QPS]、[SENTINEL_TAG_QPS]、[SENTINEL_CALLER_QPS] 限流
+	v1Dashboard := v1.Group("/acp", middlewares.Auth(auth.ScopeAdmin, nil))
 
 	monitorAPIGroup := v1Dashboard.Group("/monitor")
 	{
@@ -60,22 +64,65 @@ func initRoute(segmentService *service.SegmentIDGenImpl, snowflakeService *servi
 		monitorAPIGroup.GET("/cache", monitor.Cache)
 		monitorAPIGroup.GET("/db", monitor.DB)
 		monitorAPIGroup.GET("/decode/:key", monitor.Decode)
+		monitorAPIGroup.GET("/decode/code/:code", monitor.DecodeCode)
+	}
+	sentinelAPIGroup := v1Dashboard.Group("/sentinel")
+	{
+		sentinel := new(acp.SentinelController)
+		sentinelAPIGroup.GET("/rules", sentinel.Rules)
+		sentinelAPIGroup.POST("/flow", sentinel.AddFlow)
+		sentinelAPIGroup.PUT("/flow/:id", sentinel.UpdateFlow)
+		sentinelAPIGroup.DELETE("/flow/:id", sentinel.DeleteFlow)
+		sentinelAPIGroup.POST("/circuitbreaker", sentinel.AddCircuitBreaker)
+		sentinelAPIGroup.PUT("/circuitbreaker/:id", sentinel.UpdateCircuitBreaker)
+		sentinelAPIGroup.DELETE("/circuitbreaker/:id", sentinel.DeleteCircuitBreaker)
 	}
 
-	v1Front := v1.Group("/api")
+	v1Front := v1.Group("/api", middlewares.Auth(auth.ScopeAPI, nil))
 
-	segmentAPIGroup := v1Front.Group("/segment")
+	segmentAPIGroup := v1Front.Group("/segment", middlewares.Sentinel("api_segment", "", nil))
 	{
 		segment := new(api.SegmentController)
 		segmentAPIGroup.GET("/get/:key", segment.Get)
 		segmentAPIGroup.POST("/get/:key", segment.Get)
 	}
-	snowflakeAPIGroup := v1Front.Group("/snowflake")
+	snowflakeAPIGroup := v1Front.Group("/snowflake", middlewares.Sentinel("api_snowflake", "", nil))
 	{
 		snowflake := new(api.SnowFlakeController)
 		snowflakeAPIGroup.GET("/get/:key", snowflake.Get)
 		snowflakeAPIGroup.POST("/get/:key", snowflake.Get)
+		snowflakeAPIGroup.GET("/jssafe/:key", snowflake.GetJsSafe)
+		snowflakeAPIGroup.POST("/jssafe/:key", snowflake.GetJsSafe)
+	}
+	ulidAPIGroup := v1Front.Group("/ulid", middlewares.Sentinel("api_ulid", "", nil))
+	{
+		ulid := new(api.UlidController)
+		ulidAPIGroup.GET("/get/:key", ulid.Get)
+		ulidAPIGroup.POST("/get/:key", ulid.Get)
+	}
+	uuidV7APIGroup := v1Front.Group("/uuidv7", middlewares.Sentinel("api_uuidv7", "", nil))
+	{
+		uuidV7 := new(api.UuidV7Controller)
+		uuidV7APIGroup.GET("/get/:key", uuidV7.Get)
+		uuidV7APIGroup.POST("/get/:key", uuidV7.Get)
 	}
+	// 流式接口在发送每批 ID 前按批占用配额,不经过 Sentinel 中间件
+	streamAPIGroup := v1Front.Group("/stream")
+	{
+		stream := new(api.StreamController)
+		streamAPIGroup.GET("/segment/:key", stream.Segment)
+		streamAPIGroup.GET("/snowflake/:key", stream.Snowflake)
+	}
+	formattedAPIGroup := v1Front.Group("/formatted", middlewares.Sentinel("api_formatted", "", nil))
+	{
+		formatted := new(api.FormattedController)
+		formattedAPIGroup.GET("/get/:key", formatted.Get)
+		formattedAPIGroup.POST("/get/:key", formatted.Get)
+	}
+	// v2 为 REST 风格接口,文档在 /web/v2/openapi.json,文档无需鉴权
+	rest.Register(GinRoute.Group(BASEURL+"v2"), middlewares.Auth(auth.ScopeAPI, rest.Deny))
+
 	acp.Init(segmentService, snowflakeService)
-	api.Init(segmentService, snowflakeService)
+	api.Init(segmentService, snowflakeService, ulidService, uuidV7Service, formattedService)
+	rest.Init(segmentService, snowflakeService, ulidService, uuidV7Service, formattedService)
 }
@@ -12,6 +12,8 @@ import (
 
 const (
 	BASEURL = "/web/"
+	// STREAMURL 流式接口前缀,不经过 http.TimeoutHandler,否则响应会被整体缓冲
+	STREAMURL = BASEURL + "v1/api/stream/"
 )
 
 var (
@@ -19,7 +21,7 @@ var (
 	logger   = log.Get(context.Background())
 )
 
-func InitWebGin(segment *service.SegmentIDGenImpl, snowflake *service.SnowFlakeIdGenImpl) {
+func InitWebGin(segment *service.SegmentIDGenImpl, snowflake *service.SnowFlakeIdGenImpl, ulid *service.UlidIdGenImpl, uuidV7 *service.UuidV7IdGenImpl, formatted *service.FormattedIdGenImpl) {
 	GinRoute = gin.New()
-	initRoute(segment, snowflake)
+	initRoute(segment, snowflake, ulid, uuidV7, formatted)
 }
@@ -0,0 +1,341 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/busyfree/leaf-go/dao"
+	"github.com/busyfree/leaf-go/models"
+	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/db"
+	"github.com/busyfree/leaf-go/util/idcodec"
+	"github.com/busyfree/leaf-go/util/timeutil"
+)
+
+// 序列号重置周期
+const (
+	formatResetHour  = "hour"
+	formatResetDay   = "day"
+	formatResetMonth = "month"
+	formatResetNever = "never"
+)
+
+const (
+	formatTokenLiteral = iota
+	formatTokenDate
+	formatTokenSeq
+	formatTokenCheck
+)
+
+type idFormatToken struct {
+	kind  int
+	value string // 字面量或日期 layout
+	width int    // 序列号补零位数
+}
+
+// idFormat 一个 tag 的格式和当前周期,当前周期对应 leaf_alloc 中 biz_tag 为 ${tag}_${周期} 的一行
+type idFormat struct {
+	tag    string
+	tokens []idFormatToken
+	reset  string
+	bizTag string
+	mu     sync.Mutex
+}
+
+// parseIdFormat 解析格式串,{date:layout} 为 Go 时间格式的日期,{seq:N} 为补零到 N 位的序列号,
+// {check} 为前面所有数字的 Luhn 校验位,其余字符原样输出
+func parseIdFormat(tag, pattern, reset string) (*idFormat, error) {
+	f := new(idFormat)
+	f.tag = tag
+	switch reset {
+	case "":
+		f.reset = formatResetDay
+	case formatResetHour, formatResetDay, formatResetMonth, formatResetNever:
+		f.reset = reset
+	default:
+		return nil, fmt.Errorf("unknown reset period %s", reset)
+	}
+	seqCount := 0
+	for len(pattern) > 0 {
+		start := strings.IndexByte(pattern, '{')
+		if start < 0 {
+			f.tokens = append(f.tokens, idFormatToken{kind: formatTokenLiteral, value: pattern})
+			break
+		}
+		if start > 0 {
+			f.tokens = append(f.tokens, idFormatToken{kind: formatTokenLiteral, value: pattern[:start]})
+		}
+		end := strings.IndexByte(pattern[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed { in pattern")
+		}
+		name, arg := pattern[start+1:start+end], ""
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			name, arg = name[:i], name[i+1:]
+		}
+		switch name {
+		case "date":
+			if len(arg) == 0 {
+				arg = "20060102"
+			}
+			f.tokens = append(f.tokens, idFormatToken{kind: formatTokenDate, value: arg})
+		case "seq":
+			width := 0
+			if len(arg) > 0 {
+				var err error
+				width, err = strconv.Atoi(arg)
+				if err != nil || width < 0 || width > 18 {
+					return nil, fmt.Errorf("invalid seq width %s", arg)
+				}
+			}
+			f.tokens = append(f.tokens, idFormatToken{kind: formatTokenSeq, width: width})
+			seqCount++
+		case "check":
+			f.tokens = append(f.tokens, idFormatToken{kind: formatTokenCheck})
+		default:
+			return nil, fmt.Errorf("unknown placeholder {%s}", name)
+		}
+		pattern = pattern[start+end+1:]
+	}
+	if seqCount != 1 {
+		return nil, fmt.Errorf("pattern must contain exactly one {seq}")
+	}
+	// 序列号按周期重置,日期必须能区分不同周期,否则相邻周期会生成相同的 ID
+	if f.reset != formatResetNever && !f.coversPeriod() {
+		return nil, fmt.Errorf("{date} layout must be at least as fine as reset period %s, or use reset never", f.reset)
+	}
+	return f, nil
+}
+
+// coversPeriod 依次只改变年、月、日、时(保持星期几不变),格式化出的日期都不同时说明日期可以区分不同周期
+func (f *idFormat) coversPeriod() bool {
+	base := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	// 2001 与 2029 年日历相同,2001 年 2 月与 3 月的同一天星期几相同
+	probes := []time.Time{base.AddDate(28, 0, 0), base.AddDate(0, 1, 0)}
+	if f.reset == formatResetDay || f.reset == formatResetHour {
+		probes = append(probes, base.AddDate(0, 0, 1), base.AddDate(0, 0, 7))
+	}
+	if f.reset == formatResetHour {
+		probes = append(probes, base.Add(time.Hour), base.Add(12*time.Hour))
+	}
+	date := f.formatDate(base)
+	for _, t := range probes {
+		if f.formatDate(t) == date {
+			return false
+		}
+	}
+	return true
+}
+
+// formatDate 只输出格式中的日期部分,没有 {date} 时返回空
+func (f *idFormat) formatDate(t time.Time) string {
+	var b strings.Builder
+	for _, token := range f.tokens {
+		if token.kind == formatTokenDate {
+			b.WriteString(t.Format(token.value))
+			b.WriteByte('|')
+		}
+	}
+	return b.String()
+}
+
+// period 时间 t 所在的周期,never 返回空
+func (f *idFormat) period(t time.Time) string {
+	switch f.reset {
+	case formatResetHour:
+		return timeutil.Time2DayHourStr(t)
+	case formatResetMonth:
+		return timeutil.Time2MonthStr(t)
+	case formatResetNever:
+		return ""
+	default:
+		return timeutil.Time2DayStr(t)
+	}
+}
+
+// periodBefore 时间 t 往前 n 个周期
+func (f *idFormat) periodBefore(t time.Time, n int) time.Time {
+	switch f.reset {
+	case formatResetHour:
+		return t.Add(-time.Duration(n) * time.Hour)
+	case formatResetMonth:
+		// 按月初计算,避免 31 号往前推到不存在的日期
+		first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+		return first.AddDate(0, -n, 0)
+	default:
+		return t.AddDate(0, 0, -n)
+	}
+}
+
+func (f *idFormat) periodBizTag(period string) string {
+	if len(period) == 0 {
+		return f.tag
+	}
+	return f.tag + "_" + period
+}
+
+// format 序列号超过补零位数时按实际位数输出
+func (f *idFormat) format(t time.Time, seq int64) string {
+	var b strings.Builder
+	for _, token := range f.tokens {
+		switch token.kind {
+		case formatTokenLiteral:
+			b.WriteString(token.value)
+		case formatTokenDate:
+			b.WriteString(t.Format(token.value))
+		case formatTokenSeq:
+			b.WriteString(fmt.Sprintf("%0*d", token.width, seq))
+		case formatTokenCheck:
+			b.WriteByte(idcodec.LuhnDigit(b.String()))
+		}
+	}
+	return b.String()
+}
+
+// FormattedIdGenImpl 基于号段模式生成格式化业务 ID,如 20261018-000123。
+// 每个周期使用 leaf_alloc 中独立的一行,进入新周期时自动创建,序列号从 1 开始,
+// 超过 LEAF_ID_FORMAT_KEEP_PERIODS 个周期的行标记删除
+type FormattedIdGenImpl struct {
+	segment      *SegmentIDGenImpl
+	formats      map[string]*idFormat
+	step         int
+	keepPeriods  int
+	location     *time.Location
+	leafAllocDao *dao.LeafAllocDao
+}
+
+func NewFormattedIdGenImpl(segment *SegmentIDGenImpl) *FormattedIdGenImpl {
+	s := new(FormattedIdGenImpl)
+	s.segment = segment
+	s.formats = make(map[string]*idFormat)
+	s.step = conf.GetInt("LEAF_ID_FORMAT_STEP")
+	if s.step <= 0 {
+		s.step = 1000
+	}
+	s.keepPeriods = conf.GetInt("LEAF_ID_FORMAT_KEEP_PERIODS")
+	// 周期按固定时区划分,不随部署机器的本地时区变化
+	s.location = time.UTC
+	if name := conf.GetString("LEAF_ID_FORMAT_TIMEZONE"); len(name) > 0 {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			logger.Errorf("invalid id format timezone-{%s}, use UTC:%v", name, err)
+		} else {
+			s.location = loc
+		}
+	}
+	s.leafAllocDao = dao.NewLeafAllocDao()
+	resets := conf.GetStrMapStr("LEAF_ID_FORMAT_RESET")
+	// viper 的 map key 统一转为小写,tag 按小写匹配
+	for tag, pattern := range conf.GetStrMapStr("LEAF_ID_FORMAT") {
+		f, err := parseIdFormat(tag, pattern, strings.ToLower(strings.TrimSpace(resets[tag])))
+		if err != nil {
+			logger.Errorf("invalid id format-{%s} of tag-{%s}, ignored:%v", pattern, tag, err)
+			continue
+		}
+		s.formats[tag] = f
+		logger.Infof("formatted id tag-{%s} pattern-{%s} reset-{%s}", tag, pattern, f.reset)
+	}
+	return s
+}
+
+// HasTag tag 是否配置了格式
+func (s *FormattedIdGenImpl) HasTag(key string) bool {
+	_, ok := s.formats[strings.ToLower(key)]
+	return ok
+}
+
+func (s *FormattedIdGenImpl) Init(ctx context.Context) bool {
+	return true
+}
+
+func (s *FormattedIdGenImpl) GetString(ctx context.Context, key string) models.StringResult {
+	f, ok := s.formats[strings.ToLower(key)]
+	if !ok {
+		return models.NewStringResult("", models.EXCEPTION)
+	}
+	// 日期和周期使用同一时刻,跨周期时不会出现日期与序列号不一致
+	now := time.Now().In(s.location)
+	bizTag, err := s.rollover(ctx, f, now)
+	if err != nil {
+		logger.Errorf("rollover formatted id tag-{%s} error:%v", f.tag, err)
+		return models.NewStringResult("", models.EXCEPTION)
+	}
+	r := s.segment.Get(ctx, bizTag)
+	if r.Status != models.SUCCESS {
+		logger.Errorf("get segment id of biz tag-{%s} error code-{%d}", bizTag, r.Id)
+		return models.NewStringResult("", models.EXCEPTION)
+	}
+	return models.NewStringResult(f.format(now, r.Id), models.SUCCESS)
+}
+
+// rollover 返回 now 所在周期的 biz_tag,进入新周期时创建 leaf_alloc 行并加入号段缓存
+func (s *FormattedIdGenImpl) rollover(ctx context.Context, f *idFormat, now time.Time) (string, error) {
+	bizTag := f.periodBizTag(f.period(now))
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.bizTag == bizTag {
+		return bizTag, nil
+	}
+	// 周期为定长数字,可直接按字符串比较。并发请求跨周期时较早的请求继续使用原周期的行,当前周期只前进不回退
+	if len(f.bizTag) > 0 && bizTag < f.bizTag {
+		return bizTag, nil
+	}
+	leafAllocDao := dao.NewLeafAllocDao()
+	leafAllocDao.BizTag = bizTag
+	// max_id 从 1 开始,第一个号段的序列号为 1
+	leafAllocDao.MaxId = 1
+	leafAllocDao.Step = s.step
+	leafAllocDao.Description = "formatted id of " + f.tag
+	// 多个实例同时进入新周期时只有一个能写入成功
+	if err := leafAllocDao.Insert(ctx); err != nil && !db.IsDuplicateEntryErr(err) {
+		return "", err
+	}
+	s.segment.AddTag(bizTag)
+	f.bizTag = bizTag
+	logger.Infof("formatted id tag-{%s} rollover to biz tag-{%s}", f.tag, bizTag)
+	if s.keepPeriods > 0 && f.reset != formatResetNever {
+		go s.cleanup(f, now)
+	}
+	return bizTag, nil
+}
+
+// cleanup 标记删除 keepPeriods 个周期之前的 leaf_alloc 行
+func (s *FormattedIdGenImpl) cleanup(f *idFormat, now time.Time) {
+	ctx := context.Background()
+	tags, err := s.leafAllocDao.GetAllTags(ctx)
+	if err != nil {
+		logger.Errorf("cleanup formatted id tag-{%s} get tags error:%v", f.tag, err)
+		return
+	}
+	prefix := f.tag + "_"
+	oldest := f.period(f.periodBefore(now, s.keepPeriods))
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, prefix) {
+			continue
+		}
+		// 周期为定长数字,可直接按字符串比较
+		period := tag[len(prefix):]
+		if len(period) != len(oldest) || !isDigits(period) || period >= oldest {
+			continue
+		}
+		if err := dao.NewLeafAllocDao().SoftDelete(ctx, tag); err != nil {
+			logger.Errorf("cleanup formatted id biz tag-{%s} error:%v", tag, err)
+			continue
+		}
+		s.segment.RemoveTag(tag)
+		logger.Infof("formatted id biz tag-{%s} expired, deleted", tag)
+	}
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/busyfree/leaf-go/util/conf"
+)
+
+func TestParseIdFormatResetPeriod(t *testing.T) {
+	cases := []struct {
+		pattern string
+		reset   string
+		ok      bool
+	}{
+		{"INV{seq:8}", "never", true},
+		{"INV{seq:8}", "", false},
+		{"INV{seq:8}", "day", false},
+		{"{date:20060102}-{seq:6}", "day", true},
+		{"{date:20060102}-{seq:6}", "hour", false},
+		{"{date:2006010215}-{seq:6}", "hour", true},
+		{"{date:2006-01-02 3PM}{seq}", "hour", true},
+		{"{date:2006-01-02 3}{seq}", "hour", false},
+		{"{date:06002}{seq}", "day", true},
+		{"{date:01-02}{seq}", "day", false},
+		{"R{date:200601}{seq:8}{check}", "month", true},
+		{"R{date:200601}{seq:8}{check}", "day", false},
+		{"{date:2006}{date:0102}{seq}", "day", true},
+	}
+	for _, c := range cases {
+		_, err := parseIdFormat("t", c.pattern, c.reset)
+		if (err == nil) != c.ok {
+			t.Errorf("parseIdFormat(%q, %q) error = %v, want ok %v", c.pattern, c.reset, err, c.ok)
+		}
+	}
+}
+
+func TestFormattedIdTimezone(t *testing.T) {
+	defer conf.Set("LEAF_ID_FORMAT_TIMEZONE", "")
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"", "UTC"},
+		{"Asia/Shanghai", "Asia/Shanghai"},
+		{"Not/AZone", "UTC"},
+	}
+	for _, c := range cases {
+		conf.Set("LEAF_ID_FORMAT_TIMEZONE", c.name)
+		if got := NewFormattedIdGenImpl(nil).location.String(); got != c.want {
+			t.Errorf("timezone %q location = %s, want %s", c.name, got, c.want)
+		}
+	}
+}
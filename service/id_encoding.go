@@ -0,0 +1,126 @@
+package service
+
+import (
+	"strings"
+
+	"go.uber.org/atomic"
+
+	"github.com/busyfree/leaf-go/models"
+	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/idcodec"
+)
+
+// idEncoding 按 biz tag 配置的 ID 编码方式,[LEAF_ID_ENCODING] 配置 tag 对应的编码,
+// obfuscate 使用 [LEAF_ID_ENCODING_SALTS] 中 tag 的 salt,未配置时使用 LEAF_ID_ENCODING_SALT,
+// 两者都为空时忽略该 tag 的 obfuscate 配置
+type idEncoding struct {
+	encodings   map[string]string
+	salts       map[string]string
+	defaultSalt string
+	obfuscators map[string]*idcodec.Obfuscator
+}
+
+var idEncoder atomic.Value
+
+func init() {
+	idEncoder.Store(newIdEncoding())
+}
+
+// ReloadIdEncoding 配置变更时重新读取编码方式和 salt
+func ReloadIdEncoding() {
+	idEncoder.Store(newIdEncoding())
+}
+
+func loadIdEncoding() *idEncoding {
+	return idEncoder.Load().(*idEncoding)
+}
+
+func newIdEncoding() *idEncoding {
+	e := new(idEncoding)
+	e.encodings = make(map[string]string)
+	e.salts = conf.GetStrMapStr("LEAF_ID_ENCODING_SALTS")
+	e.defaultSalt = conf.GetString("LEAF_ID_ENCODING_SALT")
+	e.obfuscators = make(map[string]*idcodec.Obfuscator)
+	// viper 的 map key 统一转为小写,查询时 tag 也按小写匹配
+	for tag, encoding := range conf.GetStrMapStr("LEAF_ID_ENCODING") {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if !idcodec.IsValidEncoding(encoding) {
+			logger.Errorf("unknown id encoding-{%s} of tag-{%s}, ignored", encoding, tag)
+			continue
+		}
+		if encoding == idcodec.Obfuscate {
+			if len(e.salt(tag)) == 0 {
+				logger.Errorf("id encoding obfuscate of tag-{%s} requires a salt, ignored", tag)
+				continue
+			}
+			e.obfuscators[tag] = idcodec.NewObfuscator(e.salt(tag))
+		}
+		e.encodings[tag] = encoding
+	}
+	return e
+}
+
+func (e *idEncoding) salt(tag string) string {
+	if salt, ok := e.salts[tag]; ok && len(salt) > 0 {
+		return salt
+	}
+	return e.defaultSalt
+}
+
+// TagEncoding tag 配置的编码方式,未配置返回空
+func TagEncoding(tag string) string {
+	return loadIdEncoding().encodings[strings.ToLower(tag)]
+}
+
+// CheckEncoding tag 能否使用 encoding 编码,obfuscate 要求 tag 配置了 salt
+func CheckEncoding(tag, encoding string) error {
+	if !idcodec.IsValidEncoding(encoding) {
+		return idcodec.ErrUnknownEncoding
+	}
+	if encoding == idcodec.Obfuscate && len(loadIdEncoding().salt(strings.ToLower(tag))) == 0 {
+		return idcodec.ErrEmptySalt
+	}
+	return nil
+}
+
+// EncodeResult tag 配置了编码方式且发号成功时填充 r.Code
+func EncodeResult(tag string, r *models.Result) {
+	if r.Status != models.SUCCESS {
+		return
+	}
+	code, err := EncodeId(tag, "", r.Id)
+	if err != nil {
+		logger.Errorf("encode id-{%d} of tag-{%s} error:%v", r.Id, tag, err)
+		return
+	}
+	r.Code = code
+}
+
+// EncodeId 按 encoding 编码 id,encoding 为空时使用 tag 配置的编码方式,都没有时返回空
+func EncodeId(tag, encoding string, id int64) (string, error) {
+	tag = strings.ToLower(tag)
+	e := loadIdEncoding()
+	if len(encoding) == 0 {
+		encoding = e.encodings[tag]
+		if len(encoding) == 0 {
+			return "", nil
+		}
+	}
+	if encoding == idcodec.Obfuscate {
+		if o, ok := e.obfuscators[tag]; ok {
+			return o.Encode(id), nil
+		}
+	}
+	return idcodec.Encode(encoding, e.salt(tag), id)
+}
+
+// DecodeCode 解码 code,encoding 为空时使用 tag 配置的编码方式
+func DecodeCode(tag, encoding, code string) (int64, string, error) {
+	tag = strings.ToLower(tag)
+	e := loadIdEncoding()
+	if len(encoding) == 0 {
+		encoding = e.encodings[tag]
+	}
+	id, err := idcodec.Decode(encoding, e.salt(tag), code)
+	return id, encoding, err
+}
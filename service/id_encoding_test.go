@@ -0,0 +1,46 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/idcodec"
+)
+
+func TestObfuscateRequiresSalt(t *testing.T) {
+	conf.Set("LEAF_ID_ENCODING", `{"order": "obfuscate", "invite": "base32"}`)
+	conf.Set("LEAF_ID_ENCODING_SALT", "")
+	defer func() {
+		conf.Set("LEAF_ID_ENCODING", "{}")
+		ReloadIdEncoding()
+	}()
+	ReloadIdEncoding()
+
+	if encoding := TagEncoding("order"); len(encoding) > 0 {
+		t.Fatalf("obfuscate without salt should be ignored, got %s", encoding)
+	}
+	if TagEncoding("invite") != idcodec.Base32 {
+		t.Fatal("base32 should not require salt")
+	}
+	if _, err := EncodeId("order", idcodec.Obfuscate, 1); err != idcodec.ErrEmptySalt {
+		t.Fatalf("EncodeId error = %v, want ErrEmptySalt", err)
+	}
+	if err := CheckEncoding("order", idcodec.Obfuscate); err != idcodec.ErrEmptySalt {
+		t.Fatalf("CheckEncoding error = %v, want ErrEmptySalt", err)
+	}
+
+	// 重新加载后使用新的 salt
+	conf.Set("LEAF_ID_ENCODING_SALT", "secret")
+	ReloadIdEncoding()
+	if TagEncoding("order") != idcodec.Obfuscate {
+		t.Fatal("obfuscate should be enabled after salt is configured")
+	}
+	code, err := EncodeId("order", "", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _, err := DecodeCode("order", "", code)
+	if err != nil || id != 42 {
+		t.Fatalf("DecodeCode(%s) = %d, %v", code, id, err)
+	}
+}
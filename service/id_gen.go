@@ -10,3 +10,9 @@ type IDGen interface {
 	Get(ctx context.Context, key string) models.Result
 	Init(ctx context.Context) bool
 }
+
+// StringIDGen 返回字符串 ID 的生成器
+type StringIDGen interface {
+	GetString(ctx context.Context, key string) models.StringResult
+	Init(ctx context.Context) bool
+}
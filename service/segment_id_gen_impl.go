@@ -20,6 +20,9 @@ type SegmentIDGenImpl struct {
 	initOk          bool
 	cache           *sync.Map
 	leafAllocDao    *dao.LeafAllocDao
+	ctx             context.Context
+	cancel          context.CancelFunc
+	wg              sync.WaitGroup
 }
 
 func NewSegmentIDGenImpl() *SegmentIDGenImpl {
@@ -29,6 +32,7 @@ func NewSegmentIDGenImpl() *SegmentIDGenImpl {
 	s.initOk = false
 	s.leafAllocDao = dao.NewLeafAllocDao()
 	s.cache = new(sync.Map)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
 	s.Init()
 	return s
 }
@@ -43,9 +47,14 @@ func (s *SegmentIDGenImpl) Init() bool {
 func (s *SegmentIDGenImpl) updateCacheFromDbAtEveryMinute() {
 	ticker := time.NewTicker(time.Duration(60) * time.Second)
 	runtime.LockOSThread()
+	s.wg.Add(1)
 	go func(t *time.Ticker) {
+		defer s.wg.Done()
+		defer t.Stop()
 		for {
 			select {
+			case <-s.ctx.Done():
+				return
 			case <-t.C:
 				s.updateCacheFromDb(context.Background())
 			}
@@ -53,6 +62,13 @@ func (s *SegmentIDGenImpl) updateCacheFromDbAtEveryMinute() {
 	}(ticker)
 }
 
+// Close 停止定时从 DB 刷新 tag 缓存
+func (s *SegmentIDGenImpl) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
+
 func (s *SegmentIDGenImpl) Get(ctx context.Context, key string) models.Result {
 	if !s.initOk {
 		return models.NewResult(int64(models.EXCEPTION_ID_IDCACHE_INIT_FALSE), models.EXCEPTION)
@@ -213,18 +229,17 @@ func (s *SegmentIDGenImpl) updateCacheFromDb(ctx context.Context) {
 	}
 	if len(insertTags) > 0 {
 		for _, k := range insertTags {
-			segmentBuffer := dao.NewSegmentBufferDao()
-			segmentBuffer.SetKey(k)
-			segment := segmentBuffer.GetCurrent()
-			segment.SetValue(atomic.NewInt64(0))
-			segment.SetMax(0)
-			segment.SetStep(0)
-			s.cache.Store(k, segmentBuffer)
+			s.AddTag(k)
 		}
 	}
 	if len(dbTags) > 0 {
+		dbTagMap := make(map[string]struct{}, len(dbTags))
 		for _, k := range dbTags {
-			if _, ok := cacheTags[k]; !ok {
+			dbTagMap[k] = struct{}{}
+		}
+		// 缓存中有但 DB 中已不存在的 tag
+		for k := range cacheTags {
+			if _, ok := dbTagMap[k]; !ok {
 				removeTags = append(removeTags, k)
 			}
 		}
@@ -237,6 +252,22 @@ func (s *SegmentIDGenImpl) updateCacheFromDb(ctx context.Context) {
 
 }
 
+// AddTag 把 DB 中新建的 tag 加入缓存,不用等下一次定时刷新,已存在时不做处理
+func (s *SegmentIDGenImpl) AddTag(key string) {
+	segmentBuffer := dao.NewSegmentBufferDao()
+	segmentBuffer.SetKey(key)
+	segment := segmentBuffer.GetCurrent()
+	segment.SetValue(atomic.NewInt64(0))
+	segment.SetMax(0)
+	segment.SetStep(0)
+	s.cache.LoadOrStore(key, segmentBuffer)
+}
+
+// RemoveTag 从缓存中移除 tag
+func (s *SegmentIDGenImpl) RemoveTag(key string) {
+	s.cache.Delete(key)
+}
+
 func (s *SegmentIDGenImpl) GetAllLeafAllocs(ctx context.Context) (array []*dao.LeafAllocDao, err error) {
 	return s.leafAllocDao.GetAllLeafAllocs(ctx)
 }
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/busyfree/leaf-go/models"
+	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/timeutil"
+)
+
+// CACHED_BORROW_PATH 记录 workerId 预借到的毫秒时间戳,重启后只需等待仍未到达的预借时间
+var CACHED_BORROW_PATH = filepath.Join(conf.GetConfigPath(), conf.GetString("LEAF_NAME")) + "/leafconf/cached/{workerId}.borrow"
+
+// CachedSnowFlakeIdGenImpl 参考百度 UidGenerator 的 CachedUidGenerator,后台按秒预借未来时间批量生成 ID 填充 RingBuffer,
+// Get 只做一次无锁出队。ID 为秒级布局,最高的 namespaceBits 位固定为全 1,与默认布局和其他 namespace 的 ID 不会重复
+type CachedSnowFlakeIdGenImpl struct {
+	workerId  int64
+	layout    *snowflakeLayout
+	ring      *uidRingBuffer
+	maxBorrow int64
+	// 填充进度,只在 paddingMu 内读写
+	paddingTick     int64
+	paddingSequence int64
+	paddingMu       sync.Mutex
+	paddingCh       chan struct{}
+	ctx             context.Context
+	cancel          context.CancelFunc
+	wg              sync.WaitGroup
+}
+
+// NewCachedSnowFlakeIdGenImpl namespaceBits 与默认布局的 LEAF_SNOWFLAKE_NAMESPACE_BITS 相同,必须大于 0
+func NewCachedSnowFlakeIdGenImpl(twepoch, workerId int64, namespaceBits int) *CachedSnowFlakeIdGenImpl {
+	s := new(CachedSnowFlakeIdGenImpl)
+	s.workerId = workerId
+	// namespace 编码 + 秒级时间戳 + 10 位 workerId + 22 位序列号,每秒最多约 419 万个 ID
+	seqBits := 22
+	if conf.IsSet("LEAF_SNOWFLAKE_CACHED_SEQUENCE_BITS") {
+		seqBits = conf.GetInt("LEAF_SNOWFLAKE_CACHED_SEQUENCE_BITS")
+	}
+	if namespaceBits <= 0 {
+		panic("cached snowflake requires LEAF_SNOWFLAKE_NAMESPACE_BITS gt 0")
+	}
+	layout, err := newSnowflakeLayout(twepoch, 1000, namespaceBits, 63-namespaceBits-workerIdBits-seqBits, workerIdBits, seqBits)
+	if err != nil {
+		panic("invalid LEAF_SNOWFLAKE_CACHED_SEQUENCE_BITS:" + err.Error())
+	}
+	layout.namespaceCode = cachedNamespaceCode(namespaceBits)
+	s.layout = layout
+	ringSize := conf.GetInt64("LEAF_SNOWFLAKE_CACHED_RING_SIZE")
+	if ringSize <= 0 {
+		ringSize = 1 << 20
+	}
+	paddingFactor := conf.GetInt64("LEAF_SNOWFLAKE_CACHED_PADDING_FACTOR")
+	if paddingFactor <= 0 || paddingFactor >= 100 {
+		paddingFactor = 50
+	}
+	s.ring = newUidRingBuffer(ringSize, paddingFactor)
+	s.maxBorrow = conf.GetInt64("LEAF_SNOWFLAKE_CACHED_MAX_BORROW")
+	if s.maxBorrow <= 0 {
+		s.maxBorrow = 3
+	}
+	s.paddingCh = make(chan struct{}, 1)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+// cachedNamespaceCode cached 布局保留的 namespace 编码,即 namespaceBits 位全 1
+func cachedNamespaceCode(namespaceBits int) int64 {
+	return int64(^(-1 << namespaceBits))
+}
+
+// Init 同 workerId 的上一个实例预借的秒数还没到时等待到预借结束,避免生成重复 ID,没有预借时不等待。
+// 记录的预借时间超出当前时间 maxBorrow 秒以上说明本机时间回拨,拒绝启动
+func (s *CachedSnowFlakeIdGenImpl) Init(ctx context.Context) bool {
+	until, err := readCachedBorrow(s.workerId)
+	if err != nil {
+		logger.Errorf("cached snowflake workerId-{%d} read borrow file error:%+v", s.workerId, err)
+		return false
+	}
+	if wait := until - timeutil.MsTimestampNow(); wait > 0 {
+		if wait > (s.maxBorrow+1)*1000 {
+			logger.Errorf("cached snowflake workerId-{%d} borrowed until-{%d} is %dms ahead of local time, clock moved backwards", s.workerId, until, wait)
+			return false
+		}
+		logger.Infof("cached snowflake workerId-{%d} wait %dms for borrowed ids", s.workerId, wait)
+		time.Sleep(time.Duration(wait) * time.Millisecond)
+	}
+	s.paddingTick = s.layout.tick()
+	s.paddingSequence = 0
+	s.padding()
+	s.wg.Add(1)
+	go s.scheduledPadding()
+	logger.Infof("cached snowflake workerId-{%d} ring size-{%d} threshold-{%d} start SUCCESS", s.workerId, s.ring.size, s.ring.paddingThreshold)
+	return true
+}
+
+func (s *CachedSnowFlakeIdGenImpl) Get(ctx context.Context, key string) models.Result {
+	id, ok, needPadding := s.ring.take()
+	if needPadding {
+		s.triggerPadding()
+	}
+	if !ok {
+		// 环已取空,同步填充一次
+		s.padding()
+		id, ok, _ = s.ring.take()
+		if !ok {
+			return models.NewResult(int64(models.EXCEPTION_ID_SEQUENCE_OVERFLOW), models.EXCEPTION)
+		}
+	}
+	return models.Result{Id: id, Status: models.SUCCESS}
+}
+
+// Decode 按秒级布局解析 ID
+func (s *CachedSnowFlakeIdGenImpl) Decode(id int64) map[string]interface{} {
+	out := s.layout.decode(id)
+	out["format"] = "cached"
+	return out
+}
+
+func (s *CachedSnowFlakeIdGenImpl) triggerPadding() {
+	select {
+	case s.paddingCh <- struct{}{}:
+	default:
+	}
+}
+
+func (s *CachedSnowFlakeIdGenImpl) scheduledPadding() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(time.Duration(1) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.paddingCh:
+			s.padding()
+		case <-ticker.C:
+			if s.ring.available() < s.ring.paddingThreshold {
+				s.padding()
+			}
+		}
+	}
+}
+
+// padding 从上次填充的位置继续生成 ID 直到环满,当前秒的序列号用完后借用下一秒,
+// 领先当前时间 maxBorrow 秒时停止,等待下一次触发
+func (s *CachedSnowFlakeIdGenImpl) padding() {
+	s.paddingMu.Lock()
+	defer s.paddingMu.Unlock()
+	if now := s.layout.tick(); now > s.paddingTick {
+		// 空闲期间不保留过去的秒数
+		s.paddingTick = now
+		s.paddingSequence = 0
+	}
+	for {
+		if s.paddingSequence > s.layout.sequenceMask {
+			if s.paddingTick+1-s.layout.tick() > s.maxBorrow {
+				return
+			}
+			s.paddingTick++
+			s.paddingSequence = 0
+			if s.paddingTick > s.layout.tick() {
+				// 预借了未来的秒数,记录下来供重启后等待
+				saveCachedBorrow(s.workerId, s.layout.twepoch+(s.paddingTick+1)*s.layout.timeUnit)
+			}
+		}
+		if s.paddingTick > s.layout.maxTimestamp {
+			logger.Errorf("cached snowflake timestamp-{%d} overflow", s.paddingTick)
+			return
+		}
+		if !s.ring.put(s.layout.compose(s.paddingTick, s.workerId, s.paddingSequence)) {
+			return
+		}
+		s.paddingSequence++
+	}
+}
+
+// Close 停止后台填充
+func (s *CachedSnowFlakeIdGenImpl) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
+
+func cachedBorrowFilePath(workerId int64) string {
+	return strings.Replace(CACHED_BORROW_PATH, "{workerId}", strconv.FormatInt(workerId, 10), -1)
+}
+
+// readCachedBorrow 读取预借结束的毫秒时间戳,文件不存在时返回 0
+func readCachedBorrow(workerId int64) (int64, error) {
+	data, err := ioutil.ReadFile(cachedBorrowFilePath(workerId))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	until, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid borrow file %s: %v", cachedBorrowFilePath(workerId), err)
+	}
+	return until, nil
+}
+
+// saveCachedBorrow 失败只记录日志
+func saveCachedBorrow(workerId, until int64) {
+	filePath := cachedBorrowFilePath(workerId)
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		logger.Errorf("cached snowflake save borrow error:%+v", err)
+		return
+	}
+	if err := ioutil.WriteFile(filePath, []byte(strconv.FormatInt(until, 10)), os.ModePerm); err != nil {
+		logger.Errorf("cached snowflake save borrow error:%+v", err)
+	}
+}
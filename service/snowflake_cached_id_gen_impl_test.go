@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/busyfree/leaf-go/models"
+	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/timeutil"
+)
+
+// setupCachedTest 预借记录写到临时目录,每个刻度只有 4 个序列号,环大小 64,最多预借 3 秒
+func setupCachedTest(t *testing.T) {
+	oldPath := CACHED_BORROW_PATH
+	CACHED_BORROW_PATH = filepath.Join(t.TempDir(), "{workerId}.borrow")
+	conf.Set("LEAF_SNOWFLAKE_HOLDER_FLAG", "0")
+	conf.Set("LEAF_SNOWFLAKE_WORKER_ID", "1")
+	conf.Set("LEAF_SNOWFLAKE_CACHED_SEQUENCE_BITS", "2")
+	conf.Set("LEAF_SNOWFLAKE_CACHED_RING_SIZE", "64")
+	conf.Set("LEAF_SNOWFLAKE_CACHED_MAX_BORROW", "3")
+	t.Cleanup(func() {
+		CACHED_BORROW_PATH = oldPath
+		conf.Set("LEAF_SNOWFLAKE_CACHED_SEQUENCE_BITS", "22")
+		conf.Set("LEAF_SNOWFLAKE_CACHED_RING_SIZE", "0")
+		conf.Set("LEAF_SNOWFLAKE_CACHED_KEYS", "")
+		conf.Set("LEAF_SNOWFLAKE_NAMESPACE_BITS", "0")
+	})
+}
+
+func TestCachedSnowflakeRequiresNamespaceBits(t *testing.T) {
+	setupCachedTest(t)
+	conf.Set("LEAF_SNOWFLAKE_CACHED_KEYS", "cached")
+	conf.Set("LEAF_SNOWFLAKE_NAMESPACE_BITS", "0")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("cached keys without namespace bits should be rejected")
+		}
+	}()
+	NewSnowFlakeIdGenImpl(8080, 1288834974657)
+}
+
+func TestCachedSnowflakeOwnNamespaceCode(t *testing.T) {
+	setupCachedTest(t)
+	conf.Set("LEAF_SNOWFLAKE_CACHED_KEYS", "cached")
+	conf.Set("LEAF_SNOWFLAKE_NAMESPACE_BITS", "1")
+	s := NewSnowFlakeIdGenImpl(8080, 1288834974657)
+	defer s.Close()
+	ctx := context.Background()
+
+	cached, plain := s.Get(ctx, "cached"), s.Get(ctx, "plain")
+	if cached.Status != models.SUCCESS || plain.Status != models.SUCCESS {
+		t.Fatalf("cached %+v plain %+v", cached, plain)
+	}
+	shift := s.defaultNamespace.layout.namespaceShift
+	if code := cached.Id >> shift; code != 1 {
+		t.Fatalf("cached id %d has namespace code %d, want 1", cached.Id, code)
+	}
+	if code := plain.Id >> shift; code != 0 {
+		t.Fatalf("default id %d has namespace code %d, want 0", plain.Id, code)
+	}
+	out := s.DecodeSnowflakeId(strconv.FormatInt(cached.Id, 10), "", "")
+	if out["format"] != "cached" || out["workerId"] != int64(1) {
+		t.Fatalf("decode cached id: %+v", out)
+	}
+}
+
+func TestCachedSnowflakeBorrowWait(t *testing.T) {
+	setupCachedTest(t)
+	ctx := context.Background()
+
+	// 没有预借记录时不等待;环大小超过每秒的序列号,填充时预借未来的秒数并记录
+	start := time.Now()
+	s := NewCachedSnowFlakeIdGenImpl(1288834974657, 1, 1)
+	if !s.Init(ctx) {
+		t.Fatal("init failed")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("init without borrow waited %v", elapsed)
+	}
+	s.Close()
+	until, err := readCachedBorrow(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lead := until - timeutil.MsTimestampNow(); lead <= 0 || lead > 4000 {
+		t.Fatalf("borrowed until %d, lead %dms", until, lead)
+	}
+
+	// 预借还没结束时等待到预借结束
+	saveCachedBorrow(1, timeutil.MsTimestampNow()+1000)
+	start = time.Now()
+	s = NewCachedSnowFlakeIdGenImpl(1288834974657, 1, 1)
+	if !s.Init(ctx) {
+		t.Fatal("init failed")
+	}
+	s.Close()
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Fatalf("init waited %v for borrowed ids", elapsed)
+	}
+
+	// 预借时间远超 maxBorrow 说明时钟回拨,拒绝启动
+	saveCachedBorrow(1, timeutil.MsTimestampNow()+60000)
+	if NewCachedSnowFlakeIdGenImpl(1288834974657, 1, 1).Init(ctx) {
+		t.Fatal("init should fail when clock moved backwards")
+	}
+}
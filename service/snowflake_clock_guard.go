@@ -0,0 +1,73 @@
+package service
+
+import (
+	"time"
+
+	"go.uber.org/atomic"
+
+	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/metrics"
+	"github.com/busyfree/leaf-go/util/timeutil"
+)
+
+// 按协调服务的时间超过该时长未上报心跳的节点视为已下线,不参与时钟偏差计算
+const peerStaleMillis = 30 * 1000
+
+// clockDriftGuard 对比本机时间与其他 snowflake 节点上报时间的平均值,
+// 偏差超过 LEAF_SNOWFLAKE_MAX_CLOCK_SKEW 毫秒时拒绝发号
+type clockDriftGuard struct {
+	holder   string
+	maxSkew  int64
+	interval time.Duration
+	skewed   *atomic.Bool
+}
+
+func newClockDriftGuard(holder string) *clockDriftGuard {
+	g := new(clockDriftGuard)
+	g.holder = holder
+	g.maxSkew = 5000
+	if conf.IsSet("LEAF_SNOWFLAKE_MAX_CLOCK_SKEW") {
+		g.maxSkew = conf.GetInt64("LEAF_SNOWFLAKE_MAX_CLOCK_SKEW")
+	}
+	g.interval = time.Duration(conf.GetInt64("LEAF_SNOWFLAKE_CLOCK_CHECK_INTERVAL")) * time.Second
+	if g.interval <= 0 {
+		g.interval = time.Duration(60) * time.Second
+	}
+	g.skewed = atomic.NewBool(false)
+	return g
+}
+
+// check 计算本机与 peers 平均时间的偏差,返回偏差是否在阈值内,maxSkew <= 0 表示不检查。
+// peers 由 holder 按协调服务的时间换算为各节点当前的时间,并过滤掉已下线的节点,不能用本机时间判断,
+// 否则本机时钟快很多时所有节点都会被当作下线而跳过检查
+func (g *clockDriftGuard) check(peers []int64) bool {
+	now := timeutil.MsTimestampNow()
+	var sum, count int64
+	for _, ts := range peers {
+		sum += ts
+		count++
+	}
+	var skew int64
+	if count > 0 {
+		skew = now - sum/count
+	}
+	metrics.SnowflakeClockSkewSeconds.WithLabelValues(g.holder).Set(float64(skew) / 1000)
+	if g.maxSkew <= 0 || count == 0 {
+		g.skewed.Store(false)
+		return true
+	}
+	if skew > g.maxSkew || -skew > g.maxSkew {
+		logger.Errorf("local clock skew %dms against %d peers exceeds %dms, refuse to serve", skew, count, g.maxSkew)
+		g.skewed.Store(true)
+		return false
+	}
+	if g.skewed.Load() {
+		logger.Infof("local clock skew %dms against %d peers recovered", skew, count)
+	}
+	g.skewed.Store(false)
+	return true
+}
+
+func (g *clockDriftGuard) IsSkewed() bool {
+	return g.skewed.Load()
+}
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"encoding/json"
+
+	"github.com/busyfree/leaf-go/util/timeutil"
+)
+
+// buildEndpointData 各 holder 上报到协调服务的节点数据,时间戳为当前时间
+func buildEndpointData(ip, port string) []byte {
+	endPoint := new(Endpoint)
+	endPoint.IP = ip
+	endPoint.Port = port
+	endPoint.Timestamp = timeutil.MsTimestampNow()
+	encodeArr, _ := json.Marshal(endPoint)
+	return encodeArr
+}
+
+func deBuildEndpointData(val []byte) *Endpoint {
+	endPoint := new(Endpoint)
+	_ = json.Unmarshal(val, endPoint)
+	return endPoint
+}
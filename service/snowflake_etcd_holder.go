@@ -2,21 +2,29 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/spf13/cast"
-	"github.com/spf13/viper"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	"go.etcd.io/etcd/client/v3"
+	"go.uber.org/atomic"
 
-	"github.com/busyfree/leaf-go/util/check"
 	"github.com/busyfree/leaf-go/util/conf"
 	"github.com/busyfree/leaf-go/util/timeutil"
+	"github.com/busyfree/leaf-go/util/tlsutil"
+)
+
+var (
+	PATH_SEQUENCE = PREFIX_ZK_PATH + "/sequence" // workerId 计数器,key 的 version 即下一个可分配的 workerId
+	PATH_ALIVE    = PREFIX_ZK_PATH + "/alive"    // 绑定 lease 的存活节点,同一 ip:port 同时只能有一个实例,值中的 nonce 区分进程
 )
 
 type SnowFlakeEtcdHolder struct {
@@ -28,6 +36,18 @@ type SnowFlakeEtcdHolder struct {
 	connectionStr   string
 	lastUpdateTime  int64
 	dialTimeout     int
+	leaseTTL        int64
+	leaseId         clientv3.LeaseID
+	heartbeat       time.Duration
+	nonce           string
+	tlsConfig       *tls.Config
+	degraded        bool
+	clockGuard      *clockDriftGuard
+	lost            *atomic.Bool
+	client          *clientv3.Client
+	ctx             context.Context
+	cancel          context.CancelFunc
+	wg              sync.WaitGroup
 	WorkerId        int
 }
 
@@ -40,161 +60,438 @@ func NewSnowFlakeEtcdHolder(ip, port string, endpoints []string, dialTimeout int
 		dialTimeout = 10
 	}
 	s.dialTimeout = dialTimeout
+	s.leaseTTL = conf.GetInt64("LEAF_SNOWFLAKE_ETCD_LEASE_TTL")
+	if s.leaseTTL <= 0 {
+		s.leaseTTL = 10
+	}
+	// 心跳时续约 lease,间隔不超过 lease 时长的 1/3
+	s.heartbeat = time.Duration(3) * time.Second
+	if d := time.Duration(s.leaseTTL) * time.Second / 3; d < s.heartbeat {
+		s.heartbeat = d
+	}
 	s.listenAddress = ip + ":" + port
-	s.Init()
+	nonce := make([]byte, 8)
+	_, _ = rand.Read(nonce)
+	s.nonce = hex.EncodeToString(nonce)
+	s.clockGuard = newClockDriftGuard("etcd")
+	s.lost = atomic.NewBool(false)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
 	return s
 }
 
 func (s *SnowFlakeEtcdHolder) Init() bool {
-	c, err := clientv3.New(clientv3.Config{
-		Endpoints:   s.endpoints,
-		DialTimeout: time.Duration(s.dialTimeout) * time.Second,
-	})
+	// TLS 配置错误时不降级为明文连接
+	tlsConfig, err := tlsutil.NewClientConfig("LEAF_SNOWFLAKE_ETCD_TLS")
 	if err != nil {
-		panic(err)
+		logger.Errorf("etcd tls config error:%+v", err)
+		return false
 	}
-	var retryCount = 0
-RETRY:
-	resp, err := c.Get(context.Background(), PATH_FOREVER)
+	s.tlsConfig = tlsConfig
+	c, err := s.newClient()
 	if err != nil {
-		panic(err)
+		logger.Errorf("etcd connect error:%+v", err)
+		return s.initFromLocal(nil)
 	}
-	switch true {
-	case resp == nil:
-	case resp != nil && len(resp.Kvs) == 0:
-		zkAddr := s.createNode(c)
-		s.updateLocalWorkerID(s.WorkerId)
-		go s.scheduledUploadData(c, zkAddr)
-		return true
+	s.client = c
+	ok, err := s.register(c)
+	if err != nil {
+		logger.Errorf("etcd register error:%+v", err)
+		return s.initFromLocal(c)
 	}
-	resp, err1 := c.Get(context.Background(), PATH_FOREVER)
-	if err1 != nil {
-		panic(err1)
+	return ok
+}
+
+func (s *SnowFlakeEtcdHolder) newClient() (*clientv3.Client, error) {
+	return clientv3.New(clientv3.Config{
+		Endpoints:   s.endpoints,
+		DialTimeout: time.Duration(s.dialTimeout) * time.Second,
+		TLS:         s.tlsConfig,
+	})
+}
+
+// register 在 etcd 上查找或创建本节点,返回 error 表示 etcd 不可用,返回 false 表示节点数据校验失败
+func (s *SnowFlakeEtcdHolder) register(c *clientv3.Client) (bool, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Duration(s.dialTimeout)*time.Second)
+	defer cancel()
+	ok, err := s.keepAlive(ctx, c)
+	if !ok || err != nil {
+		return ok, err
 	}
-	if len(resp.Kvs) == 0 {
-		if retryCount > 3 {
-			return false
-		}
-		retryCount++
-		goto RETRY
+	ok, err = s.registerNode(ctx, c)
+	if !ok || err != nil {
+		// 注册失败时释放 alive 节点,避免阻塞下一次注册
+		_, _ = c.Revoke(context.Background(), s.leaseId)
+	}
+	return ok, err
+}
+
+func (s *SnowFlakeEtcdHolder) registerNode(ctx context.Context, c *clientv3.Client) (bool, error) {
+	resp, err := c.Get(ctx, PATH_FOREVER+"/", clientv3.WithPrefix())
+	if err != nil {
+		return false, err
 	}
 	nodeMap := make(map[string]int, 0)
 	realNodeMap := make(map[string]string, 0)
-	for _, node := range resp.Kvs {
-		nodeKey := strings.Split(string(node.Value), "-")
-		realNodeMap[nodeKey[0]] = string(node.Value)
-		nodeMap[nodeKey[0]] = cast.ToInt(nodeKey[1])
+	peers, err := s.peerTimestamps(ctx, c, resp.Kvs)
+	if err != nil {
+		return false, err
+	}
+	if !s.clockGuard.check(peers) {
+		logger.Errorf("START FAILED ,local clock skew against peer nodes is too large")
+		return false, nil
 	}
-	if workId, ok := nodeMap[s.listenAddress]; ok {
+	for _, kv := range resp.Kvs {
+		node := strings.TrimPrefix(string(kv.Key), PATH_FOREVER+"/")
+		listenAddress, workerId, err := parseForeverNodeKey(node)
+		if err != nil {
+			logger.Warnf("skip invalid forever node:%+v", err)
+			continue
+		}
+		if exist, ok := realNodeMap[listenAddress]; ok {
+			logger.Errorf("START FAILED ,endpoint %s has more than one forever node:%s,%s", listenAddress, exist, node)
+			return false, nil
+		}
+		realNodeMap[listenAddress] = node
+		nodeMap[listenAddress] = workerId
+	}
+	if workerId, ok := nodeMap[s.listenAddress]; ok {
 		etcdAddrNode := PATH_FOREVER + "/" + realNodeMap[s.listenAddress]
-		s.WorkerId = workId
-		if !s.checkInitTimeStamp(c, etcdAddrNode) {
-			viper.SetConfigName("workerID")
-			viper.AddConfigPath(conf.GetConfigPath())
-			err := viper.ReadInConfig()
+		if s.degraded {
+			if workerId != s.WorkerId {
+				logger.Errorf("RECONCILE FAILED ,etcd workerId-{%d} differs from local workerId-{%d}", workerId, s.WorkerId)
+				return false, nil
+			}
+		} else {
+			valid, err := s.checkInitTimeStamp(ctx, c, etcdAddrNode)
 			if err != nil {
-				panic(fmt.Errorf("read file error:%v", err))
+				return false, err
+			}
+			if !valid {
+				logger.Errorf("START FAILED ,etcd node %s timestamp is bigger than local time", etcdAddrNode)
+				return false, nil
 			}
-			logger.Errorf("START FAILED ,use local node file properties workerID-{%d}", viper.GetInt("workerID"))
-			return false
 		}
+		s.WorkerId = workerId
 		s.etcdAddressNode = etcdAddrNode
+		s.degraded = false
 		s.doService(c)
-		s.updateLocalWorkerID(s.WorkerId)
+		saveLocalWorkerID(s.port, s.WorkerId)
 		logger.Infof("[Old NODE]find forever node have this endpoint ip-{%s} port-{%s} workid-{%d} childnode and start SUCCESS", s.ip, s.port, s.WorkerId)
-	} else {
-		newNode := s.createNode(c)
-		s.etcdAddressNode = newNode
-		nodeKeyArr := strings.Split(newNode, "-")
-		s.WorkerId = cast.ToInt(nodeKeyArr[1])
-		s.doService(c)
-		s.updateLocalWorkerID(workId)
-		logger.Infof("[New NODE]can not find node on forever node that endpoint ip-{%s} port-{%s} workid-{%d},create own node on forever node and start SUCCESS", s.ip, s.port, s.WorkerId)
+		return true, nil
+	}
+	if s.degraded {
+		logger.Errorf("RECONCILE FAILED ,endpoint %s not found on forever node, local workerId-{%d} is unverified", s.listenAddress, s.WorkerId)
+		return false, nil
+	}
+	newNode, workerId, err := s.createNode(ctx, c)
+	if err != nil {
+		return false, err
 	}
+	s.etcdAddressNode = newNode
+	s.WorkerId = workerId
+	s.doService(c)
+	saveLocalWorkerID(s.port, s.WorkerId)
+	logger.Infof("[New NODE]can not find node on forever node that endpoint ip-{%s} port-{%s} workid-{%d},create own node on forever node and start SUCCESS", s.ip, s.port, s.WorkerId)
+	return true, nil
+}
+
+// initFromLocal etcd 不可用时使用本地缓存的 workerId 降级启动,并在后台等待 etcd 恢复后重新注册
+func (s *SnowFlakeEtcdHolder) initFromLocal(c *clientv3.Client) bool {
+	workerId, ok := loadLocalWorkerID(s.port)
+	if !ok {
+		return false
+	}
+	s.WorkerId = workerId
+	s.degraded = true
+	logger.Warnf("[DEGRADED]etcd unavailable, use local file workerID-{%d} ip-{%s} port-{%s}", s.WorkerId, s.ip, s.port)
+	s.wg.Add(1)
+	go s.reconcile(c)
 	return true
 }
 
+func (s *SnowFlakeEtcdHolder) reconcile(c *clientv3.Client) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(time.Duration(3) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// 降级期间持续更新本地时间戳,供下次启动校验时钟
+		saveLocalWorkerID(s.port, s.WorkerId)
+		if c == nil {
+			var err error
+			c, err = s.newClient()
+			if err != nil {
+				continue
+			}
+			s.client = c
+		}
+		ok, err := s.register(c)
+		if err != nil {
+			logger.Warnf("etcd still unavailable:%v", err)
+			continue
+		}
+		if ok {
+			logger.Infof("[DEGRADED]etcd recovered, workerID-{%d} reconciled", s.WorkerId)
+			return
+		}
+		// 本地 workerId 与 etcd 不一致或时钟偏差过大时,降级期间使用的 workerId 不可信,拒绝继续发号
+		logger.Errorf("[DEGRADED]etcd reconcile failed, local workerID-{%d} is lost, refuse to serve", s.WorkerId)
+		s.lost.Store(true)
+		return
+	}
+}
+
+// keepAlive 申请 lease 并抢占 alive 节点,防止同一 ip:port 的两个实例同时使用一个 workerId。
+// alive 节点由本进程持有时(降级后重新注册),撤销旧 lease 后重新抢占;由其他进程持有时启动失败,
+// 进程崩溃后需要等旧 lease 过期再启动。lease 在每次心跳上报时间后续约,见 renewLease
+func (s *SnowFlakeEtcdHolder) keepAlive(ctx context.Context, client *clientv3.Client) (bool, error) {
+	lease, err := client.Grant(ctx, s.leaseTTL)
+	if err != nil {
+		return false, err
+	}
+	aliveKey := PATH_ALIVE + "/" + s.listenAddress
+	for reclaimed := false; ; reclaimed = true {
+		txnResp, err := client.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(aliveKey), "=", 0)).
+			Then(clientv3.OpPut(aliveKey, string(s.buildAliveData()), clientv3.WithLease(lease.ID))).
+			Else(clientv3.OpGet(aliveKey)).
+			Commit()
+		if err != nil {
+			_, _ = client.Revoke(context.Background(), lease.ID)
+			return false, err
+		}
+		if txnResp.Succeeded {
+			break
+		}
+		kvs := txnResp.Responses[0].GetResponseRange().GetKvs()
+		if reclaimed || len(kvs) == 0 || !s.isSelf(deBuildEndpointData(kvs[0].Value)) {
+			logger.Errorf("START FAILED ,endpoint %s is already alive on %s, retry after lease ttl {%d}s", s.listenAddress, aliveKey, s.leaseTTL)
+			_, _ = client.Revoke(context.Background(), lease.ID)
+			return false, nil
+		}
+		logger.Warnf("endpoint %s is still alive on %s with own lease %d, reclaim it", s.listenAddress, aliveKey, kvs[0].Lease)
+		_, err = client.Revoke(ctx, clientv3.LeaseID(kvs[0].Lease))
+		if err != nil && !errors.Is(err, rpctypes.ErrLeaseNotFound) {
+			_, _ = client.Revoke(context.Background(), lease.ID)
+			return false, err
+		}
+	}
+	s.leaseId = lease.ID
+	return true, nil
+}
+
+// buildAliveData alive 节点数据,带上本进程的 nonce
+func (s *SnowFlakeEtcdHolder) buildAliveData() []byte {
+	endPoint := new(Endpoint)
+	endPoint.IP = s.ip
+	endPoint.Port = s.port
+	endPoint.Timestamp = timeutil.MsTimestampNow()
+	endPoint.Nonce = s.nonce
+	encodeArr, _ := json.Marshal(endPoint)
+	return encodeArr
+}
+
+// isSelf alive 节点是否由本进程写入,同一 ip:port 的其他实例 nonce 不同
+func (s *SnowFlakeEtcdHolder) isSelf(endpoint *Endpoint) bool {
+	return endpoint.IP == s.ip && endpoint.Port == s.port && endpoint.Nonce == s.nonce
+}
+
 func (s *SnowFlakeEtcdHolder) doService(client *clientv3.Client) {
+	// 立即上报一次,沿用旧节点时 forever 中是上次运行的时间,与新 lease 的时长对不上
+	if s.updateNewData(client, s.etcdAddressNode) {
+		s.renewLease(client)
+	}
+	s.wg.Add(1)
 	go s.scheduledUploadData(client, s.etcdAddressNode)
 }
 
 func (s *SnowFlakeEtcdHolder) scheduledUploadData(client *clientv3.Client, zkAddrNode string) {
-	ticker := time.NewTicker(time.Duration(3) * time.Second)
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.heartbeat)
+	defer ticker.Stop()
+	clockTicker := time.NewTicker(s.clockGuard.interval)
+	defer clockTicker.Stop()
 	for {
 		select {
+		case <-s.ctx.Done():
+			return
 		case <-ticker.C:
-			s.updateNewData(client, zkAddrNode)
+			if s.updateNewData(client, zkAddrNode) {
+				s.renewLease(client)
+			}
+		case <-clockTicker.C:
+			s.checkClockDrift(client)
 		}
 	}
 }
 
-func (s *SnowFlakeEtcdHolder) createNode(client *clientv3.Client) string {
-	path := PATH_FOREVER + "/" + s.listenAddress + "-0000000000"
-	_, err := client.Put(context.Background(), PATH_FOREVER, s.listenAddress+"-0000000000")
+// peerTimestamps 解析 forever 下其他节点最后上报的时间,只统计 alive 节点仍存在的节点。
+// 节点上报时间后立即续约 lease,lease 已使用的时长即 etcd 视角下节点多久没有上报,
+// 上报时间加上这段时长得到节点当前的时间,已下线但 lease 未过期的节点不会因为时间旧被算作偏差
+func (s *SnowFlakeEtcdHolder) peerTimestamps(ctx context.Context, client *clientv3.Client, kvs []*mvccpb.KeyValue) ([]int64, error) {
+	timestamps := make([]int64, 0, len(kvs))
+	resp, err := client.Get(ctx, PATH_ALIVE+"/", clientv3.WithPrefix(), clientv3.WithKeysOnly())
 	if err != nil {
-		return ""
+		return nil, err
 	}
-	_, err = client.Put(context.Background(), path, string(s.buildData()))
-	if err != nil {
-		logger.Infof("etcd CreateValErr:%+v", err)
-		return ""
+	leases := make(map[string]clientv3.LeaseID, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		leases[strings.TrimPrefix(string(kv.Key), PATH_ALIVE+"/")] = clientv3.LeaseID(kv.Lease)
 	}
-	return path
+	for _, kv := range kvs {
+		node := strings.TrimPrefix(string(kv.Key), PATH_FOREVER+"/")
+		listenAddress, _, err := parseForeverNodeKey(node)
+		if err != nil || listenAddress == s.listenAddress {
+			continue
+		}
+		leaseId, ok := leases[listenAddress]
+		if !ok {
+			continue
+		}
+		ttl, err := client.TimeToLive(ctx, leaseId)
+		if err != nil {
+			return nil, err
+		}
+		if ttl.TTL <= 0 {
+			continue
+		}
+		// etcd 返回的剩余秒数向下取整,取区间中点
+		silent := (ttl.GrantedTTL-ttl.TTL)*1000 - 500
+		if silent < 0 {
+			silent = 0
+		}
+		if silent > peerStaleMillis {
+			continue
+		}
+		timestamps = append(timestamps, deBuildEndpointData(kv.Value).Timestamp+silent)
+	}
+	return timestamps, nil
 }
 
-func (s *SnowFlakeEtcdHolder) updateNewData(client *clientv3.Client, path string) {
-	if timeutil.MsTimestampNow() < s.lastUpdateTime {
+// renewLease 上报时间成功后续约 lease,lease 已经过期时 alive 节点被删除,
+// 同一 endpoint 的其他实例可能已经启动,不能继续使用 workerId
+func (s *SnowFlakeEtcdHolder) renewLease(client *clientv3.Client) {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Duration(s.dialTimeout)*time.Second)
+	defer cancel()
+	_, err := client.KeepAliveOnce(ctx, s.leaseId)
+	if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+		if !s.lost.Load() {
+			logger.Errorf("etcd lease %d expired, workerId is lost, refuse to serve", s.leaseId)
+		}
+		s.lost.Store(true)
 		return
 	}
-	_, err := client.Put(context.Background(), path, string(s.buildData()))
 	if err != nil {
-		return
+		logger.Warnf("etcd renew lease %d error:%v", s.leaseId, err)
 	}
-	s.lastUpdateTime = timeutil.MsTimestampNow()
-	return
 }
 
-func (s *SnowFlakeEtcdHolder) buildData() []byte {
-	endPoint := new(Endpoint)
-	endPoint.IP = s.ip
-	endPoint.Port = s.port
-	endPoint.Timestamp = timeutil.MsTimestampNow()
-	encodeArr, _ := json.Marshal(endPoint)
-	return encodeArr
+func (s *SnowFlakeEtcdHolder) checkClockDrift(client *clientv3.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.dialTimeout)*time.Second)
+	defer cancel()
+	resp, err := client.Get(ctx, PATH_FOREVER+"/", clientv3.WithPrefix())
+	if err != nil {
+		logger.Warnf("etcd get forever nodes error:%v", err)
+		return
+	}
+	peers, err := s.peerTimestamps(ctx, client, resp.Kvs)
+	if err != nil {
+		logger.Warnf("etcd get alive nodes error:%v", err)
+		return
+	}
+	s.clockGuard.check(peers)
 }
 
-func (s *SnowFlakeEtcdHolder) deBuildData(val []byte) *Endpoint {
-	endPoint := new(Endpoint)
-	_ = json.Unmarshal(val, endPoint)
-	return endPoint
+// createNode 通过事务递增 sequence 计数器并创建 forever 节点,
+// 计数器 version 被并发修改时事务失败并重试,保证 workerId 不会重复分配
+func (s *SnowFlakeEtcdHolder) createNode(ctx context.Context, client *clientv3.Client) (string, int, error) {
+	for {
+		resp, err := client.Get(ctx, PATH_SEQUENCE)
+		if err != nil {
+			return "", 0, err
+		}
+		var version int64
+		if len(resp.Kvs) > 0 {
+			version = resp.Kvs[0].Version
+		}
+		if version > int64(maxWorkerId) {
+			return "", 0, fmt.Errorf("workerId exhausted, sequence version %d gt %d", version, maxWorkerId)
+		}
+		path := fmt.Sprintf("%s/%s-%010d", PATH_FOREVER, s.listenAddress, version)
+		txnResp, err := client.Txn(ctx).
+			If(
+				clientv3.Compare(clientv3.Version(PATH_SEQUENCE), "=", version),
+				clientv3.Compare(clientv3.CreateRevision(path), "=", 0),
+			).
+			Then(
+				clientv3.OpPut(PATH_SEQUENCE, s.listenAddress),
+				clientv3.OpPut(path, string(buildEndpointData(s.ip, s.port))),
+			).
+			Commit()
+		if err != nil {
+			return "", 0, err
+		}
+		if txnResp.Succeeded {
+			return path, int(version), nil
+		}
+		logger.Infof("etcd sequence %d was taken by another node, retry", version)
+	}
 }
 
-func (s *SnowFlakeEtcdHolder) checkInitTimeStamp(client *clientv3.Client, zkAddrNode string) bool {
-	resp, err := client.Get(context.Background(), zkAddrNode)
+// updateNewData 上报当前时间,返回是否上报成功
+func (s *SnowFlakeEtcdHolder) updateNewData(client *clientv3.Client, path string) bool {
+	if timeutil.MsTimestampNow() < s.lastUpdateTime {
+		return false
+	}
+	_, err := client.Put(context.Background(), path, string(buildEndpointData(s.ip, s.port)))
 	if err != nil {
 		return false
 	}
-	endpoint := s.deBuildData(resp.Kvs[0].Value)
-	return !(endpoint.Timestamp > timeutil.MsTimestampNow())
+	saveLocalWorkerID(s.port, s.WorkerId)
+	s.lastUpdateTime = timeutil.MsTimestampNow()
+	return true
 }
 
-func (s *SnowFlakeEtcdHolder) updateLocalWorkerID(workId int) {
-	filePath := strings.Replace(PROP_PATH, "{port}", s.port, -1)
-	if !check.CheckFileExist(filePath) {
-		dirs := filepath.Dir(filePath)
-		err := os.MkdirAll(dirs, os.ModePerm)
-		if err != nil {
-			return
-		}
-	}
-	err := ioutil.WriteFile(filePath, []byte(fmt.Sprintf("workerID=%d", workId)), os.ModePerm)
+func (s *SnowFlakeEtcdHolder) checkInitTimeStamp(ctx context.Context, client *clientv3.Client, zkAddrNode string) (bool, error) {
+	resp, err := client.Get(ctx, zkAddrNode)
 	if err != nil {
-		logger.Infof("%+v", err)
-		return
+		return false, err
+	}
+	if len(resp.Kvs) == 0 {
+		return false, nil
 	}
-	return
+	endpoint := deBuildEndpointData(resp.Kvs[0].Value)
+	return !(endpoint.Timestamp > timeutil.MsTimestampNow()), nil
+}
+
+func (s *SnowFlakeEtcdHolder) IsLost() bool {
+	return s.lost.Load()
 }
 
 func (s *SnowFlakeEtcdHolder) GetWorkerId() int {
 	return s.WorkerId
 }
+
+// Close 停止心跳和 lease 续约,上报最后一次时间戳并释放 alive 节点后关闭 etcd 连接
+func (s *SnowFlakeEtcdHolder) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	if s.client == nil {
+		saveLocalWorkerID(s.port, s.WorkerId)
+		return nil
+	}
+	if len(s.etcdAddressNode) > 0 && !s.degraded {
+		s.updateNewData(s.client, s.etcdAddressNode)
+	}
+	saveLocalWorkerID(s.port, s.WorkerId)
+	if s.leaseId != clientv3.NoLease {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.dialTimeout)*time.Second)
+		_, _ = s.client.Revoke(ctx, s.leaseId)
+		cancel()
+	}
+	return s.client.Close()
+}
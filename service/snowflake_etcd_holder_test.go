@@ -0,0 +1,563 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+
+	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/timeutil"
+)
+
+// fakeEtcd 进程内的 etcd 替身,实现 holder 用到的 KV 和 Lease 接口,供 clientv3 直接连接。
+// lease 不会自动过期,测试通过 expireLease 模拟服务端判定 lease 过期,通过 silence 模拟节点停止续约
+type fakeEtcd struct {
+	etcdserverpb.UnimplementedKVServer
+	etcdserverpb.UnimplementedLeaseServer
+	mu        sync.Mutex
+	rev       int64
+	kvs       map[string]*mvccpb.KeyValue
+	leases    map[int64]*fakeLease
+	nextLease int64
+	addr      string
+	srv       *grpc.Server
+}
+
+type fakeLease struct {
+	ttl     int64
+	renewed time.Time
+}
+
+func newFakeEtcd(t *testing.T) *fakeEtcd {
+	f := new(fakeEtcd)
+	f.rev = 1
+	f.kvs = make(map[string]*mvccpb.KeyValue)
+	f.leases = make(map[int64]*fakeLease)
+	f.nextLease = 100
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.addr = ln.Addr().String()
+	f.srv = grpc.NewServer()
+	etcdserverpb.RegisterKVServer(f.srv, f)
+	etcdserverpb.RegisterLeaseServer(f.srv, f)
+	go f.srv.Serve(ln)
+	t.Cleanup(f.srv.Stop)
+	return f
+}
+
+func (f *fakeEtcd) header() *etcdserverpb.ResponseHeader {
+	return &etcdserverpb.ResponseHeader{Revision: f.rev}
+}
+
+func (f *fakeEtcd) match(req *etcdserverpb.RangeRequest) []*mvccpb.KeyValue {
+	kvs := make([]*mvccpb.KeyValue, 0)
+	for k, kv := range f.kvs {
+		key := []byte(k)
+		switch {
+		case len(req.RangeEnd) == 0:
+			if !bytes.Equal(key, req.Key) {
+				continue
+			}
+		case bytes.Equal(req.RangeEnd, []byte{0}):
+			if bytes.Compare(key, req.Key) < 0 {
+				continue
+			}
+		default:
+			if bytes.Compare(key, req.Key) < 0 || bytes.Compare(key, req.RangeEnd) >= 0 {
+				continue
+			}
+		}
+		copied := *kv
+		kvs = append(kvs, &copied)
+	}
+	sort.Slice(kvs, func(i, j int) bool { return bytes.Compare(kvs[i].Key, kvs[j].Key) < 0 })
+	return kvs
+}
+
+func (f *fakeEtcd) rangeLocked(req *etcdserverpb.RangeRequest) *etcdserverpb.RangeResponse {
+	kvs := f.match(req)
+	return &etcdserverpb.RangeResponse{Header: f.header(), Kvs: kvs, Count: int64(len(kvs))}
+}
+
+func (f *fakeEtcd) putLocked(req *etcdserverpb.PutRequest, rev int64) (*etcdserverpb.PutResponse, error) {
+	if req.Lease != 0 {
+		if _, ok := f.leases[req.Lease]; !ok {
+			return nil, rpctypes.ErrGRPCLeaseNotFound
+		}
+	}
+	kv, ok := f.kvs[string(req.Key)]
+	if !ok {
+		kv = &mvccpb.KeyValue{Key: req.Key, CreateRevision: rev}
+		f.kvs[string(req.Key)] = kv
+	}
+	kv.Value = req.Value
+	kv.ModRevision = rev
+	kv.Version++
+	kv.Lease = req.Lease
+	return &etcdserverpb.PutResponse{Header: f.header()}, nil
+}
+
+func (f *fakeEtcd) deleteLocked(req *etcdserverpb.DeleteRangeRequest) *etcdserverpb.DeleteRangeResponse {
+	kvs := f.match(&etcdserverpb.RangeRequest{Key: req.Key, RangeEnd: req.RangeEnd})
+	for _, kv := range kvs {
+		delete(f.kvs, string(kv.Key))
+	}
+	return &etcdserverpb.DeleteRangeResponse{Header: f.header(), Deleted: int64(len(kvs))}
+}
+
+func (f *fakeEtcd) Range(ctx context.Context, req *etcdserverpb.RangeRequest) (*etcdserverpb.RangeResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rangeLocked(req), nil
+}
+
+func (f *fakeEtcd) Put(ctx context.Context, req *etcdserverpb.PutRequest) (*etcdserverpb.PutResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rev++
+	return f.putLocked(req, f.rev)
+}
+
+func (f *fakeEtcd) DeleteRange(ctx context.Context, req *etcdserverpb.DeleteRangeRequest) (*etcdserverpb.DeleteRangeResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rev++
+	return f.deleteLocked(req), nil
+}
+
+func (f *fakeEtcd) compare(c *etcdserverpb.Compare) bool {
+	kv, ok := f.kvs[string(c.Key)]
+	if !ok {
+		kv = new(mvccpb.KeyValue)
+	}
+	var result int
+	switch c.Target {
+	case etcdserverpb.Compare_VERSION:
+		result = compareInt64(kv.Version, c.GetVersion())
+	case etcdserverpb.Compare_CREATE:
+		result = compareInt64(kv.CreateRevision, c.GetCreateRevision())
+	case etcdserverpb.Compare_MOD:
+		result = compareInt64(kv.ModRevision, c.GetModRevision())
+	case etcdserverpb.Compare_LEASE:
+		result = compareInt64(kv.Lease, c.GetLease())
+	case etcdserverpb.Compare_VALUE:
+		if !ok {
+			return false
+		}
+		result = bytes.Compare(kv.Value, c.GetValue())
+	}
+	switch c.Result {
+	case etcdserverpb.Compare_EQUAL:
+		return result == 0
+	case etcdserverpb.Compare_NOT_EQUAL:
+		return result != 0
+	case etcdserverpb.Compare_GREATER:
+		return result > 0
+	default:
+		return result < 0
+	}
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a > b:
+		return 1
+	case a < b:
+		return -1
+	}
+	return 0
+}
+
+func (f *fakeEtcd) Txn(ctx context.Context, req *etcdserverpb.TxnRequest) (*etcdserverpb.TxnResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	succeeded := true
+	for _, c := range req.Compare {
+		if !f.compare(c) {
+			succeeded = false
+			break
+		}
+	}
+	ops := req.Success
+	if !succeeded {
+		ops = req.Failure
+	}
+	// 同一个事务中的写操作使用同一个 revision
+	rev := f.rev + 1
+	written := false
+	responses := make([]*etcdserverpb.ResponseOp, 0, len(ops))
+	for _, op := range ops {
+		switch r := op.Request.(type) {
+		case *etcdserverpb.RequestOp_RequestRange:
+			responses = append(responses, &etcdserverpb.ResponseOp{Response: &etcdserverpb.ResponseOp_ResponseRange{ResponseRange: f.rangeLocked(r.RequestRange)}})
+		case *etcdserverpb.RequestOp_RequestPut:
+			resp, err := f.putLocked(r.RequestPut, rev)
+			if err != nil {
+				return nil, err
+			}
+			written = true
+			responses = append(responses, &etcdserverpb.ResponseOp{Response: &etcdserverpb.ResponseOp_ResponsePut{ResponsePut: resp}})
+		case *etcdserverpb.RequestOp_RequestDeleteRange:
+			written = true
+			responses = append(responses, &etcdserverpb.ResponseOp{Response: &etcdserverpb.ResponseOp_ResponseDeleteRange{ResponseDeleteRange: f.deleteLocked(r.RequestDeleteRange)}})
+		default:
+			return nil, fmt.Errorf("unsupported txn op %T", r)
+		}
+	}
+	if written {
+		f.rev = rev
+	}
+	return &etcdserverpb.TxnResponse{Header: f.header(), Succeeded: succeeded, Responses: responses}, nil
+}
+
+func (f *fakeEtcd) LeaseGrant(ctx context.Context, req *etcdserverpb.LeaseGrantRequest) (*etcdserverpb.LeaseGrantResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextLease++
+	f.leases[f.nextLease] = &fakeLease{ttl: req.TTL, renewed: time.Now()}
+	return &etcdserverpb.LeaseGrantResponse{Header: f.header(), ID: f.nextLease, TTL: req.TTL}, nil
+}
+
+func (f *fakeEtcd) revokeLocked(id int64) bool {
+	if _, ok := f.leases[id]; !ok {
+		return false
+	}
+	delete(f.leases, id)
+	f.rev++
+	for k, kv := range f.kvs {
+		if kv.Lease == id {
+			delete(f.kvs, k)
+		}
+	}
+	return true
+}
+
+func (f *fakeEtcd) LeaseRevoke(ctx context.Context, req *etcdserverpb.LeaseRevokeRequest) (*etcdserverpb.LeaseRevokeResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.revokeLocked(req.ID) {
+		return nil, rpctypes.ErrGRPCLeaseNotFound
+	}
+	return &etcdserverpb.LeaseRevokeResponse{Header: f.header()}, nil
+}
+
+// LeaseKeepAlive lease 不存在时返回 TTL 0,客户端据此关闭 keepalive channel
+func (f *fakeEtcd) LeaseKeepAlive(stream etcdserverpb.Lease_LeaseKeepAliveServer) error {
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			return nil
+		}
+		f.mu.Lock()
+		var ttl int64
+		if l, ok := f.leases[req.ID]; ok {
+			l.renewed = time.Now()
+			ttl = l.ttl
+		}
+		header := f.header()
+		f.mu.Unlock()
+		if err = stream.Send(&etcdserverpb.LeaseKeepAliveResponse{Header: header, ID: req.ID, TTL: ttl}); err != nil {
+			return nil
+		}
+	}
+}
+
+// LeaseTimeToLive 与 etcd 一致,剩余时间按秒向下取整
+func (f *fakeEtcd) LeaseTimeToLive(ctx context.Context, req *etcdserverpb.LeaseTimeToLiveRequest) (*etcdserverpb.LeaseTimeToLiveResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	l, ok := f.leases[req.ID]
+	if !ok {
+		return &etcdserverpb.LeaseTimeToLiveResponse{Header: f.header(), ID: req.ID, TTL: -1}, nil
+	}
+	remaining := time.Duration(l.ttl)*time.Second - time.Since(l.renewed)
+	return &etcdserverpb.LeaseTimeToLiveResponse{Header: f.header(), ID: req.ID, TTL: int64(remaining.Seconds()), GrantedTTL: l.ttl}, nil
+}
+
+// silence 模拟 lease 已经 d 没有续约
+func (f *fakeEtcd) silence(id clientv3.LeaseID, d time.Duration) {
+	f.mu.Lock()
+	f.leases[int64(id)].renewed = time.Now().Add(-d)
+	f.mu.Unlock()
+}
+
+// expireLease 模拟 lease 过期,删除绑定的 key
+func (f *fakeEtcd) expireLease(id clientv3.LeaseID) {
+	f.mu.Lock()
+	f.revokeLocked(int64(id))
+	f.mu.Unlock()
+}
+
+func (f *fakeEtcd) get(key string) *mvccpb.KeyValue {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.kvs[key]
+}
+
+func newTestEtcdHolder(f *fakeEtcd, port string) *SnowFlakeEtcdHolder {
+	return NewSnowFlakeEtcdHolder("127.0.0.1", port, []string{f.addr}, 3)
+}
+
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return cond()
+}
+
+func TestEtcdHolderAllocateWorkerId(t *testing.T) {
+	setupHolderTest(t)
+	f := newFakeEtcd(t)
+
+	// 并发启动的节点通过 sequence 的 CAS 分配到不同的 workerId
+	holders := make([]*SnowFlakeEtcdHolder, 8)
+	var wg sync.WaitGroup
+	for i := range holders {
+		holders[i] = newTestEtcdHolder(f, fmt.Sprintf("%d", 8001+i))
+		wg.Add(1)
+		go func(h *SnowFlakeEtcdHolder) {
+			defer wg.Done()
+			if !h.Init() {
+				t.Errorf("holder %s init failed", h.listenAddress)
+			}
+		}(holders[i])
+	}
+	wg.Wait()
+	seen := make(map[int]string)
+	for _, h := range holders {
+		if exist, ok := seen[h.GetWorkerId()]; ok {
+			t.Fatalf("workerId %d held by %s and %s", h.GetWorkerId(), exist, h.listenAddress)
+		}
+		seen[h.GetWorkerId()] = h.listenAddress
+	}
+	if kv := f.get(PATH_SEQUENCE); kv == nil || kv.Version != int64(len(holders)) {
+		t.Fatalf("sequence = %+v, want version %d", kv, len(holders))
+	}
+	workerId := holders[0].GetWorkerId()
+	for _, h := range holders {
+		_ = h.Close()
+	}
+
+	// 正常退出会释放 alive 节点,重启后沿用原来的 workerId
+	if kv := f.get(PATH_ALIVE + "/" + holders[0].listenAddress); kv != nil {
+		t.Fatalf("alive key not released: %s", kv.Key)
+	}
+	restarted := newTestEtcdHolder(f, "8001")
+	defer restarted.Close()
+	if !restarted.Init() || restarted.GetWorkerId() != workerId {
+		t.Fatalf("restart got workerId %d, want %d", restarted.GetWorkerId(), workerId)
+	}
+}
+
+func TestEtcdHolderAliveConflict(t *testing.T) {
+	setupHolderTest(t)
+	f := newFakeEtcd(t)
+	c, err := clientv3.New(clientv3.Config{Endpoints: []string{f.addr}, DialTimeout: 3 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	first := newTestEtcdHolder(f, "8001")
+	if !first.Init() {
+		t.Fatal("first init failed")
+	}
+	workerId := first.GetWorkerId()
+	// 同一 ip:port 的另一个实例 nonce 不同,不能撤销正在使用的 lease
+	second := newTestEtcdHolder(f, "8001")
+	if second.Init() {
+		second.Close()
+		t.Fatal("second instance on the same endpoint should fail while the first is alive")
+	}
+	if kv := f.get(PATH_ALIVE + "/127.0.0.1:8001"); kv == nil || kv.Lease != int64(first.leaseId) {
+		t.Fatalf("alive key = %+v, want lease %d of the live instance", kv, first.leaseId)
+	}
+	second.Close()
+	if first.IsLost() {
+		t.Fatal("live instance should keep its workerId")
+	}
+
+	// 模拟进程崩溃,alive 节点和 lease 保留到过期,过期前重启失败
+	first.cancel()
+	first.wg.Wait()
+	first.client.Close()
+	restarted := newTestEtcdHolder(f, "8001")
+	if restarted.Init() {
+		restarted.Close()
+		t.Fatal("restart within lease ttl should fail")
+	}
+	restarted.Close()
+
+	// lease 过期后重启,继续使用原 workerId
+	f.expireLease(first.leaseId)
+	restarted = newTestEtcdHolder(f, "8001")
+	if !restarted.Init() {
+		t.Fatal("restart after lease expired failed")
+	}
+	defer restarted.Close()
+	if restarted.GetWorkerId() != workerId {
+		t.Fatalf("restart got workerId %d, want %d", restarted.GetWorkerId(), workerId)
+	}
+	if kv := f.get(PATH_ALIVE + "/127.0.0.1:8001"); kv == nil || kv.Lease != int64(restarted.leaseId) {
+		t.Fatalf("alive key = %+v, want lease %d", kv, restarted.leaseId)
+	}
+
+	// 同一进程降级后重新注册,alive 节点 nonce 相同,撤销旧 lease 后重新抢占
+	oldLease := restarted.leaseId
+	ok, err := restarted.keepAlive(ctx, restarted.client)
+	if !ok || err != nil {
+		t.Fatalf("reclaim own alive key = %v, %v", ok, err)
+	}
+	if kv := f.get(PATH_ALIVE + "/127.0.0.1:8001"); kv == nil || kv.Lease == int64(oldLease) {
+		t.Fatalf("alive key = %+v, want a new lease", kv)
+	}
+
+	// alive 节点属于其他 endpoint 时不能抢占
+	lease, err := c.Grant(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := new(Endpoint)
+	other.IP = "10.0.0.1"
+	other.Port = "8002"
+	data, _ := json.Marshal(other)
+	if _, err = c.Put(ctx, PATH_ALIVE+"/127.0.0.1:8002", string(data), clientv3.WithLease(lease.ID)); err != nil {
+		t.Fatal(err)
+	}
+	conflict := newTestEtcdHolder(f, "8002")
+	defer conflict.Close()
+	if conflict.Init() {
+		t.Fatal("init should fail when alive key belongs to another endpoint")
+	}
+}
+
+func TestEtcdHolderLeaseExpired(t *testing.T) {
+	setupHolderTest(t)
+	conf.Set("LEAF_SNOWFLAKE_ETCD_LEASE_TTL", "1")
+	defer conf.Set("LEAF_SNOWFLAKE_ETCD_LEASE_TTL", "")
+	f := newFakeEtcd(t)
+
+	h := newTestEtcdHolder(f, "8001")
+	if !h.Init() {
+		t.Fatal("init failed")
+	}
+	defer h.Close()
+	if h.IsLost() {
+		t.Fatal("holder should not be lost after init")
+	}
+	f.expireLease(h.leaseId)
+	if !waitFor(t, 5*time.Second, h.IsLost) {
+		t.Fatal("holder should be lost after lease expired")
+	}
+}
+
+func TestEtcdHolderClockSkewAlivePeers(t *testing.T) {
+	setupHolderTest(t)
+	f := newFakeEtcd(t)
+	c, err := clientv3.New(clientv3.Config{Endpoints: []string{f.addr}, DialTimeout: 3 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	peer := newTestEtcdHolder(f, "8002")
+	if !peer.Init() {
+		t.Fatal("peer init failed")
+	}
+	// 本机时钟比在线节点快一小时
+	past := new(Endpoint)
+	past.IP = "127.0.0.1"
+	past.Port = "8002"
+	past.Timestamp = timeutil.MsTimestampNow() - 3600*1000
+	data, _ := json.Marshal(past)
+	if _, err = c.Put(ctx, peer.etcdAddressNode, string(data)); err != nil {
+		t.Fatal(err)
+	}
+	h := newTestEtcdHolder(f, "8001")
+	if h.Init() {
+		t.Fatal("init should fail when clock skew against alive peers is too large")
+	}
+	_ = h.Close()
+
+	// alive 节点删除后不再参与计算
+	peer.cancel()
+	peer.wg.Wait()
+	_ = peer.client.Close()
+	f.expireLease(peer.leaseId)
+	if _, err = c.Put(ctx, peer.etcdAddressNode, string(data)); err != nil {
+		t.Fatal(err)
+	}
+	restarted := newTestEtcdHolder(f, "8001")
+	defer restarted.Close()
+	if !restarted.Init() {
+		t.Fatal("peers without alive key should be ignored")
+	}
+}
+
+// TestEtcdHolderClockSkewStalePeer 崩溃后 lease 未过期的节点上报时间旧,按 lease 已使用的时长换算后不算作偏差
+func TestEtcdHolderClockSkewStalePeer(t *testing.T) {
+	setupHolderTest(t)
+	conf.Set("LEAF_SNOWFLAKE_ETCD_LEASE_TTL", "30")
+	defer conf.Set("LEAF_SNOWFLAKE_ETCD_LEASE_TTL", "")
+	f := newFakeEtcd(t)
+	c, err := clientv3.New(clientv3.Config{Endpoints: []string{f.addr}, DialTimeout: 3 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	live := newTestEtcdHolder(f, "8002")
+	if !live.Init() {
+		t.Fatal("live peer init failed")
+	}
+	defer live.Close()
+	stale := newTestEtcdHolder(f, "8003")
+	if !stale.Init() {
+		t.Fatal("stale peer init failed")
+	}
+	// 模拟进程 20 秒前最后一次上报后崩溃,alive 节点保留到 lease 过期
+	stale.cancel()
+	stale.wg.Wait()
+	_ = stale.client.Close()
+	silent := 20 * time.Second
+	past := new(Endpoint)
+	past.IP = "127.0.0.1"
+	past.Port = "8003"
+	past.Timestamp = timeutil.MsTimestampNow() - silent.Milliseconds()
+	data, _ := json.Marshal(past)
+	if _, err = c.Put(ctx, stale.etcdAddressNode, string(data)); err != nil {
+		t.Fatal(err)
+	}
+	f.silence(stale.leaseId, silent)
+
+	h := newTestEtcdHolder(f, "8001")
+	defer h.Close()
+	if !h.Init() {
+		t.Fatal("a recently stopped peer should not be counted as clock skew")
+	}
+	if h.clockGuard.IsSkewed() {
+		t.Fatal("clock guard should not be skewed")
+	}
+}
@@ -3,8 +3,8 @@ package service
 import (
 	"context"
 	"fmt"
-	"math/rand"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/spf13/cast"
@@ -15,29 +15,54 @@ import (
 )
 
 var (
-	workerIdBits       = 10
-	maxWorkerId        = ^(-1 << workerIdBits)
-	sequenceBits       = 12
-	workerIdShift      = sequenceBits
-	timestampLeftShift = sequenceBits + workerIdBits
-	sequenceMask       = ^(-1 << sequenceBits)
+	workerIdBits = 10
+	maxWorkerId  = ^(-1 << workerIdBits)
+	sequenceBits = 12
 )
 
+// JS 安全格式: 31 位秒级时间戳 + 10 位 workerId + 12 位序列号,共 53 位,
+// 小于 2^53 可以被 JavaScript Number 精确表示,时间戳可用约 68 年
+var jsSafeTimestampBits = 31
+
+// SnowFlakeHolder workerId 的分配和保活方式
+type SnowFlakeHolder interface {
+	Init() bool
+	GetWorkerId() int
+	// IsLost workerId 可能已被其他节点使用时返回 true,此后拒绝发号
+	IsLost() bool
+	Close() error
+}
+
 type SnowFlakeIdGenImpl struct {
-	twepoch       int64
-	workerId      int64
-	sequence      int64
-	lastTimestamp int64
+	twepoch    int64
+	workerId   int64
+	clockGuard *clockDriftGuard
+	holder     SnowFlakeHolder
+	// 未配置 namespace 的 key 共用默认序列号
+	defaultNamespace *snowflakeNamespace
+	namespaces       map[string]*snowflakeNamespace
+	namespaceBits    int
+	// JS 安全格式按秒计数,序列号和时间戳单独维护
+	jsSafeKeys map[string]bool
+	jsSafe     *snowflakeNamespace
+	// 高 QPS 的 key 从预先填充的 RingBuffer 取号
+	cachedKeys map[string]bool
+	cached     *CachedSnowFlakeIdGenImpl
+	// 兼容 Sonyflake 格式的 key
+	sonyflakeKeys map[string]bool
+	sonyflake     *SonyflakeIdGenImpl
 }
 
 func NewSnowFlakeIdGenImpl(port int, twepoch int64) *SnowFlakeIdGenImpl {
 	s := new(SnowFlakeIdGenImpl)
 	s.twepoch = twepoch
+	s.jsSafeKeys = keySet("LEAF_SNOWFLAKE_JS_SAFE_KEYS")
 	if !(timeutil.MsTimestampNow() > twepoch) {
 		panic("Snowflake not support twepoch gt currentTime")
 	}
 	holderNum := conf.GetInt("LEAF_SNOWFLAKE_HOLDER_FLAG")
-	if holderNum == 1 {
+	switch holderNum {
+	case 1:
 		ip := s.getHostAddress(conf.GetString("LEAF_SNOWFLAKE_ETHER"))
 		zkAddr := conf.GetString("LEAF_SNOWFLAKE_ZK_ADDRESS")
 		if len(zkAddr) == 0 {
@@ -49,8 +74,10 @@ func NewSnowFlakeIdGenImpl(port int, twepoch int64) *SnowFlakeIdGenImpl {
 			panic("Snowflake Id Gen is not init ok")
 		}
 		s.workerId = int64(holder.GetWorkerId())
+		s.holder = holder
+		s.clockGuard = holder.clockGuard
 		logger.Infof("START SUCCESS USE ZK WORKERID-{%d}", s.workerId)
-	} else if holderNum == 2 {
+	case 2:
 		ip := s.getHostAddress(conf.GetString("LEAF_SNOWFLAKE_ETHER"))
 		etcdEndpoints := conf.GetStringSlice("LEAF_SNOWFLAKE_ETCD_SERVERS")
 		if len(etcdEndpoints) == 0 {
@@ -62,54 +89,189 @@ func NewSnowFlakeIdGenImpl(port int, twepoch int64) *SnowFlakeIdGenImpl {
 			panic("Snowflake Id Gen is not init ok")
 		}
 		s.workerId = int64(holder.GetWorkerId())
+		s.holder = holder
+		s.clockGuard = holder.clockGuard
 		logger.Infof("START SUCCESS USE ETCD WORKERID-{%d}", s.workerId)
-	} else {
+	case 3:
+		ip := s.getHostAddress(conf.GetString("LEAF_SNOWFLAKE_ETHER"))
+		redisName := conf.GetString("LEAF_SNOWFLAKE_REDIS_NAME")
+		holder := NewSnowFlakeRedisHolder(ip, fmt.Sprintf("%d", port), redisName, conf.GetInt32("LEAF_SNOWFLAKE_REDIS_SLOT_TTL"))
+		logger.Infof("twepoch:{%d} ,ip:{%s} ,redis:{%s} port:{%d}", twepoch, ip, redisName, port)
+		if !holder.Init() {
+			panic("Snowflake Id Gen is not init ok")
+		}
+		s.workerId = int64(holder.GetWorkerId())
+		s.holder = holder
+		logger.Infof("START SUCCESS USE REDIS WORKERID-{%d}", s.workerId)
+	case 4:
+		ip := s.getHostAddress(conf.GetString("LEAF_SNOWFLAKE_ETHER"))
+		holder := NewSnowFlakeMysqlHolder(ip, fmt.Sprintf("%d", port), conf.GetInt32("LEAF_SNOWFLAKE_MYSQL_STALE_TIMEOUT"))
+		logger.Infof("twepoch:{%d} ,ip:{%s} ,mysql port:{%d}", twepoch, ip, port)
+		if !holder.Init() {
+			panic("Snowflake Id Gen is not init ok")
+		}
+		s.workerId = int64(holder.GetWorkerId())
+		s.holder = holder
+		logger.Infof("START SUCCESS USE MYSQL WORKERID-{%d}", s.workerId)
+	case 5:
+		ordinalEnv := conf.GetString("LEAF_SNOWFLAKE_K8S_ORDINAL_ENV")
+		offset := conf.GetInt("LEAF_SNOWFLAKE_K8S_OFFSET")
+		holder := NewSnowFlakeK8sHolder(fmt.Sprintf("%d", port), conf.Hostname, ordinalEnv, offset)
+		logger.Infof("twepoch:{%d} ,hostname:{%s} ,ordinalEnv:{%s} offset:{%d} port:{%d}", twepoch, conf.Hostname, ordinalEnv, offset, port)
+		if !holder.Init() {
+			panic("Snowflake Id Gen is not init ok")
+		}
+		s.workerId = int64(holder.GetWorkerId())
+		s.holder = holder
+		logger.Infof("START SUCCESS USE K8S WORKERID-{%d}", s.workerId)
+	default:
 		s.workerId = conf.GetInt64("LEAF_SNOWFLAKE_WORKER_ID")
 	}
 	if !(s.workerId >= 0 && s.workerId <= int64(maxWorkerId)) {
 		panic("workerID must gte 0 and lte 1023")
 	}
+	s.initNamespaces()
+	s.initCached()
+	s.initSonyflake()
 	return s
 }
 
+// initSonyflake machineId 默认使用 holder 分配的 workerId,LEAF_SONYFLAKE_MACHINE_ID_SOURCE=env 时
+// 使用环境变量 SNOWFLAKE_MACHINE_ID,便于与已有 Sonyflake 服务统一规划 machineId
+func (s *SnowFlakeIdGenImpl) initSonyflake() {
+	s.sonyflakeKeys = keySet("LEAF_SONYFLAKE_KEYS")
+	var startTime int64
+	if t := conf.GetTime("LEAF_SONYFLAKE_START_TIME"); !t.IsZero() {
+		startTime = t.UnixNano() / int64(time.Millisecond)
+	}
+	machineId := s.workerId
+	if conf.GetString("LEAF_SONYFLAKE_MACHINE_ID_SOURCE") == "env" {
+		machineId = int64(conf.MachineID)
+	}
+	s.sonyflake = NewSonyflakeIdGenImpl(startTime, machineId)
+	if len(s.sonyflakeKeys) > 0 {
+		logger.Infof("sonyflake keys-{%v} machineId-{%d}", s.sonyflakeKeys, machineId)
+	}
+}
+
+func (s *SnowFlakeIdGenImpl) initCached() {
+	s.cachedKeys = keySet("LEAF_SNOWFLAKE_CACHED_KEYS")
+	if len(s.cachedKeys) == 0 {
+		return
+	}
+	// cached 布局保留最大的 namespace 编码,与默认布局和其他 namespace 的 ID 区分开
+	if s.namespaceBits <= 0 {
+		panic("LEAF_SNOWFLAKE_CACHED_KEYS requires LEAF_SNOWFLAKE_NAMESPACE_BITS gt 0")
+	}
+	code := cachedNamespaceCode(s.namespaceBits)
+	for name, ns := range s.namespaces {
+		if ns.layout.namespaceCode == code {
+			panic(fmt.Sprintf("namespace %s code-{%d} is reserved for LEAF_SNOWFLAKE_CACHED_KEYS", name, code))
+		}
+	}
+	s.cached = NewCachedSnowFlakeIdGenImpl(s.twepoch, s.workerId, s.namespaceBits)
+	if !s.cached.Init(context.Background()) {
+		panic("Cached Snowflake Id Gen is not init ok")
+	}
+}
+
+// initNamespaces LEAF_SNOWFLAKE_NAMESPACE_BITS 大于 0 时在 ID 最高位写入 namespace 编码,解析时可据此识别 namespace
+func (s *SnowFlakeIdGenImpl) initNamespaces() {
+	s.namespaceBits = conf.GetInt("LEAF_SNOWFLAKE_NAMESPACE_BITS")
+	layout, err := newSnowflakeLayout(s.twepoch, 1, s.namespaceBits, 63-s.namespaceBits-workerIdBits-sequenceBits, workerIdBits, sequenceBits)
+	if err != nil {
+		panic(fmt.Sprintf("invalid LEAF_SNOWFLAKE_NAMESPACE_BITS:%v", err))
+	}
+	s.defaultNamespace = newSnowflakeNamespace(defaultSnowflakeNamespace, layout)
+	s.namespaces, err = loadSnowflakeNamespaces(s.twepoch, s.namespaceBits, s.workerId)
+	if err != nil {
+		panic(fmt.Sprintf("invalid snowflake namespace:%v", err))
+	}
+	layout, _ = newSnowflakeLayout(s.twepoch, 1000, 0, jsSafeTimestampBits, workerIdBits, sequenceBits)
+	s.jsSafe = newSnowflakeNamespace("jssafe", layout)
+}
+
+// keySet 读取逗号分隔的 key 列表配置
+func keySet(confKey string) map[string]bool {
+	keys := make(map[string]bool)
+	for _, key := range conf.GetStringSlice(confKey) {
+		if key = strings.TrimSpace(key); len(key) > 0 {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+func (s *SnowFlakeIdGenImpl) namespace(key string) *snowflakeNamespace {
+	if ns, ok := s.namespaces[key]; ok {
+		return ns
+	}
+	return s.defaultNamespace
+}
+
 func (s *SnowFlakeIdGenImpl) Init(ctx context.Context) bool {
 	return true
 }
 
+// Close 释放 workerId holder 的心跳协程和连接,本地 workerId 模式无需释放
+func (s *SnowFlakeIdGenImpl) Close() error {
+	if s.cached != nil {
+		_ = s.cached.Close()
+	}
+	if s.holder == nil {
+		return nil
+	}
+	return s.holder.Close()
+}
+
+// WorkerId 当前节点分配到的 workerId
+func (s *SnowFlakeIdGenImpl) WorkerId() int64 {
+	return s.workerId
+}
+
+// Twepoch 默认布局的起始时间戳
+func (s *SnowFlakeIdGenImpl) Twepoch() int64 {
+	return s.twepoch
+}
+
+// IsJsSafeKey key 是否配置为 JS 安全格式
+func (s *SnowFlakeIdGenImpl) IsJsSafeKey(key string) bool {
+	return s.jsSafeKeys[key]
+}
+
 func (s *SnowFlakeIdGenImpl) Get(ctx context.Context, key string) models.Result {
-	var ts = timeutil.MsTimestampNow()
-	if ts > s.lastTimestamp {
-		offset := s.lastTimestamp - ts
-		if offset <= 5 {
-			time.Sleep(time.Duration(offset<<1) * time.Millisecond)
-			ts = timeutil.MsTimestampNow()
-			if ts < s.lastTimestamp {
-				return models.Result{Id: -1, Status: models.EXCEPTION}
-			}
-		} else {
-			return models.Result{Id: -3, Status: models.EXCEPTION}
-		}
+	if s.jsSafeKeys[key] {
+		return s.GetJsSafe(ctx, key)
 	}
-	if ts == s.lastTimestamp {
-		s.sequence = (s.sequence + 1) & int64(sequenceMask)
-		if s.sequence == 0 {
-			s.sequence = int64(rand.Intn(100))
-			ts = s.tilNextMillis(s.lastTimestamp)
-		}
-	} else {
-		s.sequence = int64(rand.Intn(100))
+	if r, ok := s.unavailable(); ok {
+		return r
 	}
-	s.lastTimestamp = ts
-	id := ((ts - s.twepoch) << timestampLeftShift) | (s.workerId << workerIdShift) | s.sequence
-	return models.Result{Id: id, Status: models.SUCCESS}
+	if s.cachedKeys[key] {
+		return s.cached.Get(ctx, key)
+	}
+	if s.sonyflakeKeys[key] {
+		return s.sonyflake.Get(ctx, key)
+	}
+	return s.namespace(key).nextId(s.workerId)
 }
 
-func (s *SnowFlakeIdGenImpl) tilNextMillis(lastTimestamp int64) int64 {
-	var ts = timeutil.MsTimestampNow()
-	for ts <= lastTimestamp {
-		ts = timeutil.MsTimestampNow()
+// GetJsSafe 生成小于 2^53 的 ID,每个 workerId 每秒最多 4096 个
+func (s *SnowFlakeIdGenImpl) GetJsSafe(ctx context.Context, key string) models.Result {
+	if r, ok := s.unavailable(); ok {
+		return r
 	}
-	return ts
+	return s.jsSafe.nextId(s.workerId)
+}
+
+// unavailable 时钟偏差过大或 workerId 已失效时返回对应的异常
+func (s *SnowFlakeIdGenImpl) unavailable() (models.Result, bool) {
+	if s.clockGuard != nil && s.clockGuard.IsSkewed() {
+		return models.NewResult(int64(models.EXCEPTION_ID_CLOCK_SKEW), models.EXCEPTION), true
+	}
+	if s.holder != nil && s.holder.IsLost() {
+		return models.NewResult(int64(models.EXCEPTION_ID_WORKER_ID_LOST), models.EXCEPTION), true
+	}
+	return models.Result{}, false
 }
 
 func (s *SnowFlakeIdGenImpl) getHostAddress(interfaceName string) string {
@@ -159,14 +321,41 @@ func (s *SnowFlakeIdGenImpl) ips() (map[string]string, error) {
 	return ips, nil
 }
 
-func (s *SnowFlakeIdGenImpl) DecodeSnowflakeId(idStr string) map[string]interface{} {
-	var out = make(map[string]interface{}, 0)
+// DecodeSnowflakeId 解析 ID 的时间戳、workerId 和序列号,format 为 jssafe 时按 53 位秒级格式解析,
+// cached 按 RingBuffer 的秒级布局解析,sonyflake 按 Sonyflake 布局解析。未指定 namespace 时,若 ID 带有 namespace 编码则据此识别,
+// 包括 cached 保留的编码,否则按默认布局解析
+func (s *SnowFlakeIdGenImpl) DecodeSnowflakeId(idStr, namespace, format string) map[string]interface{} {
 	var snowflakeId = cast.ToInt64(idStr)
-	originTimestamp := (snowflakeId >> 22) + s.twepoch
-	out["timestamp"] = fmt.Sprintf("%d (%s)", originTimestamp, timeutil.MsTimestamp2Time(originTimestamp).Format("2006-01-02 15:04:05.000"))
-	workerId := (snowflakeId >> 12) ^ (snowflakeId >> 22 << 10)
-	sequence := snowflakeId ^ (snowflakeId >> 12 << 12)
-	out["workerId"] = workerId
-	out["sequenceId"] = sequence
+	switch format {
+	case "jssafe":
+		out := s.jsSafe.layout.decode(snowflakeId)
+		out["format"] = "jssafe"
+		return out
+	case "cached":
+		if s.cached == nil {
+			return map[string]interface{}{"error": "cached snowflake is not enabled"}
+		}
+		return s.cached.Decode(snowflakeId)
+	case "sonyflake":
+		return s.sonyflake.Decode(snowflakeId)
+	}
+	ns := s.defaultNamespace
+	if len(namespace) > 0 {
+		ns = s.namespace(namespace)
+	} else if s.namespaceBits > 0 {
+		code := snowflakeId >> ns.layout.namespaceShift
+		if s.cached != nil && code == s.cached.layout.namespaceCode {
+			return s.cached.Decode(snowflakeId)
+		}
+		for _, item := range s.namespaces {
+			if item.layout.namespaceCode == code {
+				ns = item
+				break
+			}
+		}
+	}
+	out := ns.layout.decode(snowflakeId)
+	out["format"] = "default"
+	out["namespace"] = ns.name
 	return out
 }
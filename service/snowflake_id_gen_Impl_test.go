@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"go.uber.org/atomic"
+
+	"github.com/busyfree/leaf-go/models"
+	"github.com/busyfree/leaf-go/util/conf"
+)
+
+func TestGetJsSafeWithin53Bits(t *testing.T) {
+	conf.Set("LEAF_SNOWFLAKE_HOLDER_FLAG", "0")
+	conf.Set("LEAF_SNOWFLAKE_WORKER_ID", "1023")
+	conf.Set("LEAF_SNOWFLAKE_JS_SAFE_KEYS", "js")
+	defer func() {
+		conf.Set("LEAF_SNOWFLAKE_WORKER_ID", "1")
+		conf.Set("LEAF_SNOWFLAKE_JS_SAFE_KEYS", "")
+	}()
+	s := NewSnowFlakeIdGenImpl(8080, 1288834974657)
+	defer s.Close()
+	const maxSafe = int64(1)<<53 - 1
+
+	// 时间戳、workerId 和序列号都取最大值时刚好是 2^53-1
+	l := s.jsSafe.layout
+	if id := l.compose(l.maxTimestamp, l.maxWorkerId, l.sequenceMask); id != maxSafe {
+		t.Fatalf("max jssafe id = %d, want %d", id, maxSafe)
+	}
+
+	// 超过每秒 4096 个时等待下一秒,ID 仍然递增且不超过 2^53-1
+	ctx := context.Background()
+	var last int64
+	for i := 0; i < 5000; i++ {
+		r := s.Get(ctx, "js")
+		if r.Status != models.SUCCESS || r.Id <= last || r.Id > maxSafe {
+			t.Fatalf("id %d after %d status %d", r.Id, last, r.Status)
+		}
+		last = r.Id
+	}
+	if out := s.DecodeSnowflakeId(strconv.FormatInt(last, 10), "", "jssafe"); out["workerId"] != int64(1023) {
+		t.Fatalf("decode jssafe id: %+v", out)
+	}
+}
+
+// newBenchSnowflake 使用本地 workerId,不会向 zk/etcd 等注册节点
+func newBenchSnowflake(b *testing.B) *SnowFlakeIdGenImpl {
+	conf.Set("LEAF_SNOWFLAKE_HOLDER_FLAG", "0")
+	conf.Set("LEAF_SNOWFLAKE_WORKER_ID", "1")
+	s := NewSnowFlakeIdGenImpl(8080, 1288834974657)
+	b.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+// benchParallel 并发调用 get,失败的次数以 failed/op 上报
+func benchParallel(b *testing.B, get func() models.Result) {
+	failed := atomic.NewInt64(0)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var n int64
+		for pb.Next() {
+			if get().Status != models.SUCCESS {
+				n++
+			}
+		}
+		failed.Add(n)
+	})
+	b.StopTimer()
+	b.ReportMetric(float64(failed.Load())/float64(b.N), "failed/op")
+}
+
+func BenchmarkSnowflakeGet(b *testing.B) {
+	s := newBenchSnowflake(b)
+	ctx := context.Background()
+	benchParallel(b, func() models.Result { return s.Get(ctx, "bench") })
+}
+
+// BenchmarkSnowflakeGetJsSafe JS 安全格式每秒最多 4096 个,主要用于观察达到上限后的等待开销
+func BenchmarkSnowflakeGetJsSafe(b *testing.B) {
+	s := newBenchSnowflake(b)
+	ctx := context.Background()
+	benchParallel(b, func() models.Result { return s.GetJsSafe(ctx, "bench") })
+}
+
+func BenchmarkCachedSnowflakeGet(b *testing.B) {
+	conf.Set("LEAF_SNOWFLAKE_CACHED_MAX_BORROW", "1")
+	defer conf.Set("LEAF_SNOWFLAKE_CACHED_MAX_BORROW", "")
+	oldPath := CACHED_BORROW_PATH
+	CACHED_BORROW_PATH = filepath.Join(b.TempDir(), "{workerId}.borrow")
+	defer func() { CACHED_BORROW_PATH = oldPath }()
+	s := newBenchSnowflake(b)
+	ctx := context.Background()
+	cached := NewCachedSnowFlakeIdGenImpl(s.Twepoch(), s.WorkerId(), 1)
+	cached.Init(ctx)
+	defer cached.Close()
+	benchParallel(b, func() models.Result { return cached.Get(ctx, "bench") })
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/busyfree/leaf-go/util/timeutil"
+)
+
+// SnowFlakeK8sHolder 使用 StatefulSet 的 pod 序号作为 workerId,不依赖外部协调服务。
+// 序号优先从 Downward API 注入的环境变量读取,否则解析主机名 {statefulset}-{ordinal} 的后缀
+type SnowFlakeK8sHolder struct {
+	port           string
+	hostname       string
+	ordinalEnv     string
+	offset         int
+	lastUpdateTime int64
+	ctx            context.Context
+	cancel         context.CancelFunc
+	wg             sync.WaitGroup
+	WorkerId       int
+}
+
+func NewSnowFlakeK8sHolder(port, hostname, ordinalEnv string, offset int) *SnowFlakeK8sHolder {
+	s := new(SnowFlakeK8sHolder)
+	s.port = port
+	s.hostname = hostname
+	s.ordinalEnv = ordinalEnv
+	s.offset = offset
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+func (s *SnowFlakeK8sHolder) Init() bool {
+	ordinal, err := s.ordinal()
+	if err != nil {
+		logger.Errorf("START FAILED ,%+v", err)
+		return false
+	}
+	workerId := ordinal + s.offset
+	if workerId < 0 || workerId > maxWorkerId {
+		logger.Errorf("START FAILED ,ordinal-{%d} offset-{%d} workerId out of range [0,%d]", ordinal, s.offset, maxWorkerId)
+		return false
+	}
+	s.WorkerId = workerId
+	if !s.checkInitTimeStamp() {
+		return false
+	}
+	s.updateNewData()
+	s.doService()
+	logger.Infof("[K8S NODE]hostname-{%s} ordinal-{%d} offset-{%d} workid-{%d} start SUCCESS", s.hostname, ordinal, s.offset, s.WorkerId)
+	return true
+}
+
+func (s *SnowFlakeK8sHolder) ordinal() (int, error) {
+	if len(s.ordinalEnv) > 0 {
+		if val := os.Getenv(s.ordinalEnv); len(val) > 0 {
+			ordinal, err := strconv.Atoi(val)
+			if err != nil {
+				return 0, fmt.Errorf("invalid ordinal env %s=%s", s.ordinalEnv, val)
+			}
+			return ordinal, nil
+		}
+	}
+	idx := strings.LastIndex(s.hostname, "-")
+	if idx < 0 || idx == len(s.hostname)-1 {
+		return 0, fmt.Errorf("hostname %s has no statefulset ordinal", s.hostname)
+	}
+	ordinal, err := strconv.Atoi(s.hostname[idx+1:])
+	if err != nil {
+		return 0, fmt.Errorf("hostname %s has no statefulset ordinal", s.hostname)
+	}
+	return ordinal, nil
+}
+
+// checkInitTimeStamp 本地时间不能落后于 workerID.toml 中最后记录的时间
+func (s *SnowFlakeK8sHolder) checkInitTimeStamp() bool {
+	local, err := readLocalWorkerID(s.port)
+	if err != nil {
+		logger.Infof("no local workerID file, skip timestamp check:%v", err)
+		return true
+	}
+	if local.Timestamp > timeutil.MsTimestampNow() {
+		logger.Errorf("START FAILED ,local file timestamp-{%d} is bigger than local time", local.Timestamp)
+		return false
+	}
+	if local.WorkerID != s.WorkerId {
+		logger.Warnf("local file workerID-{%d} differs from current workerID-{%d}", local.WorkerID, s.WorkerId)
+	}
+	return true
+}
+
+func (s *SnowFlakeK8sHolder) doService() {
+	s.wg.Add(1)
+	go s.scheduledUploadData()
+}
+
+func (s *SnowFlakeK8sHolder) scheduledUploadData() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(time.Duration(3) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.updateNewData()
+		}
+	}
+}
+
+func (s *SnowFlakeK8sHolder) updateNewData() {
+	if timeutil.MsTimestampNow() < s.lastUpdateTime {
+		return
+	}
+	err := writeLocalWorkerID(s.port, s.WorkerId, timeutil.MsTimestampNow())
+	if err != nil {
+		logger.Infof("%+v", err)
+		return
+	}
+	s.lastUpdateTime = timeutil.MsTimestampNow()
+	return
+}
+
+// IsLost workerId 由 pod 序号决定,不会被其他节点占用
+func (s *SnowFlakeK8sHolder) IsLost() bool {
+	return false
+}
+
+func (s *SnowFlakeK8sHolder) GetWorkerId() int {
+	return s.WorkerId
+}
+
+// Close 停止心跳并写入最后一次时间戳
+func (s *SnowFlakeK8sHolder) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	s.updateNewData()
+	return nil
+}
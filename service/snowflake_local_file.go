@@ -0,0 +1,85 @@
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/busyfree/leaf-go/util/check"
+	"github.com/busyfree/leaf-go/util/timeutil"
+)
+
+// LocalWorkerID 本地缓存的 workerId 及最后一次上报的时间戳,按端口保存在 PROP_PATH
+type LocalWorkerID struct {
+	WorkerID  int
+	Timestamp int64
+}
+
+func localWorkerIDFilePath(port string) string {
+	return strings.Replace(PROP_PATH, "{port}", port, -1)
+}
+
+// readLocalWorkerID 读取 writeLocalWorkerID 写入的 workerID.toml
+func readLocalWorkerID(port string) (*LocalWorkerID, error) {
+	filePath := localWorkerIDFilePath(port)
+	v := viper.New()
+	v.SetConfigFile(filePath)
+	v.SetConfigType("toml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	if !v.IsSet("workerID") {
+		return nil, fmt.Errorf("missing workerID in %s", filePath)
+	}
+	local := new(LocalWorkerID)
+	local.WorkerID = v.GetInt("workerID")
+	local.Timestamp = v.GetInt64("timestamp")
+	return local, nil
+}
+
+func writeLocalWorkerID(port string, workerId int, timestamp int64) error {
+	filePath := localWorkerIDFilePath(port)
+	if !check.CheckFileExist(filePath) {
+		err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm)
+		if err != nil {
+			return err
+		}
+	}
+	data := fmt.Sprintf("workerID=%d\ntimestamp=%d\n", workerId, timestamp)
+	return ioutil.WriteFile(filePath, []byte(data), os.ModePerm)
+}
+
+// loadLocalWorkerID 协调服务不可用时读取本地 workerId,本机时间必须晚于文件中记录的最后时间
+func loadLocalWorkerID(port string) (int, bool) {
+	local, err := readLocalWorkerID(port)
+	if err != nil {
+		logger.Errorf("START FAILED ,read local workerID file error:%v", err)
+		return 0, false
+	}
+	if local.Timestamp <= 0 {
+		logger.Errorf("START FAILED ,local workerID file has no timestamp, can not check clock")
+		return 0, false
+	}
+	now := timeutil.MsTimestampNow()
+	if local.Timestamp > now {
+		logger.Errorf("START FAILED ,local file timestamp-{%d} is bigger than local time-{%d}", local.Timestamp, now)
+		return 0, false
+	}
+	if local.WorkerID < 0 || local.WorkerID > maxWorkerId {
+		logger.Errorf("START FAILED ,local file workerID-{%d} out of range [0,%d]", local.WorkerID, maxWorkerId)
+		return 0, false
+	}
+	return local.WorkerID, true
+}
+
+// saveLocalWorkerID 以当前时间更新本地 workerId 文件,失败只记录日志
+func saveLocalWorkerID(port string, workerId int) {
+	err := writeLocalWorkerID(port, workerId, timeutil.MsTimestampNow())
+	if err != nil {
+		logger.Infof("%+v", err)
+	}
+}
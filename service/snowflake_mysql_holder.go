@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+
+	"github.com/busyfree/leaf-go/dao"
+	"github.com/busyfree/leaf-go/util/db"
+	"github.com/busyfree/leaf-go/util/timeutil"
+)
+
+// SnowFlakeMysqlHolder 使用 leaf_worker_node 表分配 workerId,
+// 依赖 ip:port 和 worker_id 两个唯一键保证并发启动时不会重复分配,
+// 没有空闲 workerId 时回收心跳超过 staleTimeout 秒的节点。
+// heartbeat 列使用数据库时间,last_timestamp 列是本节点的本机时间,只用于本节点重启时校验时钟回拨。
+// 建表语句见 models/schema/leaf_worker_node.sql
+type SnowFlakeMysqlHolder struct {
+	ip             string
+	port           string
+	listenAddress  string
+	staleTimeout   int32
+	lastUpdateTime int64
+	lost           *atomic.Bool
+	ctx            context.Context
+	cancel         context.CancelFunc
+	wg             sync.WaitGroup
+	WorkerId       int
+}
+
+func NewSnowFlakeMysqlHolder(ip, port string, staleTimeout int32) *SnowFlakeMysqlHolder {
+	s := new(SnowFlakeMysqlHolder)
+	s.ip = ip
+	s.port = port
+	s.listenAddress = ip + ":" + port
+	// 回收时间需要明显大于 3 秒的心跳间隔
+	if staleTimeout <= 0 {
+		staleTimeout = 600
+	}
+	s.staleTimeout = staleTimeout
+	s.lost = atomic.NewBool(false)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+func (s *SnowFlakeMysqlHolder) Init() bool {
+	ctx := context.Background()
+	node := dao.NewLeafWorkerNodeDao()
+	err := node.GetByEndpoint(ctx, s.ip, s.port)
+	if err == nil {
+		s.WorkerId = node.WorkerId
+		if !s.checkInitTimeStamp(node) {
+			logger.Errorf("START FAILED ,last_timestamp-{%d} of workerID-{%d} is bigger than local time", node.LastTimestamp, node.WorkerId)
+			return false
+		}
+		s.doService()
+		saveLocalWorkerID(s.port, s.WorkerId)
+		logger.Infof("[Old NODE]find worker node have this endpoint ip-{%s} port-{%s} workid-{%d} and start SUCCESS", s.ip, s.port, s.WorkerId)
+		return true
+	}
+	if !db.IsNoRowsErr(err) {
+		logger.Errorf("leafWorkerNodeDao.GetByEndpointErr:%+v", err)
+		return false
+	}
+	workerId, err := s.createNode(ctx)
+	if err != nil {
+		logger.Errorf("create worker node error:%+v", err)
+		return false
+	}
+	s.WorkerId = workerId
+	s.doService()
+	saveLocalWorkerID(s.port, s.WorkerId)
+	logger.Infof("[New NODE]can not find worker node that endpoint ip-{%s} port-{%s} workid-{%d},create own node and start SUCCESS", s.ip, s.port, s.WorkerId)
+	return true
+}
+
+// createNode 选取最小的空闲 workerId 写入,唯一键冲突说明被并发启动的节点抢先,重新选取
+func (s *SnowFlakeMysqlHolder) createNode(ctx context.Context) (int, error) {
+	for {
+		node := dao.NewLeafWorkerNodeDao()
+		workerIds, err := node.GetAllWorkerIds(ctx)
+		if err != nil {
+			return 0, err
+		}
+		used := make(map[int]bool, len(workerIds))
+		for _, id := range workerIds {
+			used[id] = true
+		}
+		workerId := -1
+		for i := 0; i <= maxWorkerId; i++ {
+			if !used[i] {
+				workerId = i
+				break
+			}
+		}
+		if workerId < 0 {
+			return s.takeOverStaleNode(ctx)
+		}
+		node.Ip = s.ip
+		node.Port = s.port
+		node.WorkerId = workerId
+		node.LastTimestamp = timeutil.MsTimestampNow()
+		node.Heartbeat, err = node.DbNow(ctx)
+		if err != nil {
+			return 0, err
+		}
+		err = node.Insert(ctx)
+		if err == nil {
+			return workerId, nil
+		}
+		if !db.IsDuplicateEntryErr(err) {
+			return 0, err
+		}
+		exist := dao.NewLeafWorkerNodeDao()
+		if exist.GetByEndpoint(ctx, s.ip, s.port) == nil {
+			return 0, fmt.Errorf("endpoint %s was registered concurrently with workerId-{%d}", s.listenAddress, exist.WorkerId)
+		}
+		logger.Infof("workerId-{%d} was taken by another node, retry", workerId)
+	}
+}
+
+// takeOverStaleNode 按 workerId 从小到大尝试回收心跳超时的节点,条件更新失败说明被其他节点抢先或原节点恢复了心跳
+func (s *SnowFlakeMysqlHolder) takeOverStaleNode(ctx context.Context) (int, error) {
+	dbNow, err := dao.NewLeafWorkerNodeDao().DbNow(ctx)
+	if err != nil {
+		return 0, err
+	}
+	staleBefore := dbNow - int64(s.staleTimeout)*1000
+	workerIds, err := dao.NewLeafWorkerNodeDao().GetStaleWorkerIds(ctx, staleBefore)
+	if err != nil {
+		return 0, err
+	}
+	now := timeutil.MsTimestampNow()
+	for _, workerId := range workerIds {
+		node := dao.NewLeafWorkerNodeDao()
+		node.Ip = s.ip
+		node.Port = s.port
+		node.WorkerId = workerId
+		node.LastTimestamp = now
+		node.Heartbeat = dbNow
+		ok, err := node.TakeOver(ctx, staleBefore)
+		if err != nil && !db.IsDuplicateEntryErr(err) {
+			return 0, err
+		}
+		if ok {
+			logger.Infof("take over stale workerId-{%d} for endpoint {%s}", workerId, s.listenAddress)
+			return workerId, nil
+		}
+	}
+	return 0, fmt.Errorf("workerId exhausted, all %d workerIds are in use", maxWorkerId+1)
+}
+
+func (s *SnowFlakeMysqlHolder) doService() {
+	s.lastUpdateTime = timeutil.MsTimestampNow()
+	s.wg.Add(1)
+	go s.scheduledUploadData()
+}
+
+func (s *SnowFlakeMysqlHolder) scheduledUploadData() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(time.Duration(3) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.updateNewData(context.Background())
+		}
+	}
+}
+
+func (s *SnowFlakeMysqlHolder) updateNewData(ctx context.Context) {
+	if s.lost.Load() || timeutil.MsTimestampNow() < s.lastUpdateTime {
+		return
+	}
+	node := dao.NewLeafWorkerNodeDao()
+	node.Ip = s.ip
+	node.Port = s.port
+	node.WorkerId = s.WorkerId
+	node.LastTimestamp = timeutil.MsTimestampNow()
+	ok := false
+	var err error
+	node.Heartbeat, err = node.DbNow(ctx)
+	if err == nil {
+		ok, err = node.UpdateHeartbeat(ctx)
+	}
+	if err != nil {
+		logger.Errorf("update worker node heartbeat error:%+v", err)
+		// 超过 staleTimeout 没有上报心跳时 workerId 可能已被其他节点回收
+		if s.lastUpdateTime > 0 && timeutil.MsTimestampNow()-s.lastUpdateTime > int64(s.staleTimeout)*1000 {
+			logger.Errorf("heartbeat of workerId-{%d} expired, refuse to serve", s.WorkerId)
+			s.lost.Store(true)
+		}
+		return
+	}
+	if !ok {
+		logger.Errorf("workerId-{%d} of endpoint {%s} was taken over by another node, refuse to serve", s.WorkerId, s.listenAddress)
+		s.lost.Store(true)
+		return
+	}
+	saveLocalWorkerID(s.port, s.WorkerId)
+	s.lastUpdateTime = timeutil.MsTimestampNow()
+	return
+}
+
+func (s *SnowFlakeMysqlHolder) checkInitTimeStamp(node *dao.LeafWorkerNodeDao) bool {
+	return !(node.LastTimestamp > timeutil.MsTimestampNow())
+}
+
+func (s *SnowFlakeMysqlHolder) IsLost() bool {
+	return s.lost.Load()
+}
+
+func (s *SnowFlakeMysqlHolder) GetWorkerId() int {
+	return s.WorkerId
+}
+
+// Close 停止心跳并上报最后一次时间戳
+func (s *SnowFlakeMysqlHolder) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	s.updateNewData(context.Background())
+	return nil
+}
@@ -0,0 +1,366 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/db"
+	"github.com/busyfree/leaf-go/util/timeutil"
+)
+
+type fakeWorkerNode struct {
+	id, workerId             int64
+	ip, port                 string
+	lastTimestamp, heartbeat int64
+}
+
+// fakeMysql 进程内的 mysql 替身,实现 mysql 文本协议中 holder 用到的几条 leaf_worker_node 语句,
+// 客户端需开启 interpolateParams,数据库时间为本机时间加上 offset
+type fakeMysql struct {
+	mu     sync.Mutex
+	nodes  []*fakeWorkerNode
+	nextId int64
+	offset time.Duration
+	addr   string
+}
+
+var fakeMysqlLiteral = regexp.MustCompile(`'((?:[^'\\]|\\.)*)'|\b(-?\d+)\b`)
+
+func newFakeMysql(t *testing.T) *fakeMysql {
+	f := new(fakeMysql)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.addr = ln.Addr().String()
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	// db 连接池按配置名缓存,每个测试重新连接到自己的替身
+	conf.Set("HOT_LOAD_DB", "true")
+	conf.Set("DB_default_DSN", "root:@tcp("+f.addr+")/leaf?interpolateParams=true")
+	db.Reset()
+	t.Cleanup(db.Reset)
+	return f
+}
+
+func (f *fakeMysql) now() int64 {
+	return timeutil.MsTimestampNow() + f.offset.Milliseconds()
+}
+
+func (f *fakeMysql) node(workerId int64) *fakeWorkerNode {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, n := range f.nodes {
+		if n.workerId == workerId {
+			copied := *n
+			return &copied
+		}
+	}
+	return nil
+}
+
+func (f *fakeMysql) insert(ip, port string, workerId, lastTimestamp, heartbeat int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextId++
+	f.nodes = append(f.nodes, &fakeWorkerNode{id: f.nextId, workerId: workerId, ip: ip, port: port, lastTimestamp: lastTimestamp, heartbeat: heartbeat})
+}
+
+func writeMysqlPacket(w io.Writer, seq byte, payload []byte) error {
+	header := []byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), seq}
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+func readMysqlPacket(r io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+	_, err := io.ReadFull(r, payload)
+	return payload, err
+}
+
+func mysqlLenEncString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)))
+	return append(b, s...)
+}
+
+func mysqlOk(affected int64) []byte {
+	return []byte{0x00, byte(affected), 0x00, 0x02, 0x00, 0x00, 0x00}
+}
+
+func mysqlErr(code uint16, msg string) []byte {
+	b := []byte{0xff, byte(code), byte(code >> 8), '#'}
+	b = append(b, "23000"...)
+	return append(b, msg...)
+}
+
+func (f *fakeMysql) serve(conn net.Conn) {
+	defer conn.Close()
+	// Handshake V10,声明 CLIENT_PROTOCOL_41 和 mysql_native_password
+	handshake := []byte{10}
+	handshake = append(handshake, "5.7.0-fake\x00"...)
+	handshake = append(handshake, 1, 0, 0, 0)
+	handshake = append(handshake, "abcdefgh"...)
+	handshake = append(handshake, 0)
+	capability := uint32(0x00000001 | 0x00000200 | 0x00002000 | 0x00008000 | 0x00080000)
+	handshake = append(handshake, byte(capability), byte(capability>>8))
+	handshake = append(handshake, 33, 0x02, 0x00)
+	handshake = append(handshake, byte(capability>>16), byte(capability>>24))
+	handshake = append(handshake, 21)
+	handshake = append(handshake, make([]byte, 10)...)
+	handshake = append(handshake, "ijklmnopqrst\x00"...)
+	handshake = append(handshake, "mysql_native_password\x00"...)
+	if writeMysqlPacket(conn, 0, handshake) != nil {
+		return
+	}
+	if _, err := readMysqlPacket(conn); err != nil {
+		return
+	}
+	if writeMysqlPacket(conn, 2, mysqlOk(0)) != nil {
+		return
+	}
+	for {
+		packet, err := readMysqlPacket(conn)
+		if err != nil || len(packet) == 0 {
+			return
+		}
+		switch packet[0] {
+		case 0x01:
+			return
+		case 0x03:
+			if f.query(conn, string(packet[1:])) != nil {
+				return
+			}
+		default:
+			if writeMysqlPacket(conn, 1, mysqlOk(0)) != nil {
+				return
+			}
+		}
+	}
+}
+
+// query 返回结果集或 OK/ERR 包,结果集的列都按字符串返回
+func (f *fakeMysql) query(conn net.Conn, sqlStr string) error {
+	columns, rows, affected, errPacket := f.exec(sqlStr)
+	if errPacket != nil {
+		return writeMysqlPacket(conn, 1, errPacket)
+	}
+	if columns == nil {
+		return writeMysqlPacket(conn, 1, mysqlOk(affected))
+	}
+	seq := byte(1)
+	packets := [][]byte{{byte(len(columns))}}
+	for _, name := range columns {
+		def := mysqlLenEncString(nil, "def")
+		def = mysqlLenEncString(def, "leaf")
+		def = mysqlLenEncString(def, "leaf_worker_node")
+		def = mysqlLenEncString(def, "leaf_worker_node")
+		def = mysqlLenEncString(def, name)
+		def = mysqlLenEncString(def, name)
+		def = append(def, 0x0c, 33, 0, 0xff, 0, 0, 0, 0xfd, 0, 0, 0, 0, 0)
+		packets = append(packets, def)
+	}
+	eof := []byte{0xfe, 0, 0, 0x02, 0}
+	packets = append(packets, eof)
+	for _, row := range rows {
+		var b []byte
+		for _, v := range row {
+			b = mysqlLenEncString(b, v)
+		}
+		packets = append(packets, b)
+	}
+	packets = append(packets, eof)
+	for _, p := range packets {
+		if err := writeMysqlPacket(conn, seq, p); err != nil {
+			return err
+		}
+		seq++
+	}
+	return nil
+}
+
+func (f *fakeMysql) exec(sqlStr string) (columns []string, rows [][]string, affected int64, errPacket []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if sqlStr == "SELECT ROUND(UNIX_TIMESTAMP(NOW(3))*1000)" {
+		return []string{"now"}, [][]string{{strconv.FormatInt(f.now(), 10)}}, 0, nil
+	}
+	var strs []string
+	var ints []int64
+	for _, m := range fakeMysqlLiteral.FindAllStringSubmatch(sqlStr[strings.Index(sqlStr, "leaf_worker_node"):], -1) {
+		if len(m[2]) > 0 {
+			n, _ := strconv.ParseInt(m[2], 10, 64)
+			ints = append(ints, n)
+		} else {
+			strs = append(strs, m[1])
+		}
+	}
+	duplicate := func(self *fakeWorkerNode, ip, port string, workerId int64) []byte {
+		for _, n := range f.nodes {
+			if n != self && ((n.ip == ip && n.port == port) || n.workerId == workerId) {
+				return mysqlErr(1062, "Duplicate entry")
+			}
+		}
+		return nil
+	}
+	switch {
+	case strings.HasPrefix(sqlStr, "SELECT id, ip, port, worker_id, last_timestamp, heartbeat FROM"):
+		columns = []string{"id", "ip", "port", "worker_id", "last_timestamp", "heartbeat"}
+		for _, n := range f.nodes {
+			if n.ip == strs[0] && n.port == strs[1] {
+				rows = append(rows, []string{fmt.Sprint(n.id), n.ip, n.port, fmt.Sprint(n.workerId), fmt.Sprint(n.lastTimestamp), fmt.Sprint(n.heartbeat)})
+			}
+		}
+	case strings.HasPrefix(sqlStr, "SELECT worker_id FROM"):
+		columns = []string{"worker_id"}
+		for _, n := range f.nodes {
+			if !strings.Contains(sqlStr, "heartbeat <") || n.heartbeat < ints[0] {
+				rows = append(rows, []string{fmt.Sprint(n.workerId)})
+			}
+		}
+	case strings.HasPrefix(sqlStr, "INSERT INTO"):
+		if errPacket = duplicate(nil, strs[0], strs[1], ints[0]); errPacket == nil {
+			f.nextId++
+			f.nodes = append(f.nodes, &fakeWorkerNode{id: f.nextId, ip: strs[0], port: strs[1], workerId: ints[0], lastTimestamp: ints[1], heartbeat: ints[2]})
+			affected = 1
+		}
+	case strings.Contains(sqlStr, "SET ip = "):
+		// TakeOver: ip, port, last_timestamp, heartbeat, update_time, worker_id, heartbeat <, last_timestamp <=
+		for _, n := range f.nodes {
+			if n.workerId == ints[3] && n.heartbeat < ints[4] && n.lastTimestamp <= ints[5] {
+				if errPacket = duplicate(n, strs[0], strs[1], n.workerId); errPacket == nil {
+					n.ip, n.port, n.lastTimestamp, n.heartbeat = strs[0], strs[1], ints[0], ints[1]
+					affected = 1
+				}
+			}
+		}
+	case strings.Contains(sqlStr, "SET last_timestamp = "):
+		// UpdateHeartbeat: last_timestamp, heartbeat, update_time, ip, port, worker_id
+		for _, n := range f.nodes {
+			if n.ip == strs[0] && n.port == strs[1] && n.workerId == ints[3] {
+				if n.lastTimestamp != ints[0] || n.heartbeat != ints[1] {
+					affected = 1
+				}
+				n.lastTimestamp, n.heartbeat = ints[0], ints[1]
+			}
+		}
+	default:
+		errPacket = mysqlErr(1064, "unsupported statement: "+sqlStr)
+	}
+	return
+}
+
+func TestMysqlHolderRegister(t *testing.T) {
+	setupHolderTest(t)
+	f := newFakeMysql(t)
+
+	first := NewSnowFlakeMysqlHolder("10.0.0.1", "8001", 600)
+	if !first.Init() {
+		t.Fatal("first init failed")
+	}
+	second := NewSnowFlakeMysqlHolder("10.0.0.1", "8002", 600)
+	if !second.Init() {
+		t.Fatal("second init failed")
+	}
+	if first.GetWorkerId() == second.GetWorkerId() {
+		t.Fatalf("two endpoints hold the same workerId %d", first.GetWorkerId())
+	}
+	// heartbeat 使用数据库时间
+	f.mu.Lock()
+	f.offset = -time.Hour
+	f.mu.Unlock()
+	first.updateNewData(context.Background())
+	if n := f.node(int64(first.GetWorkerId())); n == nil || timeutil.MsTimestampNow()-n.heartbeat < int64(50*time.Minute/time.Millisecond) {
+		t.Fatalf("heartbeat = %+v, want database time", n)
+	}
+	workerId := first.GetWorkerId()
+	_ = first.Close()
+	_ = second.Close()
+
+	restarted := NewSnowFlakeMysqlHolder("10.0.0.1", "8001", 600)
+	defer restarted.Close()
+	if !restarted.Init() || restarted.GetWorkerId() != workerId {
+		t.Fatalf("restart got workerId %d, want %d", restarted.GetWorkerId(), workerId)
+	}
+}
+
+// TestMysqlHolderTakeOverByDbTime 数据库时钟比本机慢一小时,按本机时间所有节点都像心跳超时,
+// 按数据库时间只有真正停止心跳的节点会被回收,原节点发现 workerId 被回收后拒绝发号
+func TestMysqlHolderTakeOverByDbTime(t *testing.T) {
+	setupHolderTest(t)
+	f := newFakeMysql(t)
+	f.offset = -time.Hour
+	now := timeutil.MsTimestampNow()
+	dbNow := f.now()
+	for i := 0; i <= maxWorkerId; i++ {
+		heartbeat := dbNow
+		if i == 5 {
+			heartbeat = dbNow - 700*1000
+		}
+		f.insert("10.0.1.1", fmt.Sprint(9000+i), int64(i), now-1000, heartbeat)
+	}
+
+	old := NewSnowFlakeMysqlHolder("10.0.1.1", "9005", 600)
+	old.WorkerId = 5
+	h := NewSnowFlakeMysqlHolder("10.0.0.1", "8001", 600)
+	if !h.Init() {
+		t.Fatal("init should take over the stale workerId")
+	}
+	defer h.Close()
+	if h.GetWorkerId() != 5 {
+		t.Fatalf("took over workerId %d, want 5", h.GetWorkerId())
+	}
+	if n := f.node(5); n.ip != "10.0.0.1" || n.port != "8001" {
+		t.Fatalf("workerId 5 owner = %s:%s", n.ip, n.port)
+	}
+	old.updateNewData(context.Background())
+	if !old.IsLost() {
+		t.Fatal("old holder should be lost after its workerId was taken over")
+	}
+
+	// 没有心跳超时的节点时启动失败
+	other := NewSnowFlakeMysqlHolder("10.0.0.1", "8002", 600)
+	if other.Init() {
+		other.Close()
+		t.Fatal("init should fail when no workerId is stale by database time")
+	}
+}
+
+// TestMysqlHolderTakeOverClockBehind 原节点 last_timestamp 晚于本机时间时不能回收,否则可能生成重复 ID
+func TestMysqlHolderTakeOverClockBehind(t *testing.T) {
+	setupHolderTest(t)
+	f := newFakeMysql(t)
+	dbNow := f.now()
+	for i := 0; i <= maxWorkerId; i++ {
+		heartbeat := dbNow
+		if i == 7 {
+			heartbeat = dbNow - 700*1000
+		}
+		f.insert("10.0.1.1", fmt.Sprint(9000+i), int64(i), timeutil.MsTimestampNow()+3600*1000, heartbeat)
+	}
+	h := NewSnowFlakeMysqlHolder("10.0.0.1", "8001", 600)
+	if h.Init() {
+		h.Close()
+		t.Fatal("init should fail when the stale node generated ids ahead of local time")
+	}
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/busyfree/leaf-go/models"
+	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/metrics"
+	"github.com/busyfree/leaf-go/util/timeutil"
+)
+
+const defaultSnowflakeNamespace = "default"
+
+// 序列号用尽时的处理方式
+const (
+	// overflowSpin 忙等到下一个刻度,延迟最低但占满 CPU
+	overflowSpin = "spin"
+	// overflowSleep 休眠到下一个刻度
+	overflowSleep = "sleep"
+	// overflowBorrow 预借未来的刻度,领先当前时间不超过 maxBorrow 个刻度,超出时休眠等待
+	overflowBorrow = "borrow"
+	// overflowReject 直接返回 EXCEPTION_ID_SEQUENCE_OVERFLOW
+	overflowReject = "reject"
+)
+
+// snowflakeLayout ID 的位布局,从高到低依次为 namespace 编码、时间戳、workerId、序列号
+type snowflakeLayout struct {
+	twepoch            int64
+	timeUnit           int64 // 每个时间戳刻度的毫秒数,默认 1,JS 安全格式为 1000
+	namespaceBits      int
+	namespaceCode      int64
+	timestampBits      int
+	workerIdBits       int
+	sequenceBits       int
+	workerIdShift      int
+	timestampLeftShift int
+	namespaceShift     int
+	sequenceMask       int64
+	maxWorkerId        int64
+	maxTimestamp       int64
+}
+
+func newSnowflakeLayout(twepoch, timeUnit int64, namespaceBits, timestampBits, workerIdBits, sequenceBits int) (*snowflakeLayout, error) {
+	if workerIdBits <= 0 || sequenceBits <= 0 || timestampBits <= 0 || namespaceBits < 0 {
+		return nil, fmt.Errorf("invalid bits namespace-{%d} timestamp-{%d} workerId-{%d} sequence-{%d}", namespaceBits, timestampBits, workerIdBits, sequenceBits)
+	}
+	if namespaceBits+timestampBits+workerIdBits+sequenceBits > 63 {
+		return nil, fmt.Errorf("total bits %d exceeds 63", namespaceBits+timestampBits+workerIdBits+sequenceBits)
+	}
+	l := new(snowflakeLayout)
+	l.twepoch = twepoch
+	l.timeUnit = timeUnit
+	l.namespaceBits = namespaceBits
+	l.timestampBits = timestampBits
+	l.workerIdBits = workerIdBits
+	l.sequenceBits = sequenceBits
+	l.workerIdShift = sequenceBits
+	l.timestampLeftShift = sequenceBits + workerIdBits
+	l.namespaceShift = sequenceBits + workerIdBits + timestampBits
+	l.sequenceMask = int64(^(-1 << sequenceBits))
+	l.maxWorkerId = int64(^(-1 << workerIdBits))
+	l.maxTimestamp = int64(^(-1 << timestampBits))
+	return l, nil
+}
+
+// tick 当前时间相对 twepoch 的刻度数
+func (l *snowflakeLayout) tick() int64 {
+	return (timeutil.MsTimestampNow() - l.twepoch) / l.timeUnit
+}
+
+func (l *snowflakeLayout) compose(tick, workerId, sequence int64) int64 {
+	return (l.namespaceCode << l.namespaceShift) | (tick << l.timestampLeftShift) | (workerId << l.workerIdShift) | sequence
+}
+
+func (l *snowflakeLayout) decode(id int64) map[string]interface{} {
+	var out = make(map[string]interface{}, 0)
+	originTimestamp := ((id>>l.timestampLeftShift)&l.maxTimestamp)*l.timeUnit + l.twepoch
+	out["timestamp"] = fmt.Sprintf("%d (%s)", originTimestamp, timeutil.MsTimestamp2Time(originTimestamp).Format("2006-01-02 15:04:05.000"))
+	out["workerId"] = (id >> l.workerIdShift) & l.maxWorkerId
+	out["sequenceId"] = id & l.sequenceMask
+	return out
+}
+
+// snowflakeNamespace 一个 namespace 独立维护序列号,序列号耗尽只阻塞本 namespace
+type snowflakeNamespace struct {
+	name          string
+	layout        *snowflakeLayout
+	sequence      int64
+	lastTimestamp int64
+	overflow      string
+	maxBorrow     int64 // borrow 模式最多领先当前时间的刻度数
+	startOffset   int
+	mu            sync.Mutex
+}
+
+func newSnowflakeNamespace(name string, layout *snowflakeLayout) *snowflakeNamespace {
+	ns := new(snowflakeNamespace)
+	ns.name = name
+	ns.layout = layout
+	ns.overflow = strings.ToLower(conf.GetString("LEAF_SNOWFLAKE_OVERFLOW_STRATEGY"))
+	switch ns.overflow {
+	case overflowSpin, overflowSleep, overflowBorrow, overflowReject:
+	default:
+		ns.overflow = overflowSpin
+	}
+	// LEAF_SNOWFLAKE_MAX_BORROW 为毫秒,按布局换算为刻度数并向下取整,不足一个刻度时不预借,效果与 sleep 相同
+	maxBorrowMs := conf.GetInt64("LEAF_SNOWFLAKE_MAX_BORROW")
+	if maxBorrowMs <= 0 {
+		maxBorrowMs = 5
+	}
+	ns.maxBorrow = maxBorrowMs / layout.timeUnit
+	// 每个新刻度的序列号从 [0,startOffset) 随机开始,避免低并发时序列号总是 0 导致按 ID 取模分库不均,0 表示从 0 开始
+	ns.startOffset = 100
+	if conf.IsSet("LEAF_SNOWFLAKE_SEQUENCE_START_OFFSET") {
+		ns.startOffset = conf.GetInt("LEAF_SNOWFLAKE_SEQUENCE_START_OFFSET")
+	}
+	return ns
+}
+
+func (ns *snowflakeNamespace) nextId(workerId int64) models.Result {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	l := ns.layout
+	var ts = l.tick()
+	if ns.overflow == overflowBorrow && ts < ns.lastTimestamp && ns.lastTimestamp-ts <= ns.maxBorrow {
+		// 之前预借的刻度还没用完,继续在 lastTimestamp 上递增
+		ts = ns.lastTimestamp
+	}
+	if ts < ns.lastTimestamp {
+		// 回拨 5 毫秒以内等待追上,按秒计数的布局容忍 1 个刻度
+		offset := (ns.lastTimestamp - ts) * l.timeUnit
+		if offset <= 5 {
+			time.Sleep(time.Duration(offset<<1) * time.Millisecond)
+			ts = l.tick()
+			if ts < ns.lastTimestamp {
+				return models.Result{Id: -1, Status: models.EXCEPTION}
+			}
+		} else if l.timeUnit > 1 && ns.lastTimestamp-ts == 1 {
+			ts = ns.tilNextTick(ns.lastTimestamp-1, overflowSleep)
+		} else {
+			return models.Result{Id: -3, Status: models.EXCEPTION}
+		}
+	}
+	if ts > l.maxTimestamp {
+		logger.Errorf("namespace-{%s} timestamp-{%d} overflow, twepoch-{%d} is too old", ns.name, ts, l.twepoch)
+		return models.Result{Id: -3, Status: models.EXCEPTION}
+	}
+	if ts == ns.lastTimestamp {
+		sequence := (ns.sequence + 1) & l.sequenceMask
+		if sequence == 0 {
+			metrics.SnowflakeSequenceOverflowTotal.WithLabelValues(ns.name, ns.overflow).Inc()
+			if ns.overflow == overflowReject {
+				return models.NewResult(int64(models.EXCEPTION_ID_SEQUENCE_OVERFLOW), models.EXCEPTION)
+			}
+			sequence = ns.startSequence()
+			ts = ns.tilNextTick(ns.lastTimestamp, ns.overflow)
+		}
+		ns.sequence = sequence
+	} else {
+		ns.sequence = ns.startSequence()
+	}
+	ns.lastTimestamp = ts
+	return models.Result{Id: l.compose(ts, workerId, ns.sequence), Status: models.SUCCESS}
+}
+
+func (ns *snowflakeNamespace) startSequence() int64 {
+	if ns.startOffset <= 0 {
+		return 0
+	}
+	return int64(rand.Intn(ns.startOffset)) & ns.layout.sequenceMask
+}
+
+// tilNextTick 返回大于 lastTimestamp 的刻度,borrow 模式直接使用 lastTimestamp+1,
+// 领先当前时间超过 maxBorrow 时休眠到领先量回到范围内
+func (ns *snowflakeNamespace) tilNextTick(lastTimestamp int64, overflow string) int64 {
+	l := ns.layout
+	if overflow == overflowBorrow {
+		next := lastTimestamp + 1
+		if lead := next - l.tick(); lead > ns.maxBorrow {
+			time.Sleep(time.Duration((lead-ns.maxBorrow)*l.timeUnit) * time.Millisecond)
+		}
+		return next
+	}
+	var ts = l.tick()
+	for ts <= lastTimestamp {
+		if overflow == overflowSleep || l.timeUnit > 1 {
+			// 休眠到下一个刻度的起点
+			wait := l.twepoch + (lastTimestamp+1)*l.timeUnit - timeutil.MsTimestampNow()
+			if wait < 1 {
+				wait = 1
+			}
+			time.Sleep(time.Duration(wait) * time.Millisecond)
+		}
+		ts = l.tick()
+	}
+	return ts
+}
+
+// loadSnowflakeNamespaces 读取 LEAF_SNOWFLAKE_NAMESPACES 中配置的 namespace,
+// 每个 namespace 可通过 LEAF_SNOWFLAKE_NS_${NAME}_* 覆盖起始时间、位布局和 namespace 编码
+func loadSnowflakeNamespaces(twepoch int64, namespaceBits int, workerId int64) (map[string]*snowflakeNamespace, error) {
+	namespaces := make(map[string]*snowflakeNamespace)
+	codes := make(map[int64]string)
+	for _, name := range conf.GetStringSlice("LEAF_SNOWFLAKE_NAMESPACES") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 || name == defaultSnowflakeNamespace {
+			continue
+		}
+		// 没有 namespace 位时各 namespace 的时间戳和 workerId 位相同,独立的序列号会生成重复 ID
+		if namespaceBits <= 0 {
+			return nil, fmt.Errorf("namespace %s requires LEAF_SNOWFLAKE_NAMESPACE_BITS gt 0", name)
+		}
+		prefix := "LEAF_SNOWFLAKE_NS_" + strings.ToUpper(name) + "_"
+		nsTwepoch := twepoch
+		if t := conf.GetTime(prefix + "START_TIME"); !t.IsZero() {
+			nsTwepoch = t.Unix() * 1000
+		}
+		if !(timeutil.MsTimestampNow() > nsTwepoch) {
+			return nil, fmt.Errorf("namespace %s twepoch gt currentTime", name)
+		}
+		nsWorkerIdBits := workerIdBits
+		if conf.IsSet(prefix + "WORKER_ID_BITS") {
+			nsWorkerIdBits = conf.GetInt(prefix + "WORKER_ID_BITS")
+		}
+		nsSequenceBits := sequenceBits
+		if conf.IsSet(prefix + "SEQUENCE_BITS") {
+			nsSequenceBits = conf.GetInt(prefix + "SEQUENCE_BITS")
+		}
+		layout, err := newSnowflakeLayout(nsTwepoch, 1, namespaceBits, 63-namespaceBits-nsWorkerIdBits-nsSequenceBits, nsWorkerIdBits, nsSequenceBits)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: %v", name, err)
+		}
+		if workerId > layout.maxWorkerId {
+			return nil, fmt.Errorf("namespace %s workerId-{%d} exceeds %d bits", name, workerId, nsWorkerIdBits)
+		}
+		code := conf.GetInt64(prefix + "CODE")
+		if code <= 0 || code > int64(^(-1<<namespaceBits)) {
+			return nil, fmt.Errorf("namespace %s code-{%d} must be in [1,%d]", name, code, ^(-1 << namespaceBits))
+		}
+		if exist, ok := codes[code]; ok {
+			return nil, fmt.Errorf("namespace %s code-{%d} conflicts with %s", name, code, exist)
+		}
+		codes[code] = name
+		layout.namespaceCode = code
+		namespaces[name] = newSnowflakeNamespace(name, layout)
+		logger.Infof("snowflake namespace-{%s} twepoch-{%d} code-{%d} bits timestamp-{%d} workerId-{%d} sequence-{%d}", name, nsTwepoch, layout.namespaceCode, layout.timestampBits, nsWorkerIdBits, nsSequenceBits)
+	}
+	return namespaces, nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/busyfree/leaf-go/models"
+	"github.com/busyfree/leaf-go/util/conf"
+)
+
+func TestLoadSnowflakeNamespacesRequiresBits(t *testing.T) {
+	conf.Set("LEAF_SNOWFLAKE_NAMESPACES", "order,pay")
+	conf.Set("LEAF_SNOWFLAKE_NS_ORDER_CODE", "1")
+	conf.Set("LEAF_SNOWFLAKE_NS_PAY_CODE", "2")
+	defer conf.Set("LEAF_SNOWFLAKE_NAMESPACES", "")
+	twepoch := int64(1288834974657)
+
+	if _, err := loadSnowflakeNamespaces(twepoch, 0, 1); err == nil {
+		t.Fatal("namespaces without namespace bits should be rejected")
+	}
+
+	namespaces, err := loadSnowflakeNamespaces(twepoch, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order, pay := namespaces["order"].nextId(1), namespaces["pay"].nextId(1)
+	if order.Id == pay.Id {
+		t.Fatalf("namespaces generate the same id %d", order.Id)
+	}
+	if code := order.Id >> namespaces["order"].layout.namespaceShift; code != 1 {
+		t.Fatalf("order namespace code = %d, want 1", code)
+	}
+	if code := pay.Id >> namespaces["pay"].layout.namespaceShift; code != 2 {
+		t.Fatalf("pay namespace code = %d, want 2", code)
+	}
+}
+
+// newOverflowTestNamespace 每个刻度只有 4 个序列号的 namespace,序列号从 0 开始
+func newOverflowTestNamespace(t *testing.T, strategy string, timeUnit int64) *snowflakeNamespace {
+	conf.Set("LEAF_SNOWFLAKE_OVERFLOW_STRATEGY", strategy)
+	conf.Set("LEAF_SNOWFLAKE_SEQUENCE_START_OFFSET", "0")
+	t.Cleanup(func() {
+		conf.Set("LEAF_SNOWFLAKE_OVERFLOW_STRATEGY", "spin")
+		conf.Set("LEAF_SNOWFLAKE_SEQUENCE_START_OFFSET", "100")
+	})
+	layout, err := newSnowflakeLayout(1288834974657, timeUnit, 0, 51, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newSnowflakeNamespace("overflow", layout)
+}
+
+func TestSnowflakeOverflowSleep(t *testing.T) {
+	ns := newOverflowTestNamespace(t, overflowSleep, 1)
+	var last int64
+	for i := 0; i < 40; i++ {
+		r := ns.nextId(1)
+		if r.Status != models.SUCCESS || r.Id <= last {
+			t.Fatalf("id %d after %d status %d", r.Id, last, r.Status)
+		}
+		last = r.Id
+		// 序列号用尽时等待下一个刻度,时间戳不会领先当前时间
+		if tick := (r.Id >> ns.layout.timestampLeftShift) & ns.layout.maxTimestamp; tick > ns.layout.tick() {
+			t.Fatalf("tick %d is ahead of now %d", tick, ns.layout.tick())
+		}
+	}
+}
+
+func TestSnowflakeOverflowBorrow(t *testing.T) {
+	conf.Set("LEAF_SNOWFLAKE_MAX_BORROW", "5")
+	defer conf.Set("LEAF_SNOWFLAKE_MAX_BORROW", "5")
+	ns := newOverflowTestNamespace(t, overflowBorrow, 1)
+	if ns.maxBorrow != 5 {
+		t.Fatalf("maxBorrow = %d ticks, want 5", ns.maxBorrow)
+	}
+	var last, maxLead int64
+	for i := 0; i < 400; i++ {
+		r := ns.nextId(1)
+		if r.Status != models.SUCCESS || r.Id <= last {
+			t.Fatalf("id %d after %d status %d", r.Id, last, r.Status)
+		}
+		last = r.Id
+		lead := (r.Id>>ns.layout.timestampLeftShift)&ns.layout.maxTimestamp - ns.layout.tick()
+		if lead > ns.maxBorrow {
+			t.Fatalf("lead %d exceeds maxBorrow %d", lead, ns.maxBorrow)
+		}
+		if lead > maxLead {
+			maxLead = lead
+		}
+	}
+	if maxLead == 0 {
+		t.Fatal("borrow strategy never borrowed a future tick")
+	}
+}
+
+func TestSnowflakeMaxBorrowPerLayout(t *testing.T) {
+	// 毫秒数按秒级布局换算,不足一个刻度时不预借
+	conf.Set("LEAF_SNOWFLAKE_MAX_BORROW", "5")
+	if ns := newOverflowTestNamespace(t, overflowBorrow, 1000); ns.maxBorrow != 0 {
+		t.Fatalf("5ms on second layout = %d ticks, want 0", ns.maxBorrow)
+	}
+	conf.Set("LEAF_SNOWFLAKE_MAX_BORROW", "5000")
+	defer conf.Set("LEAF_SNOWFLAKE_MAX_BORROW", "5")
+	if ns := newOverflowTestNamespace(t, overflowBorrow, 1000); ns.maxBorrow != 5 {
+		t.Fatalf("5000ms on second layout = %d ticks, want 5", ns.maxBorrow)
+	}
+}
+
+func TestSnowflakeOverflowReject(t *testing.T) {
+	ns := newOverflowTestNamespace(t, overflowReject, 1)
+	seen := make(map[int64]bool)
+	rejected := false
+	for i := 0; i < 1000 && !rejected; i++ {
+		r := ns.nextId(1)
+		if r.Status != models.SUCCESS {
+			if r.Id != int64(models.EXCEPTION_ID_SEQUENCE_OVERFLOW) {
+				t.Fatalf("unexpected error code %d", r.Id)
+			}
+			rejected = true
+			continue
+		}
+		if seen[r.Id] {
+			t.Fatalf("duplicate id %d", r.Id)
+		}
+		seen[r.Id] = true
+	}
+	if !rejected {
+		t.Fatal("reject strategy never returned sequence overflow")
+	}
+}
+
+func BenchmarkSnowflakeNamespaceNextId(b *testing.B) {
+	conf.Set("LEAF_SNOWFLAKE_NAMESPACES", "order")
+	conf.Set("LEAF_SNOWFLAKE_NS_ORDER_CODE", "1")
+	defer conf.Set("LEAF_SNOWFLAKE_NAMESPACES", "")
+	namespaces, err := loadSnowflakeNamespaces(1288834974657, 2, 1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	order := namespaces["order"]
+	benchParallel(b, func() models.Result { return order.nextId(1) })
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/spf13/cast"
+	"go.uber.org/atomic"
+
+	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/redis"
+	"github.com/busyfree/leaf-go/util/timeutil"
+)
+
+var (
+	PREFIX_REDIS_KEY = "leaf:snowflake:" + conf.GetString("LEAF_NAME") + ":"
+)
+
+// 抢占或续期 workerId 槽位,槽位不存在或者已被自己持有时写入并设置过期时间
+const redisClaimSlotScript = `
+local v = redis.call('GET', KEYS[1])
+if v == false or v == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[2])
+	return 1
+end
+return 0
+`
+
+// 续期 workerId 槽位,只有槽位仍由自己持有时才续期,槽位过期或被其他节点抢占时返回 0
+const redisRenewSlotScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[2])
+	return 1
+end
+return 0
+`
+
+// SnowFlakeRedisHolder 通过 redis SET NX EX 抢占 workerId 槽位,
+// 槽位由心跳续期,进程退出后超时释放给其他节点使用
+type SnowFlakeRedisHolder struct {
+	ip             string
+	port           string
+	listenAddress  string
+	redisName      string
+	slotTTL        int32
+	lastUpdateTime int64
+	lost           *atomic.Bool
+	ctx            context.Context
+	cancel         context.CancelFunc
+	wg             sync.WaitGroup
+	WorkerId       int
+}
+
+func NewSnowFlakeRedisHolder(ip, port, redisName string, slotTTL int32) *SnowFlakeRedisHolder {
+	s := new(SnowFlakeRedisHolder)
+	s.ip = ip
+	s.port = port
+	s.listenAddress = ip + ":" + port
+	if len(redisName) == 0 {
+		redisName = "default"
+	}
+	s.redisName = redisName
+	if slotTTL <= 0 {
+		slotTTL = 30
+	}
+	s.slotTTL = slotTTL
+	s.lost = atomic.NewBool(false)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+func (s *SnowFlakeRedisHolder) Init() bool {
+	// 槽位和 endpoint 以 ip:port 区分节点,空地址或回环地址在多机部署时会互相冲突
+	if !routableIp(s.ip) {
+		logger.Errorf("START FAILED ,redis holder needs a routable ip, got ip-{%s}, check LEAF_SNOWFLAKE_ETHER", s.ip)
+		return false
+	}
+	ctx := context.Background()
+	r := redis.Get(ctx, s.redisName)
+	// 优先使用本 ip:port 上次持有的 workerId,保证重启前后 workerId 稳定
+	candidates := make([]int, 0, maxWorkerId+2)
+	item, err := r.Get(ctx, s.endpointKey())
+	if err != nil && err != redis.ErrNonExist {
+		logger.Errorf("redis get endpoint error:%+v", err)
+		return false
+	}
+	if err == nil && item != nil {
+		candidates = append(candidates, cast.ToInt(string(item.Value)))
+	}
+	for i := 0; i <= maxWorkerId; i++ {
+		candidates = append(candidates, i)
+	}
+	for _, workerId := range candidates {
+		ok, err := s.claimSlot(ctx, r, workerId)
+		if err != nil {
+			logger.Errorf("redis claim slot error:%+v", err)
+			return false
+		}
+		if !ok {
+			continue
+		}
+		if !s.checkInitTimeStamp(ctx, r, workerId) {
+			logger.Errorf("START FAILED ,workerId-{%d} last timestamp is bigger than local time", workerId)
+			_ = r.Del(ctx, s.slotKey(workerId))
+			return false
+		}
+		s.WorkerId = workerId
+		err = r.Set(ctx, &redis.Item{Key: s.endpointKey(), Value: []byte(cast.ToString(workerId))})
+		if err != nil {
+			logger.Errorf("redis set endpoint error:%+v", err)
+			return false
+		}
+		s.updateNewData(ctx, r)
+		s.doService(r)
+		saveLocalWorkerID(s.port, s.WorkerId)
+		logger.Infof("[REDIS NODE]endpoint ip-{%s} port-{%s} hold workid-{%d} and start SUCCESS", s.ip, s.port, s.WorkerId)
+		return true
+	}
+	logger.Errorf("START FAILED ,no free workerId slot in redis")
+	return false
+}
+
+func (s *SnowFlakeRedisHolder) endpointKey() string {
+	return PREFIX_REDIS_KEY + "endpoint:" + s.listenAddress
+}
+
+func (s *SnowFlakeRedisHolder) slotKey(workerId int) string {
+	return fmt.Sprintf("%sslot:%d", PREFIX_REDIS_KEY, workerId)
+}
+
+func (s *SnowFlakeRedisHolder) timestampKey(workerId int) string {
+	return fmt.Sprintf("%stimestamp:%d", PREFIX_REDIS_KEY, workerId)
+}
+
+func (s *SnowFlakeRedisHolder) claimSlot(ctx context.Context, r *redis.Redis, workerId int) (bool, error) {
+	return s.evalSlot(ctx, r, redisClaimSlotScript, workerId)
+}
+
+func (s *SnowFlakeRedisHolder) renewSlot(ctx context.Context, r *redis.Redis) (bool, error) {
+	return s.evalSlot(ctx, r, redisRenewSlotScript, s.WorkerId)
+}
+
+func (s *SnowFlakeRedisHolder) evalSlot(ctx context.Context, r *redis.Redis, script string, workerId int) (bool, error) {
+	ret, err := r.Eval(ctx, script, []string{s.slotKey(workerId)}, s.listenAddress, s.slotTTL)
+	if err != nil {
+		return false, err
+	}
+	n, err := ret.Int64()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (s *SnowFlakeRedisHolder) doService(r *redis.Redis) {
+	s.wg.Add(1)
+	go s.scheduledUploadData(r)
+}
+
+func (s *SnowFlakeRedisHolder) scheduledUploadData(r *redis.Redis) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(time.Duration(3) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.updateNewData(context.Background(), r)
+		}
+	}
+}
+
+// updateNewData 续期槽位并上报时间戳。槽位过期或被其他节点抢占后 workerId 可能已被其他节点使用,
+// 此后拒绝发号且不再上报,避免覆盖新持有者的时间戳
+func (s *SnowFlakeRedisHolder) updateNewData(ctx context.Context, r *redis.Redis) {
+	if s.lost.Load() || timeutil.MsTimestampNow() < s.lastUpdateTime {
+		return
+	}
+	ok, err := s.renewSlot(ctx, r)
+	if err != nil {
+		logger.Errorf("redis renew slot error:%+v", err)
+		// 超过 slotTTL 没有续期成功时槽位已经过期
+		if s.lastUpdateTime > 0 && timeutil.MsTimestampNow()-s.lastUpdateTime > int64(s.slotTTL)*1000 {
+			logger.Errorf("workerId-{%d} slot was not renewed in %ds, refuse to serve", s.WorkerId, s.slotTTL)
+			s.lost.Store(true)
+		}
+		return
+	}
+	if !ok {
+		logger.Errorf("workerId-{%d} slot was taken by another endpoint or expired, refuse to serve", s.WorkerId)
+		s.lost.Store(true)
+		return
+	}
+	err = r.Set(ctx, &redis.Item{Key: s.timestampKey(s.WorkerId), Value: buildEndpointData(s.ip, s.port)})
+	if err != nil {
+		return
+	}
+	saveLocalWorkerID(s.port, s.WorkerId)
+	s.lastUpdateTime = timeutil.MsTimestampNow()
+	return
+}
+
+// checkInitTimeStamp workerId 可能被其他节点用过,本机时间不能落后于该 workerId 最后上报的时间
+func (s *SnowFlakeRedisHolder) checkInitTimeStamp(ctx context.Context, r *redis.Redis, workerId int) bool {
+	item, err := r.Get(ctx, s.timestampKey(workerId))
+	if err == redis.ErrNonExist {
+		return true
+	}
+	if err != nil || item == nil {
+		return false
+	}
+	endpoint := deBuildEndpointData(item.Value)
+	return !(endpoint.Timestamp > timeutil.MsTimestampNow())
+}
+
+func (s *SnowFlakeRedisHolder) IsLost() bool {
+	return s.lost.Load()
+}
+
+func (s *SnowFlakeRedisHolder) GetWorkerId() int {
+	return s.WorkerId
+}
+
+// Close 停止心跳并上报最后一次时间戳,槽位保留到过期,便于本节点重启后继续使用原 workerId
+func (s *SnowFlakeRedisHolder) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	s.updateNewData(context.Background(), redis.Get(context.Background(), s.redisName))
+	return nil
+}
+
+// routableIp ip 非空且不是回环地址或 0.0.0.0
+func routableIp(ip string) bool {
+	if len(ip) == 0 || ip == "localhost" {
+		return false
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return true
+	}
+	return !parsed.IsLoopback() && !parsed.IsUnspecified()
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/redis"
+)
+
+type fakeRedisValue struct {
+	value    string
+	expireAt time.Time
+}
+
+// fakeRedis 进程内的 redis 替身,支持 holder 用到的 GET、SET EX、DEL 和两个槽位脚本,
+// 时间可以通过 advance 快进以模拟 key 过期
+type fakeRedis struct {
+	mu     sync.Mutex
+	data   map[string]*fakeRedisValue
+	offset time.Duration
+	addr   string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	f := new(fakeRedis)
+	f.data = make(map[string]*fakeRedisValue)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.addr = ln.Addr().String()
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) advance(d time.Duration) {
+	f.mu.Lock()
+	f.offset += d
+	f.mu.Unlock()
+}
+
+func (f *fakeRedis) getLocked(key string) (string, bool) {
+	v, ok := f.data[key]
+	if !ok {
+		return "", false
+	}
+	if !v.expireAt.IsZero() && !time.Now().Add(f.offset).Before(v.expireAt) {
+		delete(f.data, key)
+		return "", false
+	}
+	return v.value, true
+}
+
+func (f *fakeRedis) setLocked(key, value string, ttl int) {
+	v := &fakeRedisValue{value: value}
+	if ttl > 0 {
+		v.expireAt = time.Now().Add(f.offset).Add(time.Duration(ttl) * time.Second)
+	}
+	f.data[key] = v
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readFakeRedisCommand(r)
+		if err != nil {
+			return
+		}
+		if _, err = io.WriteString(conn, f.exec(args)); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) exec(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		v, ok := f.getLocked(args[1])
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case "SET":
+		ttl := 0
+		if len(args) == 5 && strings.ToUpper(args[3]) == "EX" {
+			ttl, _ = strconv.Atoi(args[4])
+		}
+		f.setLocked(args[1], args[2], ttl)
+		return "+OK\r\n"
+	case "DEL":
+		n := 0
+		for _, key := range args[1:] {
+			if _, ok := f.getLocked(key); ok {
+				delete(f.data, key)
+				n++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "EVAL":
+		// EVAL script 1 key endpoint ttl
+		key, endpoint := args[3], args[4]
+		ttl, _ := strconv.Atoi(args[5])
+		v, ok := f.getLocked(key)
+		switch args[1] {
+		case redisClaimSlotScript:
+			if !ok || v == endpoint {
+				f.setLocked(key, endpoint, ttl)
+				return ":1\r\n"
+			}
+		case redisRenewSlotScript:
+			if ok && v == endpoint {
+				f.setLocked(key, endpoint, ttl)
+				return ":1\r\n"
+			}
+		default:
+			return "-ERR unknown script\r\n"
+		}
+		return ":0\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func readFakeRedisCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line)[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line)[1:])
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func (f *fakeRedis) get(key string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.getLocked(key)
+}
+
+// newTestRedisHolder 每个测试使用独立的 redis 名称,避免复用其他测试缓存的客户端
+func newTestRedisHolder(t *testing.T, f *fakeRedis, port string) *SnowFlakeRedisHolder {
+	name := strings.ToLower(t.Name())
+	conf.Set("REDIS_"+name+"_HOST", f.addr)
+	conf.Set("REDIS_"+name+"_MAX_CONNS", "4")
+	return NewSnowFlakeRedisHolder("10.0.0.1", port, name, 10)
+}
+
+func TestRedisHolderClaim(t *testing.T) {
+	setupHolderTest(t)
+	f := newFakeRedis(t)
+
+	first := newTestRedisHolder(t, f, "8001")
+	if !first.Init() {
+		t.Fatal("first init failed")
+	}
+	second := newTestRedisHolder(t, f, "8002")
+	if !second.Init() {
+		t.Fatal("second init failed")
+	}
+	if first.GetWorkerId() == second.GetWorkerId() {
+		t.Fatalf("two endpoints hold the same workerId %d", first.GetWorkerId())
+	}
+	if v, _ := f.get(first.slotKey(first.GetWorkerId())); v != "10.0.0.1:8001" {
+		t.Fatalf("slot owner = %s", v)
+	}
+	workerId := first.GetWorkerId()
+	_ = first.Close()
+	_ = second.Close()
+
+	// 槽位过期前重启,按 endpoint 记录的 workerId 重新持有原来的槽位
+	restarted := newTestRedisHolder(t, f, "8001")
+	defer restarted.Close()
+	if !restarted.Init() || restarted.GetWorkerId() != workerId {
+		t.Fatalf("restart got workerId %d, want %d", restarted.GetWorkerId(), workerId)
+	}
+}
+
+func TestRedisHolderRenewAndTakeover(t *testing.T) {
+	setupHolderTest(t)
+	f := newFakeRedis(t)
+	ctx := context.Background()
+
+	h := newTestRedisHolder(t, f, "8001")
+	if !h.Init() {
+		t.Fatal("init failed")
+	}
+	defer h.Close()
+	r := redis.Get(ctx, h.redisName)
+
+	// 心跳续期后槽位不会在原来的过期时间失效
+	f.advance(6 * time.Second)
+	h.updateNewData(ctx, r)
+	f.advance(6 * time.Second)
+	if v, ok := f.get(h.slotKey(h.GetWorkerId())); !ok || v != "10.0.0.1:8001" {
+		t.Fatal("slot should be renewed by heartbeat")
+	}
+	if h.IsLost() {
+		t.Fatal("holder should not be lost after renewal")
+	}
+
+	// 心跳中断超过 TTL,槽位被其他节点抢占
+	f.advance(11 * time.Second)
+	other := newTestRedisHolder(t, f, "8002")
+	if !other.Init() {
+		t.Fatal("other init failed")
+	}
+	defer other.Close()
+	if other.GetWorkerId() != h.GetWorkerId() {
+		t.Fatalf("other got workerId %d, want expired workerId %d", other.GetWorkerId(), h.GetWorkerId())
+	}
+	h.updateNewData(ctx, r)
+	if !h.IsLost() {
+		t.Fatal("holder should be lost after its slot was taken")
+	}
+	if v, _ := f.get(h.slotKey(h.GetWorkerId())); v != "10.0.0.1:8002" {
+		t.Fatalf("slot owner = %s, want the new holder", v)
+	}
+}
+
+func TestRedisHolderRejectsLoopback(t *testing.T) {
+	setupHolderTest(t)
+	f := newFakeRedis(t)
+	name := strings.ToLower(t.Name())
+	conf.Set("REDIS_"+name+"_HOST", f.addr)
+	conf.Set("REDIS_"+name+"_MAX_CONNS", "4")
+	for _, ip := range []string{"", "127.0.0.1", "::1", "localhost", "0.0.0.0"} {
+		h := NewSnowFlakeRedisHolder(ip, "8001", name, 10)
+		if h.Init() {
+			h.Close()
+			t.Fatalf("init with ip %q should fail", ip)
+		}
+	}
+}
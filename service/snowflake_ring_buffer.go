@@ -0,0 +1,78 @@
+package service
+
+import (
+	"go.uber.org/atomic"
+)
+
+const (
+	ringSlotCanPut  uint32 = 0
+	ringSlotCanTake uint32 = 1
+)
+
+// uidRingBuffer 参考百度 UidGenerator 的 RingBuffer,tail 为最后写入的位置,cursor 为最后取出的位置,
+// 单个填充协程写入,多个调用方通过 CAS cursor 无锁取号
+type uidRingBuffer struct {
+	slots            []int64
+	flags            []atomic.Uint32
+	size             int64
+	mask             int64
+	paddingThreshold int64
+	tail             *atomic.Int64
+	cursor           *atomic.Int64
+}
+
+// newUidRingBuffer size 向上取整为 2 的幂,剩余可取 ID 少于 paddingFactor% 时触发填充
+func newUidRingBuffer(size int64, paddingFactor int64) *uidRingBuffer {
+	r := new(uidRingBuffer)
+	r.size = 1
+	for r.size < size {
+		r.size <<= 1
+	}
+	r.mask = r.size - 1
+	r.slots = make([]int64, r.size)
+	r.flags = make([]atomic.Uint32, r.size)
+	r.paddingThreshold = r.size * paddingFactor / 100
+	r.tail = atomic.NewInt64(-1)
+	r.cursor = atomic.NewInt64(-1)
+	return r
+}
+
+// put 只能由填充协程调用,环已满时返回 false
+func (r *uidRingBuffer) put(id int64) bool {
+	tail := r.tail.Load()
+	if tail-r.cursor.Load() == r.size-1 {
+		return false
+	}
+	idx := (tail + 1) & r.mask
+	if r.flags[idx].Load() != ringSlotCanPut {
+		return false
+	}
+	r.slots[idx] = id
+	r.flags[idx].Store(ringSlotCanTake)
+	r.tail.Inc()
+	return true
+}
+
+// take 取出一个 ID,环为空时返回 false;needPadding 表示剩余 ID 低于阈值
+func (r *uidRingBuffer) take() (id int64, ok bool, needPadding bool) {
+	var next int64
+	for {
+		cursor := r.cursor.Load()
+		if cursor >= r.tail.Load() {
+			return 0, false, true
+		}
+		next = cursor + 1
+		if r.cursor.CAS(cursor, next) {
+			break
+		}
+	}
+	idx := next & r.mask
+	// put 先写 slot 再推进 tail,cursor 不超过 tail 时 slot 一定可取
+	id = r.slots[idx]
+	r.flags[idx].Store(ringSlotCanPut)
+	return id, true, r.tail.Load()-next < r.paddingThreshold
+}
+
+func (r *uidRingBuffer) available() int64 {
+	return r.tail.Load() - r.cursor.Load()
+}
@@ -2,22 +2,22 @@ package service
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
 	"fmt"
-	"io/ioutil"
-	"os"
+	"net"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-zookeeper/zk"
-	"github.com/spf13/cast"
-	"github.com/spf13/viper"
+	"go.uber.org/atomic"
 
-	"github.com/busyfree/leaf-go/util/check"
 	"github.com/busyfree/leaf-go/util/conf"
 	"github.com/busyfree/leaf-go/util/log"
 	"github.com/busyfree/leaf-go/util/timeutil"
+	"github.com/busyfree/leaf-go/util/tlsutil"
 )
 
 var (
@@ -31,6 +31,18 @@ type Endpoint struct {
 	IP        string `json:"ip"`
 	Port      string `json:"port"`
 	Timestamp int64  `json:"timestamp"`
+	Nonce     string `json:"nonce,omitempty"`
+}
+
+// zkConn holder 使用的 zk 操作,由 *zk.Conn 实现
+type zkConn interface {
+	Exists(path string) (bool, *zk.Stat, error)
+	Children(path string) ([]string, *zk.Stat, error)
+	Get(path string) ([]byte, *zk.Stat, error)
+	Set(path string, data []byte, version int32) (*zk.Stat, error)
+	Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error)
+	Delete(path string, version int32) error
+	Close()
 }
 
 type SnowFlakeZookeeperHolder struct {
@@ -40,6 +52,15 @@ type SnowFlakeZookeeperHolder struct {
 	port           string
 	connectionStr  string
 	lastUpdateTime int64
+	degraded       bool
+	clockGuard     *clockDriftGuard
+	lost           *atomic.Bool
+	tlsConfig      *tls.Config
+	client         zkConn
+	dial           func() (zkConn, error)
+	ctx            context.Context
+	cancel         context.CancelFunc
+	wg             sync.WaitGroup
 	WorkerId       int
 }
 
@@ -49,105 +70,314 @@ func NewSnowFlakeZookeeperHolder(ip, port, connectionStr string) *SnowFlakeZooke
 	s.port = port
 	s.listenAddress = ip + ":" + port
 	s.connectionStr = connectionStr
+	s.clockGuard = newClockDriftGuard("zk")
+	s.dial = s.connect
+	s.lost = atomic.NewBool(false)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
 	return s
 }
 
 func (s *SnowFlakeZookeeperHolder) Init() bool {
-	c, _, err := zk.Connect([]string{s.connectionStr}, time.Duration(6)*time.Second)
+	// TLS 配置错误时不降级为明文连接,zk 服务端需开启 secureClientPort
+	tlsConfig, err := tlsutil.NewClientConfig("LEAF_SNOWFLAKE_ZK_TLS")
 	if err != nil {
-		panic(err)
+		logger.Errorf("zk tls config error:%+v", err)
+		return false
 	}
-	boolExist, _, _ := c.Exists(PATH_FOREVER)
-	if !boolExist {
-		zkAddr := s.createNode(c)
-		s.updateLocalWorkerID(s.WorkerId)
-		go s.scheduledUploadData(c, zkAddr)
-		return true
+	s.tlsConfig = tlsConfig
+	c, err := s.dial()
+	if err != nil {
+		logger.Errorf("zk connect error:%+v", err)
+		return s.initFromLocal(nil)
 	}
-	keys, _, err := c.Children(PATH_FOREVER)
+	s.client = c
+	ok, err := s.register(c)
 	if err != nil {
-		logger.Infof("c.ChildrenErr:%+v", err)
-		return false
+		logger.Errorf("zk register error:%+v", err)
+		return s.initFromLocal(c)
+	}
+	return ok
+}
+
+func (s *SnowFlakeZookeeperHolder) connect() (zkConn, error) {
+	servers := strings.Split(s.connectionStr, ",")
+	var (
+		c   *zk.Conn
+		err error
+	)
+	if s.tlsConfig == nil {
+		c, _, err = zk.Connect(servers, time.Duration(6)*time.Second)
+	} else {
+		c, _, err = zk.Connect(servers, time.Duration(6)*time.Second, zk.WithDialer(func(network, address string, timeout time.Duration) (net.Conn, error) {
+			return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, network, address, s.tlsConfig)
+		}))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// register 在 zk 上查找或创建本节点,返回 error 表示 zk 不可用,返回 false 表示节点数据校验失败
+func (s *SnowFlakeZookeeperHolder) register(c zkConn) (bool, error) {
+	boolExist, _, err := c.Exists(PATH_FOREVER)
+	if err != nil {
+		return false, err
 	}
-	if len(keys) > 0 {
-		nodeMap := make(map[string]int, 0)
-		realNodeMap := make(map[string]string, 0)
+	nodeMap := make(map[string]int, 0)
+	realNodeMap := make(map[string]string, 0)
+	if boolExist {
+		keys, _, err := c.Children(PATH_FOREVER)
+		if err != nil {
+			return false, err
+		}
 		for _, node := range keys {
-			nodeKey := strings.Split(node, "-")
-			realNodeMap[nodeKey[0]] = node
-			nodeMap[nodeKey[0]] = cast.ToInt(nodeKey[1])
-		}
-		if workId, ok := nodeMap[s.listenAddress]; ok {
-			zkAddrNode := PATH_FOREVER + "/" + realNodeMap[s.listenAddress]
-			s.WorkerId = workId
-			if !s.checkInitTimeStamp(c, zkAddrNode) {
-				viper.SetConfigName("workerID")
-				viper.AddConfigPath(conf.GetConfigPath())
-				err := viper.ReadInConfig()
-				if err != nil {
-					panic(fmt.Errorf("read file error:%v", err))
-				}
-				logger.Errorf("START FAILED ,use local node file properties workerID-{%d}", viper.GetInt("workerID"))
-				return false
+			listenAddress, workerId, err := parseForeverNodeKey(node)
+			if err != nil {
+				logger.Warnf("skip invalid forever node:%+v", err)
+				continue
+			}
+			if exist, ok := realNodeMap[listenAddress]; ok {
+				// 同一个 ip:port 只允许持有一个 workerId,否则无法确定应该使用哪一个
+				logger.Errorf("START FAILED ,endpoint %s has more than one forever node:%s,%s", listenAddress, exist, node)
+				return false, nil
+			}
+			realNodeMap[listenAddress] = node
+			nodeMap[listenAddress] = workerId
+		}
+	}
+	peers, err := s.peerTimestamps(c, realNodeMap)
+	if err != nil {
+		return false, err
+	}
+	if !s.clockGuard.check(peers) {
+		logger.Errorf("START FAILED ,local clock skew against peer nodes is too large")
+		return false, nil
+	}
+	if workerId, ok := nodeMap[s.listenAddress]; ok {
+		zkAddrNode := PATH_FOREVER + "/" + realNodeMap[s.listenAddress]
+		if s.degraded {
+			if workerId != s.WorkerId {
+				logger.Errorf("RECONCILE FAILED ,zk workerId-{%d} differs from local workerId-{%d}", workerId, s.WorkerId)
+				return false, nil
 			}
-			s.ZKAddressNode = zkAddrNode
-			s.doService(c)
-			s.updateLocalWorkerID(s.WorkerId)
-			logger.Infof("[Old NODE]find forever node have this endpoint ip-{%s} port-{%s} workid-{%d} childnode and start SUCCESS", s.ip, s.port, s.WorkerId)
-		} else {
-			newNode := s.createNode(c)
-			s.ZKAddressNode = newNode
-			nodeKeyArr := strings.Split(newNode, "-")
-			s.WorkerId = cast.ToInt(nodeKeyArr[1])
-			s.doService(c)
-			s.updateLocalWorkerID(workId)
-			logger.Infof("[New NODE]can not find node on forever node that endpoint ip-{%s} port-{%s} workid-{%d},create own node on forever node and start SUCCESS", s.ip, s.port, s.WorkerId)
+		} else if !s.checkInitTimeStamp(c, zkAddrNode) {
+			logger.Errorf("START FAILED ,zk node %s timestamp is bigger than local time", zkAddrNode)
+			return false, nil
+		}
+		s.WorkerId = workerId
+		s.ZKAddressNode = zkAddrNode
+		s.degraded = false
+		s.doService(c)
+		saveLocalWorkerID(s.port, s.WorkerId)
+		logger.Infof("[Old NODE]find forever node have this endpoint ip-{%s} port-{%s} workid-{%d} childnode and start SUCCESS", s.ip, s.port, s.WorkerId)
+		return true, nil
+	}
+	if s.degraded {
+		// 降级启动时本地 workerId 无法在 zk 上找到,新建节点会分配到不同的 workerId
+		logger.Errorf("RECONCILE FAILED ,endpoint %s not found on forever node, local workerId-{%d} is unverified", s.listenAddress, s.WorkerId)
+		return false, nil
+	}
+	// 表示新启动的节点,创建持久顺序节点,不用check时间
+	newNode, err := s.createNode(c)
+	if err != nil {
+		return false, err
+	}
+	_, workerId, err := parseForeverNodeKey(filepath.Base(newNode))
+	if err != nil {
+		logger.Errorf("START FAILED ,%+v", err)
+		s.deleteNode(c, newNode)
+		return false, nil
+	}
+	for endpoint, id := range nodeMap {
+		if id == workerId {
+			logger.Errorf("START FAILED ,workerId-{%d} already hold by endpoint %s", workerId, endpoint)
+			s.deleteNode(c, newNode)
+			return false, nil
 		}
 	}
+	s.ZKAddressNode = newNode
+	s.WorkerId = workerId
+	s.doService(c)
+	saveLocalWorkerID(s.port, s.WorkerId)
+	logger.Infof("[New NODE]can not find node on forever node that endpoint ip-{%s} port-{%s} workid-{%d},create own node on forever node and start SUCCESS", s.ip, s.port, s.WorkerId)
+	return true, nil
+}
+
+// initFromLocal zk 不可用时使用本地缓存的 workerId 降级启动,并在后台等待 zk 恢复后重新注册
+func (s *SnowFlakeZookeeperHolder) initFromLocal(c zkConn) bool {
+	workerId, ok := loadLocalWorkerID(s.port)
+	if !ok {
+		return false
+	}
+	s.WorkerId = workerId
+	s.degraded = true
+	logger.Warnf("[DEGRADED]zk unavailable, use local file workerID-{%d} ip-{%s} port-{%s}", s.WorkerId, s.ip, s.port)
+	s.wg.Add(1)
+	go s.reconcile(c)
 	return true
 }
 
-func (s *SnowFlakeZookeeperHolder) doService(client *zk.Conn) {
+func (s *SnowFlakeZookeeperHolder) reconcile(c zkConn) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(time.Duration(3) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// 降级期间持续更新本地时间戳,供下次启动校验时钟
+		saveLocalWorkerID(s.port, s.WorkerId)
+		if c == nil {
+			var err error
+			c, err = s.dial()
+			if err != nil {
+				continue
+			}
+			s.client = c
+		}
+		ok, err := s.register(c)
+		if err != nil {
+			logger.Warnf("zk still unavailable:%v", err)
+			continue
+		}
+		if ok {
+			logger.Infof("[DEGRADED]zk recovered, workerID-{%d} reconciled", s.WorkerId)
+			return
+		}
+		// 本地 workerId 与 zk 不一致或时钟偏差过大时,降级期间使用的 workerId 不可信,拒绝继续发号
+		logger.Errorf("[DEGRADED]zk reconcile failed, local workerID-{%d} is lost, refuse to serve", s.WorkerId)
+		s.lost.Store(true)
+		return
+	}
+}
+
+// parseForeverNodeKey 解析 forever 下的子节点名 ip:port-0000000001,返回 ip:port 和 workerId
+func parseForeverNodeKey(node string) (listenAddress string, workerId int, err error) {
+	idx := strings.LastIndex(node, "-")
+	if idx <= 0 || idx == len(node)-1 {
+		err = fmt.Errorf("invalid forever node key:%s", node)
+		return
+	}
+	listenAddress = node[:idx]
+	workerId, err = strconv.Atoi(node[idx+1:])
+	if err != nil {
+		err = fmt.Errorf("invalid forever node key:%s,%v", node, err)
+		return
+	}
+	if workerId < 0 || workerId > maxWorkerId {
+		err = fmt.Errorf("forever node key:%s workerId out of range [0,%d]", node, maxWorkerId)
+		return
+	}
+	return
+}
+
+func (s *SnowFlakeZookeeperHolder) doService(client zkConn) {
+	s.wg.Add(1)
 	go s.scheduledUploadData(client, s.ZKAddressNode)
 }
 
-func (s *SnowFlakeZookeeperHolder) scheduledUploadData(client *zk.Conn, zkAddrNode string) {
+func (s *SnowFlakeZookeeperHolder) scheduledUploadData(client zkConn, zkAddrNode string) {
+	defer s.wg.Done()
 	ticker := time.NewTicker(time.Duration(3) * time.Second)
+	defer ticker.Stop()
+	clockTicker := time.NewTicker(s.clockGuard.interval)
+	defer clockTicker.Stop()
 	for {
 		select {
+		case <-s.ctx.Done():
+			return
 		case <-ticker.C:
 			s.updateNewData(client, zkAddrNode)
+		case <-clockTicker.C:
+			s.checkClockDrift(client)
 		}
 	}
 }
 
-func (s *SnowFlakeZookeeperHolder) createNode(client *zk.Conn) string {
-	path := PATH_FOREVER + "/" + s.listenAddress + "-0000000000"
-	zkNodePaths := strings.Split(path, "/")
-	var root = "/"
-	if len(zkNodePaths) > 0 {
-		for _, p := range zkNodePaths {
-			if len(p) == 0 {
-				continue
-			}
-			root += p
-			_, err := client.Create(root, []byte{}, zk.FlagTTL, zk.WorldACL(zk.PermAll))
-			root += "/"
-			if err != nil {
-				continue
-			}
+// peerTimestamps 读取 forever 下其他节点最后上报的时间,换算为节点当前的时间:
+// 写一次 forever 节点,返回的 mtime 即服务端当前时间,节点上报时间加上其 mtime 距今的时长,
+// 已下线的节点不会因为上报时间旧被算作偏差,超过 peerStaleMillis 未上报的节点不参与计算
+func (s *SnowFlakeZookeeperHolder) peerTimestamps(client zkConn, nodes map[string]string) ([]int64, error) {
+	timestamps := make([]int64, 0, len(nodes))
+	if _, ok := nodes[s.listenAddress]; len(nodes) == 0 || (ok && len(nodes) == 1) {
+		return timestamps, nil
+	}
+	stat, err := client.Set(PATH_FOREVER, []byte{}, -1)
+	if err != nil {
+		return nil, err
+	}
+	for listenAddress, node := range nodes {
+		if listenAddress == s.listenAddress {
+			continue
+		}
+		data, peerStat, err := client.Get(PATH_FOREVER + "/" + node)
+		if err == zk.ErrNoNode {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		silent := stat.Mtime - peerStat.Mtime
+		if silent > peerStaleMillis {
+			continue
 		}
+		if silent < 0 {
+			silent = 0
+		}
+		timestamps = append(timestamps, deBuildEndpointData(data).Timestamp+silent)
 	}
-	root = strings.TrimRight(root, "/")
-	_, err := client.Create(root, s.buildData(), zk.FlagTTL, zk.WorldACL(zk.PermAll))
+	return timestamps, nil
+}
+
+func (s *SnowFlakeZookeeperHolder) checkClockDrift(client zkConn) {
+	keys, _, err := client.Children(PATH_FOREVER)
 	if err != nil {
-		logger.Infof("zk CreateValErr:%+v", err)
-		return path
+		logger.Warnf("zk children error:%v", err)
+		return
+	}
+	nodes := make(map[string]string, len(keys))
+	for _, node := range keys {
+		listenAddress, _, err := parseForeverNodeKey(node)
+		if err != nil {
+			continue
+		}
+		nodes[listenAddress] = node
+	}
+	peers, err := s.peerTimestamps(client, nodes)
+	if err != nil {
+		logger.Warnf("zk get peer timestamps error:%v", err)
+		return
+	}
+	s.clockGuard.check(peers)
+}
+
+// createNode 在 forever 下创建持久顺序节点,由 zk 分配的顺序号即 workerId
+func (s *SnowFlakeZookeeperHolder) createNode(client zkConn) (string, error) {
+	var root = ""
+	for _, p := range strings.Split(PATH_FOREVER, "/") {
+		if len(p) == 0 {
+			continue
+		}
+		root += "/" + p
+		_, err := client.Create(root, []byte{}, 0, zk.WorldACL(zk.PermAll))
+		if err != nil && err != zk.ErrNodeExists {
+			return "", err
+		}
+	}
+	return client.Create(PATH_FOREVER+"/"+s.listenAddress+"-", buildEndpointData(s.ip, s.port), zk.FlagSequence, zk.WorldACL(zk.PermAll))
+}
+
+// deleteNode 删除启动失败时新建的顺序节点,避免残留节点占用 ip:port 导致下次启动失败
+func (s *SnowFlakeZookeeperHolder) deleteNode(client zkConn, path string) {
+	if err := client.Delete(path, -1); err != nil && err != zk.ErrNoNode {
+		logger.Errorf("delete forever node %s error:%+v", path, err)
 	}
-	return path
 }
 
-func (s *SnowFlakeZookeeperHolder) updateNewData(client *zk.Conn, path string) {
+func (s *SnowFlakeZookeeperHolder) updateNewData(client zkConn, path string) {
 	if timeutil.MsTimestampNow() < s.lastUpdateTime {
 		return
 	}
@@ -156,52 +386,39 @@ func (s *SnowFlakeZookeeperHolder) updateNewData(client *zk.Conn, path string) {
 	if stat != nil {
 		version = stat.Version
 	}
-	_, err := client.Set(path, s.buildData(), version)
+	_, err := client.Set(path, buildEndpointData(s.ip, s.port), version)
 	if err != nil {
 		return
 	}
+	saveLocalWorkerID(s.port, s.WorkerId)
 	s.lastUpdateTime = timeutil.MsTimestampNow()
 	return
 }
 
-func (s *SnowFlakeZookeeperHolder) buildData() []byte {
-	endPoint := new(Endpoint)
-	endPoint.IP = s.ip
-	endPoint.Port = s.port
-	endPoint.Timestamp = timeutil.MsTimestampNow()
-	encodeArr, _ := json.Marshal(endPoint)
-	return encodeArr
-}
-
-func (s *SnowFlakeZookeeperHolder) deBuildData(val []byte) *Endpoint {
-	endPoint := new(Endpoint)
-	_ = json.Unmarshal(val, endPoint)
-	return endPoint
-}
-
-func (s *SnowFlakeZookeeperHolder) checkInitTimeStamp(client *zk.Conn, zkAddrNode string) bool {
+func (s *SnowFlakeZookeeperHolder) checkInitTimeStamp(client zkConn, zkAddrNode string) bool {
 	data, _, _ := client.Get(zkAddrNode)
-	endpoint := s.deBuildData(data)
+	endpoint := deBuildEndpointData(data)
 	return !(endpoint.Timestamp > timeutil.MsTimestampNow())
 }
 
-func (s *SnowFlakeZookeeperHolder) updateLocalWorkerID(workId int) {
-	filePath := strings.Replace(PROP_PATH, "{port}", s.port, -1)
-	if !check.CheckFileExist(filePath) {
-		dirs := filepath.Dir(filePath)
-		err := os.MkdirAll(dirs, os.ModePerm)
-		if err != nil {
-			return
-		}
-	}
-	err := ioutil.WriteFile(filePath, []byte(fmt.Sprintf("workerID=%d", workId)), os.ModePerm)
-	if err != nil {
-		logger.Infof("%+v", err)
-		return
-	}
-	return
+func (s *SnowFlakeZookeeperHolder) IsLost() bool {
+	return s.lost.Load()
 }
 
 func (s *SnowFlakeZookeeperHolder) GetWorkerId() int {
 	return s.WorkerId
 }
+
+// Close 停止心跳,上报最后一次时间戳后关闭 zk 连接
+func (s *SnowFlakeZookeeperHolder) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	if s.client != nil {
+		if len(s.ZKAddressNode) > 0 && !s.degraded {
+			s.updateNewData(s.client, s.ZKAddressNode)
+		}
+		s.client.Close()
+	}
+	saveLocalWorkerID(s.port, s.WorkerId)
+	return nil
+}
@@ -0,0 +1,411 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	zkpath "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+
+	"github.com/busyfree/leaf-go/util/timeutil"
+)
+
+type fakeZkNode struct {
+	data    []byte
+	version int32
+	mtime   int64
+	seq     int
+}
+
+// fakeZk 内存中的 zk 替身,实现 zkConn,节点的 mtime 使用 now 表示的服务端时间
+type fakeZk struct {
+	mu    sync.Mutex
+	nodes map[string]*fakeZkNode
+	now   func() int64
+	down  bool
+}
+
+func newFakeZk() *fakeZk {
+	z := new(fakeZk)
+	z.nodes = map[string]*fakeZkNode{"/": {}}
+	z.now = timeutil.MsTimestampNow
+	return z
+}
+
+func (z *fakeZk) dial() (zkConn, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.down {
+		return nil, zk.ErrNoServer
+	}
+	return z, nil
+}
+
+func (z *fakeZk) stat(n *fakeZkNode) *zk.Stat {
+	return &zk.Stat{Version: n.version, Mtime: n.mtime}
+}
+
+func (z *fakeZk) Exists(path string) (bool, *zk.Stat, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.down {
+		return false, nil, zk.ErrConnectionClosed
+	}
+	n, ok := z.nodes[path]
+	if !ok {
+		return false, nil, nil
+	}
+	return true, z.stat(n), nil
+}
+
+func (z *fakeZk) Children(path string) ([]string, *zk.Stat, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.down {
+		return nil, nil, zk.ErrConnectionClosed
+	}
+	n, ok := z.nodes[path]
+	if !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	children := make([]string, 0)
+	for p := range z.nodes {
+		if p != path && zkpath.Dir(p) == path {
+			children = append(children, zkpath.Base(p))
+		}
+	}
+	sort.Strings(children)
+	return children, z.stat(n), nil
+}
+
+func (z *fakeZk) Get(path string) ([]byte, *zk.Stat, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.down {
+		return nil, nil, zk.ErrConnectionClosed
+	}
+	n, ok := z.nodes[path]
+	if !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	return n.data, z.stat(n), nil
+}
+
+func (z *fakeZk) Set(path string, data []byte, version int32) (*zk.Stat, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.down {
+		return nil, zk.ErrConnectionClosed
+	}
+	n, ok := z.nodes[path]
+	if !ok {
+		return nil, zk.ErrNoNode
+	}
+	if version != -1 && version != n.version {
+		return nil, zk.ErrBadVersion
+	}
+	n.data = data
+	n.version++
+	n.mtime = z.now()
+	return z.stat(n), nil
+}
+
+func (z *fakeZk) Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.down {
+		return "", zk.ErrConnectionClosed
+	}
+	parent, ok := z.nodes[zkpath.Dir(path)]
+	if !ok {
+		return "", zk.ErrNoNode
+	}
+	if flags&zk.FlagSequence != 0 {
+		path = fmt.Sprintf("%s%010d", path, parent.seq)
+		parent.seq++
+	}
+	if _, ok := z.nodes[path]; ok {
+		return "", zk.ErrNodeExists
+	}
+	z.nodes[path] = &fakeZkNode{data: data, mtime: z.now()}
+	return path, nil
+}
+
+func (z *fakeZk) Delete(path string, version int32) error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.down {
+		return zk.ErrConnectionClosed
+	}
+	n, ok := z.nodes[path]
+	if !ok {
+		return zk.ErrNoNode
+	}
+	if version != -1 && version != n.version {
+		return zk.ErrBadVersion
+	}
+	delete(z.nodes, path)
+	return nil
+}
+
+func (z *fakeZk) Close() {}
+
+// setupHolderTest 本地 workerId 文件写到临时目录,协调服务使用固定的路径前缀
+func setupHolderTest(t *testing.T) {
+	oldProp, oldForever, oldSequence, oldAlive := PROP_PATH, PATH_FOREVER, PATH_SEQUENCE, PATH_ALIVE
+	PROP_PATH = filepath.Join(t.TempDir(), "{port}", "workerID.toml")
+	PATH_FOREVER = "/snowflake/test/forever"
+	PATH_SEQUENCE = "/snowflake/test/sequence"
+	PATH_ALIVE = "/snowflake/test/alive"
+	t.Cleanup(func() {
+		PROP_PATH, PATH_FOREVER, PATH_SEQUENCE, PATH_ALIVE = oldProp, oldForever, oldSequence, oldAlive
+	})
+}
+
+func newTestZookeeperHolder(z *fakeZk, port string) *SnowFlakeZookeeperHolder {
+	s := NewSnowFlakeZookeeperHolder("127.0.0.1", port, "fake")
+	s.dial = z.dial
+	return s
+}
+
+func TestZookeeperHolderRegister(t *testing.T) {
+	setupHolderTest(t)
+	z := newFakeZk()
+
+	first := newTestZookeeperHolder(z, "8001")
+	if !first.Init() {
+		t.Fatal("first registration failed")
+	}
+	second := newTestZookeeperHolder(z, "8002")
+	if !second.Init() {
+		t.Fatal("second registration failed")
+	}
+	if first.GetWorkerId() == second.GetWorkerId() {
+		t.Fatalf("two endpoints hold the same workerId %d", first.GetWorkerId())
+	}
+	if !strings.HasPrefix(first.ZKAddressNode, PATH_FOREVER+"/127.0.0.1:8001-") {
+		t.Fatalf("unexpected forever node %s", first.ZKAddressNode)
+	}
+	local, err := readLocalWorkerID("8001")
+	if err != nil || local.WorkerID != first.GetWorkerId() {
+		t.Fatalf("local workerId file = %+v, %v", local, err)
+	}
+	workerId := first.GetWorkerId()
+	_ = first.Close()
+	_ = second.Close()
+
+	// 同一个 ip:port 重启后沿用原来的 workerId,不会新建节点
+	restarted := newTestZookeeperHolder(z, "8001")
+	if !restarted.Init() {
+		t.Fatal("restart failed")
+	}
+	defer restarted.Close()
+	if restarted.GetWorkerId() != workerId {
+		t.Fatalf("restart got workerId %d, want %d", restarted.GetWorkerId(), workerId)
+	}
+	children, _, _ := z.Children(PATH_FOREVER)
+	if len(children) != 2 {
+		t.Fatalf("forever nodes = %v, want 2", children)
+	}
+}
+
+func TestZookeeperHolderRejectTimestampRollback(t *testing.T) {
+	setupHolderTest(t)
+	z := newFakeZk()
+
+	first := newTestZookeeperHolder(z, "8001")
+	if !first.Init() {
+		t.Fatal("first registration failed")
+	}
+	_ = first.Close()
+
+	// 节点上次上报的时间晚于本机时间,说明本机时钟回拨
+	future := new(Endpoint)
+	future.IP = "127.0.0.1"
+	future.Port = "8001"
+	future.Timestamp = timeutil.MsTimestampNow() + 3600*1000
+	data, _ := json.Marshal(future)
+	if _, err := z.Set(first.ZKAddressNode, data, -1); err != nil {
+		t.Fatal(err)
+	}
+	restarted := newTestZookeeperHolder(z, "8001")
+	defer restarted.Close()
+	if restarted.Init() {
+		t.Fatal("restart with clock rollback should fail")
+	}
+}
+
+func (z *fakeZk) setDown(down bool) {
+	z.mu.Lock()
+	z.down = down
+	z.mu.Unlock()
+}
+
+// startDegraded zk 不可用时使用本地文件中的 workerId 启动,随后恢复 zk 触发后台对账
+func startDegraded(t *testing.T, z *fakeZk, port string, workerId int) *SnowFlakeZookeeperHolder {
+	if err := writeLocalWorkerID(port, workerId, timeutil.MsTimestampNow()); err != nil {
+		t.Fatal(err)
+	}
+	z.setDown(true)
+	h := newTestZookeeperHolder(z, port)
+	if !h.Init() {
+		t.Fatal("degraded start failed")
+	}
+	if h.GetWorkerId() != workerId || h.IsLost() {
+		t.Fatalf("degraded start got workerId %d, lost %v", h.GetWorkerId(), h.IsLost())
+	}
+	z.setDown(false)
+	return h
+}
+
+func TestZookeeperHolderReconcileFailClosed(t *testing.T) {
+	setupHolderTest(t)
+	z := newFakeZk()
+	first := newTestZookeeperHolder(z, "8001")
+	second := newTestZookeeperHolder(z, "8002")
+	if !first.Init() || !second.Init() {
+		t.Fatal("registration failed")
+	}
+	_ = first.Close()
+	_ = second.Close()
+
+	// 本地文件记录的 workerId 与 zk 上的不一致
+	h := startDegraded(t, z, "8001", second.GetWorkerId())
+	defer h.Close()
+	if !waitFor(t, 10*time.Second, h.IsLost) {
+		t.Fatal("holder should be lost when reconciliation disagrees")
+	}
+}
+
+func TestZookeeperHolderReconcileClockSkew(t *testing.T) {
+	setupHolderTest(t)
+	z := newFakeZk()
+	first := newTestZookeeperHolder(z, "8001")
+	peer := newTestZookeeperHolder(z, "8002")
+	if !first.Init() || !peer.Init() {
+		t.Fatal("registration failed")
+	}
+	_ = first.Close()
+	_ = peer.Close()
+
+	// 降级期间其他节点上报的时间比本机快一小时
+	future := new(Endpoint)
+	future.IP = "127.0.0.1"
+	future.Port = "8002"
+	future.Timestamp = timeutil.MsTimestampNow() + 3600*1000
+	data, _ := json.Marshal(future)
+	if _, err := z.Set(peer.ZKAddressNode, data, -1); err != nil {
+		t.Fatal(err)
+	}
+	h := startDegraded(t, z, "8001", first.GetWorkerId())
+	defer h.Close()
+	if !waitFor(t, 10*time.Second, h.IsLost) {
+		t.Fatal("holder should be lost when the clock guard reports skew while degraded")
+	}
+}
+
+func TestZookeeperHolderClockSkewByServerTime(t *testing.T) {
+	setupHolderTest(t)
+	z := newFakeZk()
+	peer := newTestZookeeperHolder(z, "8002")
+	if !peer.Init() {
+		t.Fatal("peer registration failed")
+	}
+	_ = peer.Close()
+
+	// 本机时钟比其他节点快一小时,按本机时间所有节点都像已下线,按 zk 服务端 mtime 节点仍在线
+	past := new(Endpoint)
+	past.IP = "127.0.0.1"
+	past.Port = "8002"
+	past.Timestamp = timeutil.MsTimestampNow() - 3600*1000
+	data, _ := json.Marshal(past)
+	if _, err := z.Set(peer.ZKAddressNode, data, -1); err != nil {
+		t.Fatal(err)
+	}
+	h := newTestZookeeperHolder(z, "8001")
+	defer h.Close()
+	if h.Init() {
+		t.Fatal("init should fail when clock skew against live peers is too large")
+	}
+
+	// 按服务端时间已经下线的节点不参与计算
+	z.mu.Lock()
+	z.now = func() int64 { return timeutil.MsTimestampNow() + peerStaleMillis + 1000 }
+	z.mu.Unlock()
+	restarted := newTestZookeeperHolder(z, "8001")
+	defer restarted.Close()
+	if !restarted.Init() {
+		t.Fatal("stale peers should be ignored by server time")
+	}
+}
+
+// TestZookeeperHolderCreateNodeCleanup 新建的顺序节点超出 workerId 范围或与已有节点冲突时,启动失败并删除该节点
+func TestZookeeperHolderCreateNodeCleanup(t *testing.T) {
+	setupHolderTest(t)
+
+	z := newFakeZk()
+	for _, p := range []string{"/snowflake", "/snowflake/test", PATH_FOREVER} {
+		z.nodes[p] = &fakeZkNode{}
+	}
+	z.nodes[PATH_FOREVER].seq = maxWorkerId + 1
+	if newTestZookeeperHolder(z, "8001").Init() {
+		t.Fatal("init with out of range workerId should fail")
+	}
+	if children, _, _ := z.Children(PATH_FOREVER); len(children) != 0 {
+		t.Fatalf("out of range node left behind: %v", children)
+	}
+
+	z = newFakeZk()
+	for _, p := range []string{"/snowflake", "/snowflake/test", PATH_FOREVER} {
+		z.nodes[p] = &fakeZkNode{}
+	}
+	held := PATH_FOREVER + "/10.0.0.9:8009-0000000000"
+	z.nodes[held] = &fakeZkNode{data: buildEndpointData("10.0.0.9", "8009"), mtime: z.now()}
+	if newTestZookeeperHolder(z, "8001").Init() {
+		t.Fatal("init with a workerId held by another endpoint should fail")
+	}
+	if children, _, _ := z.Children(PATH_FOREVER); len(children) != 1 || PATH_FOREVER+"/"+children[0] != held {
+		t.Fatalf("colliding node left behind: %v", children)
+	}
+}
+
+// TestZookeeperHolderClockSkewStalePeer 刚下线的节点上报时间旧,按 mtime 换算到当前时间后不算作偏差
+func TestZookeeperHolderClockSkewStalePeer(t *testing.T) {
+	setupHolderTest(t)
+	z := newFakeZk()
+
+	live := newTestZookeeperHolder(z, "8002")
+	if !live.Init() {
+		t.Fatal("live peer init failed")
+	}
+	defer live.Close()
+	stale := newTestZookeeperHolder(z, "8003")
+	if !stale.Init() {
+		t.Fatal("stale peer init failed")
+	}
+	_ = stale.Close()
+	// 节点 20 秒前最后一次上报后崩溃
+	z.mu.Lock()
+	silent := int64(20 * 1000)
+	node := z.nodes[stale.ZKAddressNode]
+	endpoint := deBuildEndpointData(node.data)
+	endpoint.Timestamp -= silent
+	node.data, _ = json.Marshal(endpoint)
+	node.mtime -= silent
+	z.mu.Unlock()
+
+	h := newTestZookeeperHolder(z, "8001")
+	defer h.Close()
+	if !h.Init() {
+		t.Fatal("a recently stopped peer should not be counted as clock skew")
+	}
+	if h.clockGuard.IsSkewed() {
+		t.Fatal("clock guard should not be skewed")
+	}
+}
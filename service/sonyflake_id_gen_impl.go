@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/busyfree/leaf-go/models"
+	"github.com/busyfree/leaf-go/util/timeutil"
+)
+
+// Sonyflake 布局: 39 位时间戳(10 毫秒为单位) + 8 位序列号 + 16 位 machineId
+const (
+	sonyflakeTimeUnit      = 10
+	sonyflakeTimeBits      = 39
+	sonyflakeSequenceBits  = 8
+	sonyflakeMachineIdBits = 16
+	sonyflakeSequenceMask  = 1<<sonyflakeSequenceBits - 1
+	sonyflakeMachineIdMask = 1<<sonyflakeMachineIdBits - 1
+	sonyflakeMaxElapsed    = 1<<sonyflakeTimeBits - 1
+)
+
+// sonyflakeDefaultStartTime Sonyflake 默认起始时间 2014-09-01 00:00:00 UTC
+var sonyflakeDefaultStartTime = time.Date(2014, 9, 1, 0, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)
+
+// SonyflakeIdGenImpl 与 github.com/sony/sonyflake 生成规则一致,用于合并已有 Sonyflake 服务
+type SonyflakeIdGenImpl struct {
+	startTime   int64
+	machineId   int64
+	elapsedTime int64
+	sequence    int64
+	mu          sync.Mutex
+}
+
+func NewSonyflakeIdGenImpl(startTime int64, machineId int64) *SonyflakeIdGenImpl {
+	s := new(SonyflakeIdGenImpl)
+	if startTime <= 0 {
+		startTime = sonyflakeDefaultStartTime
+	}
+	if !(timeutil.MsTimestampNow() > startTime) {
+		panic("Sonyflake not support start time gt currentTime")
+	}
+	if machineId < 0 || machineId > sonyflakeMachineIdMask {
+		panic(fmt.Sprintf("sonyflake machineId must gte 0 and lte %d", sonyflakeMachineIdMask))
+	}
+	s.startTime = startTime
+	s.machineId = machineId
+	s.sequence = sonyflakeSequenceMask
+	return s
+}
+
+func (s *SonyflakeIdGenImpl) Init(ctx context.Context) bool {
+	return true
+}
+
+// Get 序列号用尽或时钟回拨时沿用 Sonyflake 的做法:借用下一个时间单位并休眠到追上
+func (s *SonyflakeIdGenImpl) Get(ctx context.Context, key string) models.Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current := s.currentElapsedTime()
+	if s.elapsedTime < current {
+		s.elapsedTime = current
+		s.sequence = 0
+	} else {
+		s.sequence = (s.sequence + 1) & sonyflakeSequenceMask
+		if s.sequence == 0 {
+			s.elapsedTime++
+			overtime := s.elapsedTime - current
+			time.Sleep(time.Duration(overtime*sonyflakeTimeUnit)*time.Millisecond - time.Duration(time.Now().UnixNano()%int64(sonyflakeTimeUnit*time.Millisecond)))
+		}
+	}
+	if s.elapsedTime > sonyflakeMaxElapsed {
+		logger.Errorf("sonyflake elapsed time-{%d} overflow, start time-{%d} is too old", s.elapsedTime, s.startTime)
+		return models.Result{Id: -3, Status: models.EXCEPTION}
+	}
+	id := s.elapsedTime<<(sonyflakeSequenceBits+sonyflakeMachineIdBits) | s.sequence<<sonyflakeMachineIdBits | s.machineId
+	return models.Result{Id: id, Status: models.SUCCESS}
+}
+
+func (s *SonyflakeIdGenImpl) currentElapsedTime() int64 {
+	return (timeutil.MsTimestampNow() - s.startTime) / sonyflakeTimeUnit
+}
+
+// Decode 解析 Sonyflake ID 的时间戳、序列号和 machineId
+func (s *SonyflakeIdGenImpl) Decode(id int64) map[string]interface{} {
+	var out = make(map[string]interface{}, 0)
+	originTimestamp := (id>>(sonyflakeSequenceBits+sonyflakeMachineIdBits))*sonyflakeTimeUnit + s.startTime
+	out["format"] = "sonyflake"
+	out["timestamp"] = fmt.Sprintf("%d (%s)", originTimestamp, timeutil.MsTimestamp2Time(originTimestamp).Format("2006-01-02 15:04:05.000"))
+	out["machineId"] = id & sonyflakeMachineIdMask
+	out["sequenceId"] = (id >> sonyflakeMachineIdBits) & sonyflakeSequenceMask
+	return out
+}
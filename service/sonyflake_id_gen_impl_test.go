@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/busyfree/leaf-go/models"
+	"github.com/busyfree/leaf-go/util/timeutil"
+)
+
+func TestSonyflakeLayout(t *testing.T) {
+	s := NewSonyflakeIdGenImpl(0, 0xBEEF)
+	ctx := context.Background()
+
+	before := timeutil.MsTimestampNow()
+	r := s.Get(ctx, "sony")
+	after := timeutil.MsTimestampNow()
+	if r.Status != models.SUCCESS {
+		t.Fatalf("status %d", r.Status)
+	}
+	// 从低到高依次为 16 位 machineId、8 位序列号、39 位 10 毫秒时间戳
+	if machineId := r.Id & 0xFFFF; machineId != 0xBEEF {
+		t.Fatalf("machineId = %#x, want 0xbeef", machineId)
+	}
+	if sequence := (r.Id >> 16) & 0xFF; sequence != 0 {
+		t.Fatalf("first sequence = %d, want 0", sequence)
+	}
+	elapsed := r.Id >> 24
+	if elapsed < (before-sonyflakeDefaultStartTime)/10 || elapsed > (after-sonyflakeDefaultStartTime)/10 {
+		t.Fatalf("elapsed %d not in 10ms units since 2014-09-01", elapsed)
+	}
+}
+
+func TestSonyflakeTenMillisecondTick(t *testing.T) {
+	s := NewSonyflakeIdGenImpl(0, 1)
+	ctx := context.Background()
+
+	// 每 10 毫秒最多 256 个 ID,用尽后借用下一个 10 毫秒并休眠到追上
+	perTick := make(map[int64]int)
+	var last int64
+	for i := 0; i < 256*4; i++ {
+		r := s.Get(ctx, "sony")
+		if r.Status != models.SUCCESS || r.Id <= last {
+			t.Fatalf("id %d after %d status %d", r.Id, last, r.Status)
+		}
+		last = r.Id
+		elapsed := r.Id >> 24
+		perTick[elapsed]++
+		if ahead := elapsed - (timeutil.MsTimestampNow()-sonyflakeDefaultStartTime)/10; ahead > 1 {
+			t.Fatalf("elapsed %d is %d ticks ahead of now", elapsed, ahead)
+		}
+	}
+	if len(perTick) < 4 {
+		t.Fatalf("1024 ids used %d ticks, want at least 4", len(perTick))
+	}
+	for elapsed, n := range perTick {
+		if n > 256 {
+			t.Fatalf("tick %d has %d ids", elapsed, n)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"time"
+
+	"github.com/busyfree/leaf-go/models"
+	"github.com/busyfree/leaf-go/util/timeutil"
+)
+
+// crockfordAlphabet Crockford Base32 字符表,去掉了 I L O U
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// UlidIdGenImpl 生成 ULID: 48 位毫秒时间戳 + 80 位随机数,编码为 26 位 Crockford Base32。
+// 同一毫秒内随机数在上一个值的基础上加 1,保证本节点生成的 ULID 单调递增
+type UlidIdGenImpl struct {
+	lastTimestamp int64
+	entropy       [10]byte
+	mu            sync.Mutex
+}
+
+func NewUlidIdGenImpl() *UlidIdGenImpl {
+	s := new(UlidIdGenImpl)
+	return s
+}
+
+func (s *UlidIdGenImpl) Init(ctx context.Context) bool {
+	return true
+}
+
+func (s *UlidIdGenImpl) GetString(ctx context.Context, key string) models.StringResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ts := timeutil.MsTimestampNow()
+	if ts <= s.lastTimestamp {
+		// 同一毫秒或时钟回拨时沿用上一个时间戳递增,80 位随机数溢出时等到下一毫秒
+		ts = s.lastTimestamp
+		if !s.incrEntropy() {
+			for ts <= s.lastTimestamp {
+				time.Sleep(time.Millisecond)
+				ts = timeutil.MsTimestampNow()
+			}
+			if _, err := rand.Read(s.entropy[:]); err != nil {
+				return models.NewStringResult("", models.EXCEPTION)
+			}
+		}
+	} else if _, err := rand.Read(s.entropy[:]); err != nil {
+		return models.NewStringResult("", models.EXCEPTION)
+	}
+	s.lastTimestamp = ts
+	return models.NewStringResult(encodeUlid(ts, s.entropy), models.SUCCESS)
+}
+
+// incrEntropy 80 位随机数加 1,溢出返回 false
+func (s *UlidIdGenImpl) incrEntropy() bool {
+	for i := len(s.entropy) - 1; i >= 0; i-- {
+		s.entropy[i]++
+		if s.entropy[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeUlid(ts int64, entropy [10]byte) string {
+	var id [16]byte
+	id[0] = byte(ts >> 40)
+	id[1] = byte(ts >> 32)
+	id[2] = byte(ts >> 24)
+	id[3] = byte(ts >> 16)
+	id[4] = byte(ts >> 8)
+	id[5] = byte(ts)
+	copy(id[6:], entropy[:])
+	// 128 位按 5 位一组编码,首字符只有 3 位有效
+	var out [26]byte
+	var acc uint
+	var bits uint = 2
+	pos := 0
+	for _, b := range id {
+		acc = acc<<8 | uint(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			out[pos] = crockfordAlphabet[(acc>>bits)&0x1f]
+			pos++
+		}
+	}
+	return string(out[:])
+}
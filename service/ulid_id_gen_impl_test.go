@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/busyfree/leaf-go/models"
+	"github.com/busyfree/leaf-go/util/timeutil"
+)
+
+// decodeUlidTime 解析 ULID 前 10 个字符中的 48 位毫秒时间戳
+func decodeUlidTime(id string) int64 {
+	var ts int64
+	for _, c := range id[:10] {
+		ts = ts<<5 | int64(strings.IndexRune(crockfordAlphabet, c))
+	}
+	return ts
+}
+
+func TestUlidMonotonic(t *testing.T) {
+	s := NewUlidIdGenImpl()
+	ctx := context.Background()
+
+	// 同一毫秒内随机数递增,字符串按字典序递增
+	var last string
+	sameMs := 0
+	for i := 0; i < 1000; i++ {
+		r := s.GetString(ctx, "ulid")
+		if r.Status != models.SUCCESS || len(r.Id) != 26 || r.Id <= last {
+			t.Fatalf("ulid %q after %q status %d", r.Id, last, r.Status)
+		}
+		if len(last) > 0 && r.Id[:10] == last[:10] {
+			sameMs++
+		}
+		last = r.Id
+	}
+	if sameMs == 0 {
+		t.Fatal("no ulids generated within the same millisecond")
+	}
+
+	// 时钟回拨 1 秒后沿用上一个时间戳继续递增
+	future := timeutil.MsTimestampNow() + 1000
+	s.lastTimestamp = future
+	prev := s.GetString(ctx, "ulid").Id
+	for i := 0; i < 100; i++ {
+		r := s.GetString(ctx, "ulid")
+		if r.Status != models.SUCCESS || r.Id <= prev {
+			t.Fatalf("ulid %q after %q status %d", r.Id, prev, r.Status)
+		}
+		if ts := decodeUlidTime(r.Id); ts != future {
+			t.Fatalf("ulid timestamp %d after clock moved back, want %d", ts, future)
+		}
+		prev = r.Id
+	}
+}
+
+func BenchmarkUlidGetString(b *testing.B) {
+	s := NewUlidIdGenImpl()
+	ctx := context.Background()
+	s.Init(ctx)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.GetString(ctx, "bench")
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/busyfree/leaf-go/models"
+	"github.com/busyfree/leaf-go/util/timeutil"
+)
+
+// UuidV7IdGenImpl 按 RFC 9562 生成 UUIDv7: 48 位毫秒时间戳 + 4 位版本 + 12 位计数器(rand_a) + 2 位变体 + 62 位 rand_b。
+// rand_a 作为同一毫秒内的递增计数器保证单调,rand_b 高 10 位写入 snowflake workerId 避免多节点冲突,其余 52 位随机
+type UuidV7IdGenImpl struct {
+	workerId      int64
+	lastTimestamp int64
+	counter       int64
+	mu            sync.Mutex
+}
+
+const uuidV7CounterMask = 1<<12 - 1
+
+func NewUuidV7IdGenImpl(workerId int64) *UuidV7IdGenImpl {
+	s := new(UuidV7IdGenImpl)
+	s.workerId = workerId & int64(maxWorkerId)
+	return s
+}
+
+func (s *UuidV7IdGenImpl) Init(ctx context.Context) bool {
+	return true
+}
+
+func (s *UuidV7IdGenImpl) GetString(ctx context.Context, key string) models.StringResult {
+	var random [8]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return models.NewStringResult("", models.EXCEPTION)
+	}
+	s.mu.Lock()
+	ts := timeutil.MsTimestampNow()
+	if ts <= s.lastTimestamp {
+		// 同一毫秒或时钟回拨时沿用上一个时间戳,计数器用尽后等到下一毫秒
+		ts = s.lastTimestamp
+		s.counter++
+		if s.counter > uuidV7CounterMask {
+			for ts <= s.lastTimestamp {
+				time.Sleep(time.Millisecond)
+				ts = timeutil.MsTimestampNow()
+			}
+			s.counter = 0
+		}
+	} else {
+		// 新的毫秒计数器从 [0,1024) 随机开始,保留足够的递增空间
+		s.counter = int64(random[0]) << 2
+	}
+	s.lastTimestamp = ts
+	counter := s.counter
+	s.mu.Unlock()
+
+	var id [16]byte
+	id[0] = byte(ts >> 40)
+	id[1] = byte(ts >> 32)
+	id[2] = byte(ts >> 24)
+	id[3] = byte(ts >> 16)
+	id[4] = byte(ts >> 8)
+	id[5] = byte(ts)
+	id[6] = 0x70 | byte(counter>>8)
+	id[7] = byte(counter)
+	// rand_b: 2 位变体 10 + 10 位 workerId + 52 位随机数
+	randB := uint64(0x2)<<62 | uint64(s.workerId)<<52 | (uint64(random[1])<<48|uint64(random[2])<<40|uint64(random[3])<<32|
+		uint64(random[4])<<24|uint64(random[5])<<16|uint64(random[6])<<8|uint64(random[7]))&(1<<52-1)
+	for i := 0; i < 8; i++ {
+		id[8+i] = byte(randB >> (56 - 8*uint(i)))
+	}
+	return models.NewStringResult(formatUuid(id), models.SUCCESS)
+}
+
+func formatUuid(id [16]byte) string {
+	var out [36]byte
+	hex.Encode(out[0:8], id[0:4])
+	out[8] = '-'
+	hex.Encode(out[9:13], id[4:6])
+	out[13] = '-'
+	hex.Encode(out[14:18], id[6:8])
+	out[18] = '-'
+	hex.Encode(out[19:23], id[8:10])
+	out[23] = '-'
+	hex.Encode(out[24:], id[10:])
+	return string(out[:])
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/busyfree/leaf-go/models"
+	"github.com/busyfree/leaf-go/util/timeutil"
+)
+
+func parseUuid(t *testing.T, s string) [16]byte {
+	var id [16]byte
+	b, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil || len(b) != 16 || len(s) != 36 {
+		t.Fatalf("invalid uuid %q", s)
+	}
+	copy(id[:], b)
+	return id
+}
+
+func TestUuidV7Bits(t *testing.T) {
+	s := NewUuidV7IdGenImpl(0x2A5)
+	ctx := context.Background()
+
+	before := timeutil.MsTimestampNow()
+	var last string
+	for i := 0; i < 1000; i++ {
+		r := s.GetString(ctx, "uuid")
+		if r.Status != models.SUCCESS || r.Id <= last {
+			t.Fatalf("uuid %q after %q status %d", r.Id, last, r.Status)
+		}
+		last = r.Id
+		id := parseUuid(t, r.Id)
+		if version := id[6] >> 4; version != 7 {
+			t.Fatalf("uuid %s version = %d, want 7", r.Id, version)
+		}
+		if variant := id[8] >> 6; variant != 2 {
+			t.Fatalf("uuid %s variant = %b, want 10", r.Id, variant)
+		}
+		// rand_b 的变体之后 10 位为 workerId
+		if workerId := (int64(id[8]&0x3F)<<4 | int64(id[9]>>4)); workerId != 0x2A5 {
+			t.Fatalf("uuid %s workerId = %#x, want 0x2a5", r.Id, workerId)
+		}
+		var ts int64
+		for _, b := range id[:6] {
+			ts = ts<<8 | int64(b)
+		}
+		if ts < before || ts > timeutil.MsTimestampNow() {
+			t.Fatalf("uuid %s timestamp %d out of range", r.Id, ts)
+		}
+	}
+}
+
+func TestUuidV7ClockBackwards(t *testing.T) {
+	s := NewUuidV7IdGenImpl(1)
+	ctx := context.Background()
+
+	// 时钟回拨 1 秒后沿用上一个时间戳,计数器递增保证单调
+	s.lastTimestamp = timeutil.MsTimestampNow() + 1000
+	prev := s.GetString(ctx, "uuid").Id
+	for i := 0; i < 100; i++ {
+		r := s.GetString(ctx, "uuid")
+		if r.Status != models.SUCCESS || r.Id <= prev {
+			t.Fatalf("uuid %q after %q status %d", r.Id, prev, r.Status)
+		}
+		prev = r.Id
+	}
+}
+
+func BenchmarkUuidV7GetString(b *testing.B) {
+	s := NewUuidV7IdGenImpl(1)
+	ctx := context.Background()
+	s.Init(ctx)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.GetString(ctx, "bench")
+		}
+	})
+}
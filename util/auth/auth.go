@@ -0,0 +1,145 @@
+// Package auth 接口签名校验和权限判断
+//
+// 调用方通过 X-Leaf-AppKey、X-Leaf-Ts、X-Leaf-Sign 请求头(或同名的 appkey、ts、sign 查询参数)传递身份。
+// sign 为 HMAC-SHA256(secret, appkey\nts\nmethod\npath\nquery) 的十六进制,ts 为秒级时间戳,
+// query 为去掉 appkey、ts、sign 后按参数名排序并 URL 编码的查询参数。secret 不在请求中传输,sign 直接传 secret 会被拒绝。
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/ctxkit"
+)
+
+// 权限范围,api 可以发号,admin 可以访问 /acp/ 管理接口
+const (
+	ScopeAPI   = "api"
+	ScopeAdmin = "admin"
+)
+
+const (
+	HeaderAppKey = "X-Leaf-AppKey"
+	HeaderTs     = "X-Leaf-Ts"
+	HeaderSign   = "X-Leaf-Sign"
+)
+
+// Enabled 是否开启接口鉴权
+func Enabled() bool {
+	return conf.GetBool("LEAF_AUTH_ENABLE")
+}
+
+// FromRequest 读取请求中的签名信息,请求头优先
+func FromRequest(r *http.Request) (appkey, ts, sign string) {
+	appkey = r.Header.Get(HeaderAppKey)
+	ts = r.Header.Get(HeaderTs)
+	sign = r.Header.Get(HeaderSign)
+	if len(appkey) == 0 {
+		q := r.URL.Query()
+		appkey, ts, sign = q.Get("appkey"), q.Get("ts"), q.Get("sign")
+	}
+	return
+}
+
+// CanonicalQuery 参与签名的查询参数,去掉 appkey、ts、sign 后按参数名排序并 URL 编码
+func CanonicalQuery(q url.Values) string {
+	if len(q) == 0 {
+		return ""
+	}
+	c := make(url.Values, len(q))
+	for k, v := range q {
+		if k == "appkey" || k == "ts" || k == "sign" {
+			continue
+		}
+		c[k] = v
+	}
+	return c.Encode()
+}
+
+// Sign 计算 HMAC 签名,供客户端使用,query 为 CanonicalQuery 的结果
+func Sign(secret, appkey, ts, method, path, query string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(appkey + "\n" + ts + "\n" + strings.ToUpper(method) + "\n" + path + "\n" + query))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 校验签名,appkey 需在 [LEAF_AUTH_KEYS] 中配置,ts 必填
+func Verify(appkey, ts, sign, method, path, query string) bool {
+	if len(appkey) == 0 || len(ts) == 0 || len(sign) == 0 {
+		return false
+	}
+	// viper 的 map key 统一转为小写,appkey 按小写匹配
+	secret, ok := conf.GetStrMapStr("LEAF_AUTH_KEYS")[strings.ToLower(appkey)]
+	if !ok || len(secret) == 0 {
+		return false
+	}
+	// 直接传 secret 说明 secret 已经泄露到请求日志中,拒绝
+	if subtle.ConstantTimeCompare([]byte(sign), []byte(secret)) == 1 {
+		return false
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+	skew := conf.GetInt64("LEAF_AUTH_TS_SKEW")
+	if skew <= 0 {
+		skew = 300
+	}
+	if diff := time.Now().Unix() - sec; diff > skew || diff < -skew {
+		return false
+	}
+	return hmac.Equal([]byte(strings.ToLower(sign)), []byte(Sign(secret, appkey, ts, method, path, query)))
+}
+
+// HasScope ctx 中的调用方签名正确且拥有 scope 权限,未开启鉴权时总是返回 true。
+// 未在 [LEAF_AUTH_SCOPES] 中配置的 appkey 只有 api 权限,admin 包含所有权限
+func HasScope(ctx context.Context, scope string) bool {
+	if !Enabled() {
+		return true
+	}
+	if !ctxkit.IsValidSignKey(ctx) {
+		return false
+	}
+	appkey, _, _ := ctxkit.GetSign(ctx)
+	scopes, ok := conf.GetStrMapStr("LEAF_AUTH_SCOPES")[strings.ToLower(appkey)]
+	if !ok {
+		return scope == ScopeAPI
+	}
+	return inList(scopes, scope) || inList(scopes, ScopeAdmin)
+}
+
+// AllowTag ctx 中的调用方是否可以使用 biz tag,未开启鉴权时总是返回 true。
+// admin 权限可以使用所有 tag,其余 appkey 只能使用 [LEAF_AUTH_TAGS] 中列出的 tag,* 表示所有 tag
+func AllowTag(ctx context.Context, tag string) bool {
+	if !Enabled() {
+		return true
+	}
+	if HasScope(ctx, ScopeAdmin) {
+		return true
+	}
+	if !HasScope(ctx, ScopeAPI) {
+		return false
+	}
+	appkey, _, _ := ctxkit.GetSign(ctx)
+	tags := conf.GetStrMapStr("LEAF_AUTH_TAGS")[strings.ToLower(appkey)]
+	return inList(tags, "*") || inList(tags, tag)
+}
+
+// inList list 为逗号分隔的列表
+func inList(list, s string) bool {
+	for _, v := range strings.Split(list, ",") {
+		if strings.TrimSpace(v) == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/busyfree/leaf-go/util/conf"
+)
+
+func TestVerify(t *testing.T) {
+	conf.Set("LEAF_AUTH_KEYS", `{"order-svc": "s3cret"}`)
+	defer conf.Set("LEAF_AUTH_KEYS", "{}")
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	q, _ := url.ParseQuery("count=10&appkey=order-svc&ts=" + ts + "&format=base62")
+	query := CanonicalQuery(q)
+	if query != "count=10&format=base62" {
+		t.Fatalf("canonical query %q", query)
+	}
+	sign := Sign("s3cret", "order-svc", ts, "GET", "/web/v2/snowflake/order", query)
+
+	if !Verify("order-svc", ts, sign, "get", "/web/v2/snowflake/order", query) {
+		t.Fatal("valid signature rejected")
+	}
+	// appkey 按小写查找 secret,签名使用请求中的原样 appkey
+	if !Verify("Order-Svc", ts, Sign("s3cret", "Order-Svc", ts, "GET", "/web/v2/snowflake/order", query), "GET", "/web/v2/snowflake/order", query) {
+		t.Fatal("mixed case appkey rejected")
+	}
+	// 查询参数、路径或方法被改动
+	if Verify("order-svc", ts, sign, "GET", "/web/v2/snowflake/order", "count=1000&format=base62") {
+		t.Fatal("tampered query accepted")
+	}
+	if Verify("order-svc", ts, sign, "GET", "/web/v2/segment/order", query) {
+		t.Fatal("tampered path accepted")
+	}
+	if Verify("order-svc", ts, sign, "POST", "/web/v2/snowflake/order", query) {
+		t.Fatal("tampered method accepted")
+	}
+	// 直接传 secret,带不带 ts 都拒绝
+	if Verify("order-svc", "", "s3cret", "GET", "/web/v2/snowflake/order", query) {
+		t.Fatal("raw secret without ts accepted")
+	}
+	if Verify("order-svc", ts, "s3cret", "GET", "/web/v2/snowflake/order", query) {
+		t.Fatal("raw secret with ts accepted")
+	}
+	// 过期的 ts
+	old := strconv.FormatInt(time.Now().Unix()-3600, 10)
+	if Verify("order-svc", old, Sign("s3cret", "order-svc", old, "GET", "/web/v2/snowflake/order", query), "GET", "/web/v2/snowflake/order", query) {
+		t.Fatal("expired ts accepted")
+	}
+}
@@ -295,6 +295,18 @@ func WithTraceID(ctx context.Context, traceID string) context.Context {
 	return context.WithValue(ctx, TraceIDKey, traceID)
 }
 
+// WithSign 注入接口签名信息
+func WithSign(ctx context.Context, appkey, ts, sign string) context.Context {
+	ctx = context.WithValue(ctx, AppKeyKey, appkey)
+	ctx = context.WithValue(ctx, TSKey, ts)
+	return context.WithValue(ctx, SignKey, sign)
+}
+
+// WithValidSign 注入签名校验结果
+func WithValidSign(ctx context.Context, valid bool) context.Context {
+	return context.WithValue(ctx, IsValidSignKeyKey, valid)
+}
+
 // WithHttpReq 注入 HttpRawReqKey
 func WithHttpReq(ctx context.Context, req *http.Request) context.Context {
 	return context.WithValue(ctx, HttpRawReqKey, req)
@@ -323,6 +335,7 @@ func GetCookie(ctx context.Context) string {
 	return key
 }
 
+// GetSign 获取接口签名信息
 func GetSign(ctx context.Context) (appkey, ts, sign string) {
 	appkey, _ = ctx.Value(AppKeyKey).(string)
 	ts, _ = ctx.Value(TSKey).(string)
@@ -0,0 +1,222 @@
+// Package idcodec 把 int64 ID 编码为短字符串,支持 base62、Crockford base32 和加盐混淆
+package idcodec
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Base62 0-9A-Za-z
+	Base62 = "base62"
+	// Base32 Crockford base32,不区分大小写,去掉了易混淆的 I L O U
+	Base32 = "base32"
+	// Obfuscate 加盐 Feistel 置换后再 base62 编码,连续 ID 编码后不可预测,固定 11 位
+	Obfuscate = "obfuscate"
+)
+
+const (
+	base62Alphabet    = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	// 64 位无符号整数 base62 编码最多 11 位
+	obfuscateWidth = 11
+	feistelRounds  = 6
+)
+
+var (
+	ErrNegativeId      = errors.New("idcodec: negative id")
+	ErrInvalidCode     = errors.New("idcodec: invalid code")
+	ErrUnknownEncoding = errors.New("idcodec: unknown encoding")
+	// ErrEmptySalt 空 salt 的置换密钥是公开可推导的,obfuscate 必须配置 salt
+	ErrEmptySalt = errors.New("idcodec: obfuscate requires a non-empty salt")
+)
+
+// IsValidEncoding 是否为支持的编码方式
+func IsValidEncoding(encoding string) bool {
+	switch encoding {
+	case Base62, Base32, Obfuscate:
+		return true
+	}
+	return false
+}
+
+// Encode 按 encoding 编码 id,salt 只在 obfuscate 时使用
+func Encode(encoding, salt string, id int64) (string, error) {
+	if id < 0 {
+		return "", ErrNegativeId
+	}
+	switch encoding {
+	case Base62:
+		return encodeBase(uint64(id), base62Alphabet, 0), nil
+	case Base32:
+		return encodeBase(uint64(id), crockfordAlphabet, 0), nil
+	case Obfuscate:
+		if len(salt) == 0 {
+			return "", ErrEmptySalt
+		}
+		return NewObfuscator(salt).Encode(id), nil
+	}
+	return "", ErrUnknownEncoding
+}
+
+// Decode Encode 的逆过程
+func Decode(encoding, salt, code string) (int64, error) {
+	switch encoding {
+	case Base62:
+		v, err := decodeBase(code, base62Alphabet)
+		if err != nil || v > 1<<63-1 {
+			return 0, ErrInvalidCode
+		}
+		return int64(v), nil
+	case Base32:
+		v, err := decodeBase(normalizeCrockford(code), crockfordAlphabet)
+		if err != nil || v > 1<<63-1 {
+			return 0, ErrInvalidCode
+		}
+		return int64(v), nil
+	case Obfuscate:
+		if len(salt) == 0 {
+			return 0, ErrEmptySalt
+		}
+		return NewObfuscator(salt).Decode(code)
+	}
+	return 0, ErrUnknownEncoding
+}
+
+func encodeBase(v uint64, alphabet string, width int) string {
+	base := uint64(len(alphabet))
+	var buf [64]byte
+	i := len(buf)
+	for {
+		i--
+		buf[i] = alphabet[v%base]
+		v /= base
+		if v == 0 {
+			break
+		}
+	}
+	for len(buf)-i < width {
+		i--
+		buf[i] = alphabet[0]
+	}
+	return string(buf[i:])
+}
+
+func decodeBase(code string, alphabet string) (uint64, error) {
+	if len(code) == 0 {
+		return 0, ErrInvalidCode
+	}
+	base := uint64(len(alphabet))
+	var v uint64
+	for i := 0; i < len(code); i++ {
+		idx := strings.IndexByte(alphabet, code[i])
+		if idx < 0 {
+			return 0, ErrInvalidCode
+		}
+		next := v*base + uint64(idx)
+		if (next-uint64(idx))/base != v {
+			return 0, ErrInvalidCode
+		}
+		v = next
+	}
+	return v, nil
+}
+
+// normalizeCrockford 转大写,去掉分隔符 -,I L 视为 1,O 视为 0
+func normalizeCrockford(code string) string {
+	code = strings.ToUpper(strings.ReplaceAll(code, "-", ""))
+	return strings.NewReplacer("I", "1", "L", "1", "O", "0").Replace(code)
+}
+
+// Obfuscator 以 salt 派生轮密钥,对 64 位 ID 做 Feistel 置换,可逆且不同 salt 结果不同
+type Obfuscator struct {
+	keys [feistelRounds]uint32
+}
+
+func NewObfuscator(salt string) *Obfuscator {
+	o := new(Obfuscator)
+	sum := sha256.Sum256([]byte(salt))
+	for i := 0; i < feistelRounds; i++ {
+		o.keys[i] = binary.BigEndian.Uint32(sum[i*4:])
+	}
+	return o
+}
+
+func (o *Obfuscator) Encode(id int64) string {
+	return encodeBase(o.permute(uint64(id)), base62Alphabet, obfuscateWidth)
+}
+
+func (o *Obfuscator) Decode(code string) (int64, error) {
+	if len(code) != obfuscateWidth {
+		return 0, ErrInvalidCode
+	}
+	v, err := decodeBase(code, base62Alphabet)
+	if err != nil {
+		return 0, err
+	}
+	id := o.unpermute(v)
+	if id > 1<<63-1 {
+		return 0, fmt.Errorf("%w: salt mismatch", ErrInvalidCode)
+	}
+	return int64(id), nil
+}
+
+func (o *Obfuscator) permute(v uint64) uint64 {
+	l, r := uint32(v>>32), uint32(v)
+	for i := 0; i < feistelRounds; i++ {
+		l, r = r, l^feistelRound(r, o.keys[i])
+	}
+	return uint64(l)<<32 | uint64(r)
+}
+
+func (o *Obfuscator) unpermute(v uint64) uint64 {
+	l, r := uint32(v>>32), uint32(v)
+	for i := feistelRounds - 1; i >= 0; i-- {
+		l, r = r^feistelRound(l, o.keys[i]), l
+	}
+	return uint64(l)<<32 | uint64(r)
+}
+
+// feistelRound murmur3 的 fmix32,混入轮密钥
+func feistelRound(x, key uint32) uint32 {
+	x ^= key
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return x
+}
+
+// LuhnDigit 计算数字串的 Luhn 校验位,非数字字符忽略
+func LuhnDigit(s string) byte {
+	sum := 0
+	double := true
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// LuhnValid 校验末位为 Luhn 校验位的数字串
+func LuhnValid(s string) bool {
+	if len(s) < 2 {
+		return false
+	}
+	return LuhnDigit(s[:len(s)-1]) == s[len(s)-1]
+}
@@ -0,0 +1,160 @@
+// Package limiter 基于 sentinel 的接口、biz tag 和调用方限流
+//
+// 规则来自三个配置表,值为 "qps[,warmup=预热秒数][,throttling=最大排队毫秒数]":
+// [SENTINEL_RES_QPS] 按接口资源(api_segment、api_snowflake 等)限流;
+// [SENTINEL_TAG_QPS] 按 biz tag 限流,所有接口共用,资源名为 tag:<tag>;
+// [SENTINEL_CALLER_QPS] 按调用方 appkey 限流,所有接口共用,资源名为 caller:<appkey>,
+// 没有正确签名的请求按客户端 IP 作为调用方,资源名为 caller:<ip>。
+// 默认超过阈值直接拒绝,warmup 为冷启动预热,throttling 为匀速排队。
+// 另外可以通过管理接口维护 flow 和熔断规则,见 RuleSet。
+// viper 的 map key 统一转为小写,tag 和 appkey 按小写匹配
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	sentinel "github.com/alibaba/sentinel-golang/api"
+	"github.com/alibaba/sentinel-golang/core/base"
+	"github.com/alibaba/sentinel-golang/core/flow"
+	"github.com/spf13/cast"
+
+	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/ctxkit"
+)
+
+const (
+	TagPrefix    = "tag:"
+	CallerPrefix = "caller:"
+)
+
+var (
+	mu sync.RWMutex
+	// 只进入配置了规则的资源,避免任意 tag 都创建统计节点
+	resources = make(map[string]struct{})
+)
+
+// ParseRule 解析 "qps[,warmup=秒][,throttling=毫秒]" 格式的规则
+func ParseRule(resource, spec string) (*flow.Rule, error) {
+	parts := strings.Split(spec, ",")
+	threshold, err := cast.ToFloat64E(strings.TrimSpace(parts[0]))
+	if err != nil || threshold < 0 {
+		return nil, fmt.Errorf("invalid qps %s of resource %s", parts[0], resource)
+	}
+	rule := &flow.Rule{
+		Resource:               resource,
+		Threshold:              threshold,
+		TokenCalculateStrategy: flow.Direct,
+		ControlBehavior:        flow.Reject,
+	}
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid option %s of resource %s", part, resource)
+		}
+		v, err := cast.ToUint32E(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid option %s of resource %s", part, resource)
+		}
+		switch strings.TrimSpace(kv[0]) {
+		case "warmup":
+			rule.TokenCalculateStrategy = flow.WarmUp
+			rule.WarmUpPeriodSec = v
+		case "throttling":
+			rule.ControlBehavior = flow.Throttling
+			rule.MaxQueueingTimeMs = v
+		default:
+			return nil, fmt.Errorf("unknown option %s of resource %s", kv[0], resource)
+		}
+	}
+	return rule, nil
+}
+
+// ConfigRules 根据配置生成规则
+func ConfigRules() ([]*flow.Rule, error) {
+	rules := make([]*flow.Rule, 0)
+	for _, t := range []struct {
+		key    string
+		prefix string
+	}{
+		{"SENTINEL_RES_QPS", ""},
+		{"SENTINEL_TAG_QPS", TagPrefix},
+		{"SENTINEL_CALLER_QPS", CallerPrefix},
+	} {
+		for name, spec := range conf.GetStrMapStr(t.key) {
+			rule, err := ParseRule(t.prefix+name, spec)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+func hasRule(resource string) bool {
+	mu.RLock()
+	_, ok := resources[resource]
+	mu.RUnlock()
+	return ok
+}
+
+// Entry 检查 ctx 中签名正确的调用方、biz tag 和接口资源 res,任一被限流时返回 false。
+// count 为本次请求要发的 ID 个数,按 ID 个数而不是请求数占用配额,小于 1 时按 1 计算。
+// 返回 true 时请求结束后必须调用 exit,发号失败时传入 err,供按异常比例或异常数熔断的规则统计
+func Entry(ctx context.Context, res, tag string, count int) (exit func(errs ...error), ok bool) {
+	if count < 1 {
+		count = 1
+	}
+	// 从调用方到接口依次检查,被调用方或 tag 规则拒绝的请求不占用接口的配额
+	// sentinel 的 batch count 为 uint32,超出时按最大值计算,总会被配置了规则的资源拒绝
+	batch := uint32(math.MaxUint32)
+	if uint64(count) < math.MaxUint32 {
+		batch = uint32(count)
+	}
+	names := make([]string, 0, 3)
+	if caller := callerOf(ctx); len(caller) > 0 {
+		names = append(names, CallerPrefix+caller)
+	}
+	if len(tag) > 0 {
+		names = append(names, TagPrefix+strings.ToLower(tag))
+	}
+	if len(res) > 0 {
+		names = append(names, res)
+	}
+	entries := make([]*base.SentinelEntry, 0, len(names))
+	exit = func(errs ...error) {
+		for i := len(entries) - 1; i >= 0; i-- {
+			for _, err := range errs {
+				if err != nil {
+					sentinel.TraceError(entries[i], err)
+				}
+			}
+			entries[i].Exit()
+		}
+	}
+	for _, name := range names {
+		if !hasRule(name) {
+			continue
+		}
+		e, b := sentinel.Entry(name, sentinel.WithTrafficType(base.Inbound), sentinel.WithBatchCount(batch))
+		if b != nil {
+			exit()
+			return func(...error) {}, false
+		}
+		entries = append(entries, e)
+	}
+	return exit, true
+}
+
+// callerOf 签名正确时为小写的 appkey,否则为客户端 IP,未签名的请求不能通过伪造 appkey 占用别人的配额
+func callerOf(ctx context.Context) string {
+	if ctxkit.IsValidSignKey(ctx) {
+		appkey, _, _ := ctxkit.GetSign(ctx)
+		return strings.ToLower(appkey)
+	}
+	return ctxkit.GetUserIP(ctx)
+}
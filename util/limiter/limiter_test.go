@@ -0,0 +1,73 @@
+package limiter
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	sentinel "github.com/alibaba/sentinel-golang/api"
+
+	"github.com/busyfree/leaf-go/util/conf"
+	"github.com/busyfree/leaf-go/util/ctxkit"
+)
+
+func TestEntryBatchCount(t *testing.T) {
+	if err := sentinel.InitDefault(); err != nil {
+		t.Fatal(err)
+	}
+	conf.Set("SENTINEL_RULES_FILE", filepath.Join(t.TempDir(), "sentinel_rules.json"))
+	conf.Set("SENTINEL_RES_QPS", `{"api_batch": "10"}`)
+	defer conf.Set("SENTINEL_RES_QPS", "{}")
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// 一次请求 6 个 ID 后,同一秒内剩余配额不足 6 个
+	exit, ok := Entry(ctx, "api_batch", "", 6)
+	if !ok {
+		t.Fatal("first batch should pass")
+	}
+	exit()
+	if _, ok = Entry(ctx, "api_batch", "", 6); ok {
+		t.Fatal("second batch should be limited by id count")
+	}
+}
+
+func TestEntryCallerFallback(t *testing.T) {
+	if err := sentinel.InitDefault(); err != nil {
+		t.Fatal(err)
+	}
+	conf.Set("SENTINEL_RULES_FILE", filepath.Join(t.TempDir(), "sentinel_rules.json"))
+	conf.Set("SENTINEL_CALLER_QPS", `{"10.0.0.8": "5", "order-svc": "100"}`)
+	defer conf.Set("SENTINEL_CALLER_QPS", "{}")
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 签名不正确时伪造的 appkey 不生效,按客户端 IP 限流
+	ctx := ctxkit.WithUserIP(context.Background(), "10.0.0.8")
+	ctx = ctxkit.WithSign(ctx, "order-svc", "", "bad")
+	ctx = ctxkit.WithValidSign(ctx, false)
+	exit, ok := Entry(ctx, "", "", 5)
+	if !ok {
+		t.Fatal("first batch should pass")
+	}
+	exit()
+	if _, ok = Entry(ctx, "", "", 1); ok {
+		t.Fatal("unsigned request should be limited by client ip")
+	}
+
+	// 超出 uint32 的 count 不能溢出成很小的值
+	other := ctxkit.WithUserIP(context.Background(), "10.0.0.9")
+	other = ctxkit.WithSign(other, "order-svc", "", "ok")
+	other = ctxkit.WithValidSign(other, true)
+	if _, ok = Entry(other, "", "", 1<<32+1); ok {
+		t.Fatal("oversized count should be limited")
+	}
+	exit, ok = Entry(other, "", "", 1)
+	if !ok {
+		t.Fatal("signed request should use the appkey quota")
+	}
+	exit()
+}
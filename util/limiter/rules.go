@@ -0,0 +1,260 @@
+package limiter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/alibaba/sentinel-golang/core/circuitbreaker"
+	"github.com/alibaba/sentinel-golang/core/flow"
+
+	"github.com/busyfree/leaf-go/util/conf"
+)
+
+var (
+	// ErrRuleNotFound 修改或删除的规则不存在
+	ErrRuleNotFound = errors.New("rule not found")
+	// ErrInvalidRule 规则参数不合法
+	ErrInvalidRule = errors.New("invalid rule")
+)
+
+// RuleSet 运行时通过管理接口维护的规则,保存在 SENTINEL_RULES_FILE 中,与配置中的规则同时生效
+type RuleSet struct {
+	Flow           []*flow.Rule           `json:"flow"`
+	CircuitBreaker []*circuitbreaker.Rule `json:"circuitBreaker"`
+}
+
+var (
+	// ruleMu 保证读文件、修改、写文件、加载规则整体串行
+	ruleMu  sync.Mutex
+	managed = new(RuleSet)
+)
+
+// RulesFile 规则文件路径,默认为配置目录下的 sentinel_rules.json
+func RulesFile() string {
+	file := conf.GetString("SENTINEL_RULES_FILE")
+	if len(file) == 0 {
+		return filepath.Join(conf.GetConfigPath(), "sentinel_rules.json")
+	}
+	if !filepath.IsAbs(file) {
+		return filepath.Join(conf.GetConfigPath(), file)
+	}
+	return file
+}
+
+// Load 重新读取配置和规则文件并替换所有规则,失败时保留原规则
+func Load() error {
+	ruleMu.Lock()
+	defer ruleMu.Unlock()
+	set, err := readRules()
+	if err != nil {
+		return err
+	}
+	if err = apply(set); err != nil {
+		return err
+	}
+	managed = set
+	return nil
+}
+
+// ManagedRules 返回管理接口维护的规则副本
+func ManagedRules() RuleSet {
+	ruleMu.Lock()
+	defer ruleMu.Unlock()
+	return managed.clone()
+}
+
+// SaveFlowRule id 为空时新增,否则替换相同 id 的规则
+func SaveFlowRule(rule *flow.Rule) (*flow.Rule, error) {
+	if err := flow.IsValidRule(rule); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRule, err)
+	}
+	ruleMu.Lock()
+	defer ruleMu.Unlock()
+	set := managed.clone()
+	if len(rule.ID) == 0 {
+		rule.ID = newRuleId()
+		set.Flow = append(set.Flow, rule)
+	} else {
+		i := flowIndex(set.Flow, rule.ID)
+		if i < 0 {
+			return nil, ErrRuleNotFound
+		}
+		set.Flow[i] = rule
+	}
+	return rule, update(&set)
+}
+
+// DeleteFlowRule 删除 id 对应的规则
+func DeleteFlowRule(id string) error {
+	ruleMu.Lock()
+	defer ruleMu.Unlock()
+	set := managed.clone()
+	i := flowIndex(set.Flow, id)
+	if i < 0 {
+		return ErrRuleNotFound
+	}
+	set.Flow = append(set.Flow[:i], set.Flow[i+1:]...)
+	return update(&set)
+}
+
+// SaveCircuitBreakerRule id 为空时新增,否则替换相同 id 的规则
+func SaveCircuitBreakerRule(rule *circuitbreaker.Rule) (*circuitbreaker.Rule, error) {
+	if err := circuitbreaker.IsValidRule(rule); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRule, err)
+	}
+	ruleMu.Lock()
+	defer ruleMu.Unlock()
+	set := managed.clone()
+	if len(rule.Id) == 0 {
+		rule.Id = newRuleId()
+		set.CircuitBreaker = append(set.CircuitBreaker, rule)
+	} else {
+		i := circuitBreakerIndex(set.CircuitBreaker, rule.Id)
+		if i < 0 {
+			return nil, ErrRuleNotFound
+		}
+		set.CircuitBreaker[i] = rule
+	}
+	return rule, update(&set)
+}
+
+// DeleteCircuitBreakerRule 删除 id 对应的规则
+func DeleteCircuitBreakerRule(id string) error {
+	ruleMu.Lock()
+	defer ruleMu.Unlock()
+	set := managed.clone()
+	i := circuitBreakerIndex(set.CircuitBreaker, id)
+	if i < 0 {
+		return ErrRuleNotFound
+	}
+	set.CircuitBreaker = append(set.CircuitBreaker[:i], set.CircuitBreaker[i+1:]...)
+	return update(&set)
+}
+
+// update 先加载再写文件,规则无法加载时不会写入文件
+func update(set *RuleSet) error {
+	if err := apply(set); err != nil {
+		_ = apply(managed)
+		return err
+	}
+	if err := writeRules(set); err != nil {
+		// 写文件失败时恢复原规则,保证内存与文件一致
+		_ = apply(managed)
+		return err
+	}
+	managed = set
+	return nil
+}
+
+// apply 合并配置中的 flow 规则后加载到 sentinel
+func apply(set *RuleSet) error {
+	configRules, err := ConfigRules()
+	if err != nil {
+		return err
+	}
+	flowRules := append(configRules, set.Flow...)
+	if _, err = flow.LoadRules(flowRules); err != nil {
+		return err
+	}
+	if _, err = circuitbreaker.LoadRules(set.CircuitBreaker); err != nil {
+		return err
+	}
+	m := make(map[string]struct{}, len(flowRules)+len(set.CircuitBreaker))
+	for _, rule := range flowRules {
+		m[rule.Resource] = struct{}{}
+	}
+	for _, rule := range set.CircuitBreaker {
+		m[rule.Resource] = struct{}{}
+	}
+	mu.Lock()
+	resources = m
+	mu.Unlock()
+	return nil
+}
+
+// readRules 规则文件不存在时返回空规则
+func readRules() (*RuleSet, error) {
+	set := new(RuleSet)
+	data, err := os.ReadFile(RulesFile())
+	if os.IsNotExist(err) {
+		return set, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, set); err != nil {
+		return nil, err
+	}
+	// 手工编辑文件时可以不写 id,补上 id 才能通过管理接口修改和删除
+	for _, rule := range set.Flow {
+		if len(rule.ID) == 0 {
+			rule.ID = newRuleId()
+		}
+	}
+	for _, rule := range set.CircuitBreaker {
+		if len(rule.Id) == 0 {
+			rule.Id = newRuleId()
+		}
+	}
+	return set, nil
+}
+
+// writeRules 先写临时文件再改名,避免进程退出时留下不完整的文件
+func writeRules(set *RuleSet) error {
+	data, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := RulesFile()
+	tmp := file + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func (s *RuleSet) clone() RuleSet {
+	c := RuleSet{
+		Flow:           make([]*flow.Rule, 0, len(s.Flow)),
+		CircuitBreaker: make([]*circuitbreaker.Rule, 0, len(s.CircuitBreaker)),
+	}
+	for _, rule := range s.Flow {
+		r := *rule
+		c.Flow = append(c.Flow, &r)
+	}
+	for _, rule := range s.CircuitBreaker {
+		r := *rule
+		c.CircuitBreaker = append(c.CircuitBreaker, &r)
+	}
+	return c
+}
+
+func flowIndex(rules []*flow.Rule, id string) int {
+	for i, rule := range rules {
+		if rule.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func circuitBreakerIndex(rules []*circuitbreaker.Rule, id string) int {
+	for i, rule := range rules {
+		if rule.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func newRuleId() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -52,6 +52,15 @@ var (
 	DBMaxIdleClosed *prometheus.CounterVec
 	// DBMaxLifetimeClosed 因为 SetConnMaxLifetime 而被关闭的连接总数量
 	DBMaxLifetimeClosed *prometheus.CounterVec
+
+	// SnowflakeClockSkewSeconds 本机与其他 snowflake 节点平均时间的偏差
+	SnowflakeClockSkewSeconds *prometheus.GaugeVec
+	// SnowflakeSequenceOverflowTotal snowflake 序列号用尽次数
+	SnowflakeSequenceOverflowTotal *prometheus.CounterVec
+	// RESPDurationsSeconds RESP 协议发号命令耗时
+	RESPDurationsSeconds *prometheus.HistogramVec
+	// MemcachedDurationsSeconds memcached 协议发号命令耗时
+	MemcachedDurationsSeconds *prometheus.HistogramVec
 )
 
 var defBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1}
@@ -230,4 +239,38 @@ func init() {
 		ConstLabels: map[string]string{"app": conf.AppID},
 	}, []string{"name"})
 	prometheus.MustRegister(DBMaxLifetimeClosed)
+
+	SnowflakeClockSkewSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   "sniper",
+		Name:        "snowflake_clock_skew_seconds",
+		Help:        "snowflake local clock skew against peer nodes",
+		ConstLabels: map[string]string{"app": conf.AppID},
+	}, []string{"holder"})
+	prometheus.MustRegister(SnowflakeClockSkewSeconds)
+
+	SnowflakeSequenceOverflowTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   "sniper",
+		Name:        "snowflake_sequence_overflow_total",
+		Help:        "snowflake sequence overflow count",
+		ConstLabels: map[string]string{"app": conf.AppID},
+	}, []string{"namespace", "strategy"})
+	prometheus.MustRegister(SnowflakeSequenceOverflowTotal)
+
+	RESPDurationsSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   "sniper",
+		Name:        "resp_server_durations_seconds",
+		Help:        "RESP server command latency distributions",
+		Buckets:     defBuckets,
+		ConstLabels: map[string]string{"app": conf.AppID},
+	}, []string{"cmd", "status"})
+	prometheus.MustRegister(RESPDurationsSeconds)
+
+	MemcachedDurationsSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   "sniper",
+		Name:        "memcached_server_durations_seconds",
+		Help:        "memcached server command latency distributions",
+		Buckets:     defBuckets,
+		ConstLabels: map[string]string{"app": conf.AppID},
+	}, []string{"cmd", "status"})
+	prometheus.MustRegister(MemcachedDurationsSeconds)
 }
@@ -69,6 +69,21 @@ func MsTimestamp2MonthStr() string {
 	return time.Now().Format("200601")
 }
 
+// Time2DayStr 按天格式化指定时间,与 MsTimestamp2DayStr 格式一致
+func Time2DayStr(t time.Time) string {
+	return t.Format("20060102")
+}
+
+// Time2DayHourStr 按小时格式化指定时间,与 MsTimestamp2DayHourStr 格式一致
+func Time2DayHourStr(t time.Time) string {
+	return t.Format("2006010215")
+}
+
+// Time2MonthStr 按月格式化指定时间,与 MsTimestamp2MonthStr 格式一致
+func Time2MonthStr(t time.Time) string {
+	return t.Format("200601")
+}
+
 func MsTimestamp2MilliStr() string {
 	return strings.Replace(time.Now().Format("20060102150405.000"), ".", "", 1)
 }
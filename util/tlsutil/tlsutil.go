@@ -0,0 +1,172 @@
+// Package tlsutil 根据配置生成 tls.Config,文件路径为相对路径时相对配置目录
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/busyfree/leaf-go/util/conf"
+)
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify_if_given":    tls.VerifyClientCertIfGiven,
+	"require_and_verify": tls.RequireAndVerifyClientCert,
+}
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ServerConfig 可重新加载的服务端证书,读取以下配置:
+// ${prefix}_CERT_FILE、${prefix}_KEY_FILE 服务端证书和私钥;
+// ${prefix}_CLIENT_CA_FILE 校验客户端证书的 CA,配置后默认要求客户端证书(mTLS);
+// ${prefix}_CLIENT_AUTH 客户端证书校验方式:none,request,require,verify_if_given,require_and_verify;
+// ${prefix}_MIN_VERSION 最低 TLS 版本:1.2,1.3,默认 1.2
+type ServerConfig struct {
+	prefix string
+	mu     sync.RWMutex
+	cfg    *tls.Config
+}
+
+// NewServerConfig 未配置 ${prefix}_CERT_FILE 时返回 nil
+func NewServerConfig(prefix string) (*ServerConfig, error) {
+	if len(conf.GetString(prefix+"_CERT_FILE")) == 0 {
+		return nil, nil
+	}
+	s := new(ServerConfig)
+	s.prefix = prefix
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload 重新读取配置和证书文件,失败时继续使用原来的证书
+func (s *ServerConfig) Reload() error {
+	cert, err := tls.LoadX509KeyPair(path(conf.GetString(s.prefix+"_CERT_FILE")), path(conf.GetString(s.prefix+"_KEY_FILE")))
+	if err != nil {
+		return fmt.Errorf("load %s cert error:%w", s.prefix, err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if cfg.MinVersion, err = minVersion(s.prefix); err != nil {
+		return err
+	}
+	if caFile := conf.GetString(s.prefix + "_CLIENT_CA_FILE"); len(caFile) > 0 {
+		if cfg.ClientCAs, err = loadCertPool(caFile); err != nil {
+			return err
+		}
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if v := strings.ToLower(conf.GetString(s.prefix + "_CLIENT_AUTH")); len(v) > 0 {
+		clientAuth, ok := clientAuthTypes[v]
+		if !ok {
+			return fmt.Errorf("unknown %s_CLIENT_AUTH %s", s.prefix, v)
+		}
+		if clientAuth >= tls.VerifyClientCertIfGiven && cfg.ClientCAs == nil {
+			return fmt.Errorf("%s_CLIENT_AUTH %s requires %s_CLIENT_CA_FILE", s.prefix, v, s.prefix)
+		}
+		cfg.ClientAuth = clientAuth
+	}
+	s.mu.Lock()
+	s.cfg = cfg
+	s.mu.Unlock()
+	return nil
+}
+
+// TLSConfig 每次握手使用最新加载的证书,nextProtos 为 ALPN 协议,如 http 使用 h2、http/1.1。
+// 外层同时设置 GetCertificate,http.Server.ServeTLS 以此判断已配置证书,不会再去读取证书文件
+func (s *ServerConfig) TLSConfig(nextProtos ...string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+			return &s.cfg.Certificates[0], nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			s.mu.RLock()
+			cfg := s.cfg.Clone()
+			s.mu.RUnlock()
+			cfg.NextProtos = nextProtos
+			return cfg, nil
+		},
+	}
+}
+
+// NewClientConfig 客户端 TLS 配置,读取以下配置:
+// ${prefix}_ENABLE 是否开启 TLS,配置了 CA 或客户端证书时自动开启;
+// ${prefix}_CA_FILE 校验服务端证书的 CA,为空时使用系统 CA;
+// ${prefix}_CERT_FILE、${prefix}_KEY_FILE 客户端证书和私钥(mTLS);
+// ${prefix}_SERVER_NAME 校验服务端证书使用的域名,为空时使用连接地址;
+// ${prefix}_INSECURE_SKIP_VERIFY 不校验服务端证书,仅用于测试。
+// 未开启 TLS 时返回 nil
+func NewClientConfig(prefix string) (*tls.Config, error) {
+	caFile := conf.GetString(prefix + "_CA_FILE")
+	certFile := conf.GetString(prefix + "_CERT_FILE")
+	keyFile := conf.GetString(prefix + "_KEY_FILE")
+	if !conf.GetBool(prefix+"_ENABLE") && len(caFile) == 0 && len(certFile) == 0 {
+		return nil, nil
+	}
+	var err error
+	cfg := &tls.Config{
+		ServerName:         conf.GetString(prefix + "_SERVER_NAME"),
+		InsecureSkipVerify: conf.GetBool(prefix + "_INSECURE_SKIP_VERIFY"),
+	}
+	if cfg.MinVersion, err = minVersion(prefix); err != nil {
+		return nil, err
+	}
+	if len(caFile) > 0 {
+		if cfg.RootCAs, err = loadCertPool(caFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(certFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(path(certFile), path(keyFile))
+		if err != nil {
+			return nil, fmt.Errorf("load %s cert error:%w", prefix, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func minVersion(prefix string) (uint16, error) {
+	v := conf.GetString(prefix + "_MIN_VERSION")
+	if len(v) == 0 {
+		return tls.VersionTLS12, nil
+	}
+	version, ok := tlsVersions[v]
+	if !ok {
+		return 0, fmt.Errorf("unknown %s_MIN_VERSION %s", prefix, v)
+	}
+	return version, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path(file))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", file)
+	}
+	return pool, nil
+}
+
+func path(file string) string {
+	if len(file) == 0 || filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(conf.GetConfigPath(), file)
+}